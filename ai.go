@@ -0,0 +1,412 @@
+package tetris
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	AI_MOVE_FRAMES   = 3               // frames between moves of the demo, to be watched
+	AI_RESTART_DELAY = 3 * time.Second // before the demo plays again
+)
+
+// Weights of the board features after a placement, the best placement
+// has the highest sum of the weighted features
+type aiWeights struct {
+	Height    float64 `json:"height"`    // aggregate height of the columns
+	Lines     float64 `json:"lines"`     // rows cleared
+	Holes     float64 `json:"holes"`     // empty cells under blocks
+	Bumpiness float64 `json:"bumpiness"` // height differences of adjacent columns
+	Wells     float64 `json:"wells"`     // depth of one column wide wells
+}
+
+func defaultWeights() *aiWeights {
+	return &aiWeights{
+		Height:    -0.6,
+		Lines:     0.3,
+		Holes:     -1.5,
+		Bumpiness: -0.3,
+		Wells:     -0.2,
+	}
+}
+
+// Load the weights from a JSON file, missing ones are the defaults
+func loadWeights(path string) (*aiWeights, error) {
+	w := defaultWeights()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, w); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// A resting position of the current shape, with the controls to get there
+type placement struct {
+	shape *Shape
+	pos   Point
+	path  []Control // before the hard drop
+	score float64
+}
+
+// Controls the AI moves with, one row or column or rotation at a time
+var aiControls = []Control{CTRL_LEFT, CTRL_RIGHT, CTRL_ROTATE, CTRL_ROTATE_CCW, CTRL_SOFT_DROP}
+
+// Bounds of the positions searched, the box of a shape could be
+// out of the board by SHAPE_SIZE-1 at most
+const (
+	SEARCH_COLS  = COL + SHAPE_SIZE - 1
+	SEARCH_ROWS  = ROW + SHAPE_SIZE - 1
+	SEARCH_NODES = SHAPE_SIZE * SEARCH_COLS * SEARCH_ROWS // of 4 rotations at most
+)
+
+// A position of a shape
+type aiNode struct {
+	id        int
+	left, top int
+}
+
+func (n aiNode) shape() *Shape {
+	return shapes[n.id]
+}
+
+func (n aiNode) pos() Point {
+	return Point{n.left, n.top}
+}
+
+// The position after the control
+func (n aiNode) move(c Control) aiNode {
+	switch c {
+	case CTRL_LEFT:
+		n.left--
+	case CTRL_RIGHT:
+		n.left++
+	case CTRL_ROTATE:
+		n.id = shapes[n.id].prev
+	case CTRL_ROTATE_CCW:
+		n.id = shapes[n.id].next
+	default:
+		n.top++
+	}
+	return n
+}
+
+// Positions reachable from a start, and the step to each. The arrays
+// are reused by the searches, so that searching allocates nothing
+type aiSearch struct {
+	start   aiNode
+	resting []aiNode // could not move down, in the order found
+
+	gen       uint32               // of the search, marks the nodes seen
+	rotations [SHAPE_SIZE]int      // shape ids of the rotations
+	seen      [SEARCH_NODES]uint32 // gen of the search seen the node
+	steps     [SEARCH_NODES]aiStep // to the node
+	queue     [SEARCH_NODES]aiNode // to visit
+	buf       [SEARCH_NODES]aiNode // of resting
+	board     bitboard             // searched
+	scratch   bitboard             // to evaluate placements
+}
+
+type aiStep struct {
+	from    aiNode
+	control Control
+}
+
+// Search the positions of s reachable from pos. The caller should hold g.m
+func (g *Game) search(s *Shape, pos Point) *aiSearch {
+	r := new(aiSearch)
+	r.run(g, s, pos)
+	return r
+}
+
+// Search breadth first, so that the paths are the shortest
+func (r *aiSearch) run(g *Game, s *Shape, pos Point) {
+	r.gen++
+	if r.gen == 0 { // wrapped
+		r.seen = [SEARCH_NODES]uint32{}
+		r.gen = 1
+	}
+	r.rotations = [SHAPE_SIZE]int{-1, -1, -1, -1}
+	for i, id := 0, s.id; i < SHAPE_SIZE && r.rotations[0] != id; i++ {
+		r.rotations[i] = id
+		id = shapes[id].next
+	}
+
+	r.board = boardOf(&g.model)
+	r.start = aiNode{s.id, pos.left, pos.top}
+	r.resting = r.buf[:0]
+	r.seen[r.index(r.start)] = r.gen
+	r.queue[0] = r.start
+	head, tail := 0, 1
+
+	for head < tail {
+		n := r.queue[head]
+		head++
+
+		for _, c := range aiControls {
+			m := n.move(c)
+			if !r.fits(m) {
+				continue
+			}
+			if k := r.index(m); r.seen[k] != r.gen {
+				r.seen[k] = r.gen
+				r.steps[k] = aiStep{n, c}
+				r.queue[tail] = m
+				tail++
+			}
+		}
+
+		if !r.fits(n.move(CTRL_SOFT_DROP)) {
+			r.resting = append(r.resting, n)
+		}
+	}
+}
+
+// Index of n in the arrays, n should fit in the board
+func (r *aiSearch) index(n aiNode) int {
+	rot := 0
+	for rot < SHAPE_SIZE-1 && r.rotations[rot] != n.id {
+		rot++
+	}
+	col := n.left + SHAPE_SIZE - 1
+	row := n.top + SHAPE_SIZE - 1
+	return (rot*SEARCH_COLS+col)*SEARCH_ROWS + row
+}
+
+func (r *aiSearch) fits(n aiNode) bool {
+	return r.board.fits(shapes[n.id], Point{n.left, n.top})
+}
+
+// Controls from the start to n, the last drops are left to the hard drop
+func (r *aiSearch) path(n aiNode) []Control {
+	var path []Control
+	for ; n != r.start; n = r.steps[r.index(n)].from {
+		path = append(path, r.steps[r.index(n)].control)
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	for len(path) > 0 && path[len(path)-1] == CTRL_SOFT_DROP {
+		path = path[:len(path)-1]
+	}
+	return path
+}
+
+// Returns true if n is a resting position found
+func (r *aiSearch) canRest(n aiNode) bool {
+	for _, m := range r.resting {
+		if m == n {
+			return true
+		}
+	}
+	return false
+}
+
+// The best resting position by w, false if none
+func (r *aiSearch) best(w *aiWeights) (aiNode, float64, bool) {
+	var best aiNode
+	bestScore, found := 0.0, false
+	for _, n := range r.resting {
+		s, pos := n.shape(), n.pos()
+		r.scratch = r.board
+		r.scratch.place(s, pos)
+		score := w.evaluate(&r.scratch, r.scratch.clear())
+		if pos.top+s.bounds().y == 0 {
+			score = -math.MaxFloat64 // tops out
+		}
+		if !found || score > bestScore {
+			best, bestScore, found = n, score, true
+		}
+	}
+	return best, bestScore, found
+}
+
+// Best placement of the current shape reachable from where it is,
+// nil if none. The caller should hold g.m
+func (g *Game) plan(w *aiWeights) *placement {
+	r := g.search(g.currShape, g.pos)
+	n, score, ok := r.best(w)
+	if !ok {
+		return nil
+	}
+	return &placement{shape: n.shape(), pos: n.pos(), path: r.path(n), score: score}
+}
+
+// Weighted sum of the features of the board
+func (w *aiWeights) evaluate(board *bitboard, lines int) float64 {
+	heights, holes := board.heights()
+
+	height, bumpiness, wells := 0, 0, 0
+	for j, h := range heights {
+		height += h
+		left, right := ROW, ROW // walls
+		if j > 0 {
+			left = heights[j-1]
+			bumpiness += abs(h - left)
+		}
+		if j < COL-1 {
+			right = heights[j+1]
+		}
+		if left > right {
+			left = right
+		}
+		if d := left - h; d > 0 {
+			wells += d
+		}
+	}
+
+	return w.Height*float64(height) +
+		w.Lines*float64(lines) +
+		w.Holes*float64(holes) +
+		w.Bumpiness*float64(bumpiness) +
+		w.Wells*float64(wells)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// Plays the game in the gui as a demo, one move every few frames
+// to be watched, and again after game over (attract mode)
+type aiPlayer struct {
+	g      *Game
+	w      *aiWeights
+	round  int  // of the game played, stops if restarted by others
+	pieces uint // of the shape planned
+	path   []Control
+	expect Point // position after the last move, planned again if moved by others
+
+	m    sync.Mutex
+	done chan bool // closed when stopped
+}
+
+// Restart g in marathon mode and play it
+func startDemo(g *Game, w *aiWeights) *aiPlayer {
+	p := &aiPlayer{g: g, w: w, done: make(chan bool)}
+	g.setMode(MODE_MARATHON)
+	p.restart()
+	go p.run()
+	return p
+}
+
+func (p *aiPlayer) restart() {
+	p.g.restart()
+	p.g.m.Lock()
+	p.round = p.g.round
+	p.path = nil
+	p.g.m.Unlock()
+}
+
+// Stop playing, returns false if stopped already
+func (p *aiPlayer) stop() bool {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	select {
+	case <-p.done:
+		return false
+	default:
+		close(p.done)
+		return true
+	}
+}
+
+// Returns true if not stopped
+func (p *aiPlayer) playing() bool {
+	select {
+	case <-p.done:
+		return false
+	default:
+		return true
+	}
+}
+
+func (p *aiPlayer) run() {
+	defer p.stop()
+
+	ticker := time.NewTicker(AI_MOVE_FRAMES * FRAME)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		}
+
+		over, ok := p.move()
+		if !ok {
+			return
+		}
+		if over {
+			select {
+			case <-p.done:
+				return
+			case <-time.After(AI_RESTART_DELAY):
+			}
+			p.restart()
+		}
+	}
+}
+
+// Make the next move of the plan, planned for each new shape; returns
+// whether the game is over, and false if restarted by others
+func (p *aiPlayer) move() (over, ok bool) {
+	g := p.g
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	if g.round != p.round {
+		return false, false
+	}
+	if g.state != STATE_PLAYING {
+		return !g.running(), true
+	}
+	if g.entry > 0 {
+		return false, true // waits for the shape to enter, as the keys do
+	}
+
+	if p.pieces != g.pieces || p.path == nil || !g.pos.equals(p.expect) {
+		p.pieces = g.pieces
+		p.path = []Control{}
+		if best := g.plan(p.w); best != nil {
+			p.path = best.path
+		}
+	}
+
+	if len(p.path) == 0 {
+		g.dropDown()
+		g.lockShape()
+		p.path = nil
+		return false, true
+	}
+
+	c := p.path[0]
+	p.path = p.path[1:]
+	var moved bool
+	switch c {
+	case CTRL_LEFT:
+		moved = g.tryMove((*Shape).moveLeft)
+	case CTRL_RIGHT:
+		moved = g.tryMove((*Shape).moveRight)
+	case CTRL_ROTATE:
+		moved = g.tryRotate((*Shape).rotate)
+	case CTRL_ROTATE_CCW:
+		moved = g.tryRotate((*Shape).rotateCCW)
+	case CTRL_SOFT_DROP:
+		moved = g.tryMove((*Shape).moveDown)
+	}
+	if !moved {
+		p.path = nil // plan again from here
+	}
+	p.expect = g.pos
+	return false, true
+}
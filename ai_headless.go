@@ -0,0 +1,90 @@
+package tetris
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+)
+
+// Result of a headless game played by the AI
+type aiResult struct {
+	score     uint64
+	rows      uint
+	pieces    int
+	toppedOut bool
+}
+
+// Play a marathon of seed by the AI as fast as possible,
+// up to pieces shapes locked
+func playAI(w *aiWeights, seed int64, pieces int) aiResult {
+	g := NewGame()
+	done := make(chan bool)
+	defer close(done)
+	go g.discardEvents(done)
+
+	g.stepped = true
+	g.seed(seed)
+	g.start()
+
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	var r aiResult
+	search := new(aiSearch)
+	for r.pieces < pieces && g.state.active() {
+		// the frames of the entry delay pass as in a game played
+		for g.entry > 0 && g.frame() {
+		}
+		if !g.state.active() {
+			break
+		}
+		search.run(g, g.currShape, g.pos)
+		if n, _, ok := search.best(w); ok {
+			g.currShape = n.shape()
+			g.moveTo(&Moving{g.pos, n.pos()})
+		} else {
+			g.dropDown()
+		}
+		g.lockShape()
+		r.pieces++
+	}
+	r.score = g.score
+	r.rows = g.rows
+	r.toppedOut = g.state == STATE_GAMEOVER
+	return r
+}
+
+// The ai command, plays headless games by the AI and prints the results
+func RunAI(args []string) error {
+	flags := flag.NewFlagSet("ai", flag.ContinueOnError)
+	weights := flags.String("weights", "", "JSON file of the weights, the defaults if empty")
+	seed := flags.Int64("seed", 1, "seed of the first game, increased for the others")
+	games := flags.Int("games", 1, "number of games")
+	pieces := flags.Int("pieces", 1000, "max shapes per game")
+	verbose := flags.Bool("v", false, "log the games")
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	w := defaultWeights()
+	if *weights != "" {
+		var err error
+		if w, err = loadWeights(*weights); err != nil {
+			return err
+		}
+	}
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+
+	for i := 0; i < *games; i++ {
+		s := *seed + int64(i)
+		r := playAI(w, s, *pieces)
+		fmt.Printf("seed %d: score %d, rows %d, pieces %d, topped out %v\n",
+			s, r.score, r.rows, r.pieces, r.toppedOut)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package tetris
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The demo moves the shape along the path planned, onto the best placement
+func TestAIPlayerFollowsPlan(t *testing.T) {
+	g := newSteppedGame(5)
+	p := &aiPlayer{g: g, w: defaultWeights(), done: make(chan bool)}
+	g.m.Lock()
+	p.round = g.round
+	g.m.Unlock()
+
+	for n := 0; n < 50 && stateOf(g).active(); n++ {
+		g.m.Lock()
+		pieces := g.pieces
+		best := g.plan(p.w)
+		want := boardOf(&g.model)
+		want.place(best.shape, best.pos)
+		want.clear()
+		g.m.Unlock()
+
+		for i := 0; ; i++ {
+			if i > 100 {
+				t.Fatal("the shape never locked")
+			}
+			g.m.Lock()
+			entering, pos := g.entry > 0, g.pos
+			g.m.Unlock()
+			if over, ok := p.move(); over || !ok {
+				t.Fatalf("move: over %v, ok %v", over, ok)
+			}
+			if entering {
+				g.m.Lock()
+				moved := g.pos != pos
+				g.m.Unlock()
+				if moved {
+					t.Fatal("moved during the entry delay")
+				}
+				g.step(nil) // the AI waits for the next shape to enter
+			}
+			g.m.Lock()
+			locked := g.pieces != pieces || !g.state.active()
+			g.m.Unlock()
+			if locked {
+				break
+			}
+		}
+
+		if model := modelOf(g); stateOf(g).active() && boardOf(&model) != want {
+			t.Fatalf("shape %d: the board differs from the plan", n)
+		}
+	}
+}
+
+func TestPlayAI(t *testing.T) {
+	a := playAI(defaultWeights(), 3, 200)
+	b := playAI(defaultWeights(), 3, 200)
+	if a != b {
+		t.Errorf("same seed, different games: %+v, %+v", a, b)
+	}
+	if a.rows == 0 {
+		t.Errorf("no rows cleared: %+v", a)
+	}
+}
+
+func TestLoadWeights(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "weights.json")
+	if err := os.WriteFile(path, []byte(`{"holes": -2}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, err := loadWeights(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := defaultWeights()
+	want.Holes = -2
+	if *w != *want {
+		t.Errorf("weights %+v, want %+v", *w, *want)
+	}
+
+	if _, err := loadWeights(filepath.Join(t.TempDir(), "none.json")); err == nil {
+		t.Error("no error loading a missing file")
+	}
+}
+
+func TestSearchAllocs(t *testing.T) {
+	g := newSteppedGame(9)
+	r := new(aiSearch)
+	w := defaultWeights()
+
+	g.m.Lock()
+	defer g.m.Unlock()
+	allocs := testing.AllocsPerRun(100, func() {
+		r.run(g, g.currShape, g.pos)
+		r.best(w)
+	})
+	if allocs != 0 {
+		t.Errorf("%v allocs per search", allocs)
+	}
+}
+
+func BenchmarkSearch(b *testing.B) {
+	g := newSteppedGame(9)
+	r := new(aiSearch)
+	w := defaultWeights()
+
+	g.m.Lock()
+	defer g.m.Unlock()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r.run(g, g.currShape, g.pos)
+		r.best(w)
+	}
+}
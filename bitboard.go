@@ -0,0 +1,106 @@
+package tetris
+
+import "math/bits"
+
+// Rows of the board as bit masks, bit i of a row is set if column i
+// has a block. For bots to simulate placements fast, the game itself
+// keeps the cells in g.model
+type bitboard [ROW]uint16
+
+const FULL_ROW uint16 = 1<<COL - 1
+
+// Shape as bit masks, by id
+type shapeBits struct {
+	rows   [SHAPE_SIZE]uint16 // bit i of row j set if data[j][i] > 0
+	bounds shapeBounds
+}
+
+var shapeBitsList []shapeBits
+
+func init() {
+	for _, s := range shapes {
+		var sb shapeBits
+		for j := 0; j < SHAPE_SIZE; j++ {
+			for i := 0; i < SHAPE_SIZE; i++ {
+				if s.data[j][i] > 0 {
+					sb.rows[j] |= 1 << i
+				}
+			}
+		}
+		sb.bounds = computeBounds(s)
+		shapeBitsList = append(shapeBitsList, sb)
+	}
+}
+
+func boardOf(model *[ROW][COL]uint8) bitboard {
+	var b bitboard
+	for i := range model {
+		for j, c := range model[i] {
+			if c > 0 {
+				b[i] |= 1 << j
+			}
+		}
+	}
+	return b
+}
+
+// Row j of the box of s, at the column left
+func (sb *shapeBits) row(j, left int) uint16 {
+	if left < 0 {
+		return sb.rows[j] >> -left
+	}
+	return sb.rows[j] << left
+}
+
+// Returns true if s at pos is in the board and on no blocks,
+// the same as canMoveShape
+func (b *bitboard) fits(s *Shape, pos Point) bool {
+	sb := &shapeBitsList[s.id]
+	a := sb.bounds
+	if outOfBounds(pos.left+a.x, pos.top+a.y) || outOfBounds(pos.left+a.x2, pos.top+a.y2) {
+		return false
+	}
+	for j := a.y; j <= a.y2; j++ {
+		if b[pos.top+j]&sb.row(j, pos.left) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Lock s at pos, which should fit
+func (b *bitboard) place(s *Shape, pos Point) {
+	sb := &shapeBitsList[s.id]
+	for j := sb.bounds.y; j <= sb.bounds.y2; j++ {
+		b[pos.top+j] |= sb.row(j, pos.left)
+	}
+}
+
+// Clear the full rows, the rows above fall; returns the rows cleared
+func (b *bitboard) clear() int {
+	k := ROW - 1
+	for i := ROW - 1; i >= 0; i-- {
+		if b[i] != FULL_ROW {
+			b[k] = b[i]
+			k--
+		}
+	}
+	n := k + 1
+	for ; k >= 0; k-- {
+		b[k] = 0
+	}
+	return n
+}
+
+// Height of each column, and the empty cells under blocks
+func (b *bitboard) heights() (heights [COL]int, holes int) {
+	var covered uint16 // columns with blocks above
+	for i, row := range b {
+		holes += bits.OnesCount16(covered &^ row)
+		for top := row &^ covered; top != 0; top &= top - 1 {
+			heights[bits.TrailingZeros16(top)] = ROW - i
+		}
+		covered |= row
+	}
+	return
+}
@@ -0,0 +1,179 @@
+package tetris
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// A board of random cells, the rows above top empty
+func randomModel(rnd *rand.Rand, top int) [ROW][COL]uint8 {
+	var m [ROW][COL]uint8
+	for i := top; i < ROW; i++ {
+		for j := 0; j < COL; j++ {
+			if rnd.Intn(3) > 0 {
+				m[i][j] = uint8(1 + rnd.Intn(2))
+			}
+		}
+		if rnd.Intn(4) == 0 { // full rows now and then
+			for j := range m[i] {
+				m[i][j] = CELL_BLOCK
+			}
+		}
+	}
+	return m
+}
+
+// Clear the full rows by the grid, as the reference
+func gridClear(m *[ROW][COL]uint8) int {
+	k := ROW - 1
+	for i := ROW - 1; i >= 0; i-- {
+		full := true
+		for _, c := range m[i] {
+			if c == 0 {
+				full = false
+				break
+			}
+		}
+		if !full {
+			m[k] = m[i]
+			k--
+		}
+	}
+	n := k + 1
+	for ; k >= 0; k-- {
+		m[k] = [COL]uint8{}
+	}
+	return n
+}
+
+// The features by the grid, as the reference
+func gridHeights(m *[ROW][COL]uint8) (heights [COL]int, holes int) {
+	for j := 0; j < COL; j++ {
+		for i := 0; i < ROW; i++ {
+			if m[i][j] > 0 {
+				if heights[j] == 0 {
+					heights[j] = ROW - i
+				}
+			} else if heights[j] > 0 {
+				holes++
+			}
+		}
+	}
+	return
+}
+
+func TestBitboardFits(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	g := NewGame()
+	for k := 0; k < 50; k++ {
+		g.model = randomModel(rnd, rnd.Intn(ROW))
+		b := boardOf(&g.model)
+
+		for _, s := range shapes {
+			for left := 1 - SHAPE_SIZE; left < COL; left++ {
+				for top := 1 - SHAPE_SIZE; top < ROW; top++ {
+					pos := Point{left, top}
+					mv, err := checkMoving(s.area(pos), pos, pos)
+					if want := g.canMoveShape(s, err, mv); b.fits(s, pos) != want {
+						t.Fatalf("shape %d at %+v fits %v, want %v\n%v", s.id, pos, !want, want, g.model)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestBitboardClear(t *testing.T) {
+	rnd := rand.New(rand.NewSource(2))
+	for k := 0; k < 1000; k++ {
+		m := randomModel(rnd, rnd.Intn(ROW))
+		b := boardOf(&m)
+
+		want := gridClear(&m)
+		if n := b.clear(); n != want {
+			t.Fatalf("cleared %d rows, want %d", n, want)
+		}
+		if b != boardOf(&m) {
+			t.Fatalf("board after clear differs\n%v", m)
+		}
+
+		heights, holes := b.heights()
+		wantHeights, wantHoles := gridHeights(&m)
+		if heights != wantHeights || holes != wantHoles {
+			t.Fatalf("heights %v, holes %d; want %v, %d", heights, holes, wantHeights, wantHoles)
+		}
+	}
+}
+
+// Locking by the game and placing on the bitboard end the same
+func TestBitboardLock(t *testing.T) {
+	g := newSteppedGame(4)
+	rnd := rand.New(rand.NewSource(4))
+	r := new(aiSearch)
+
+	g.m.Lock()
+	defer g.m.Unlock()
+	for k := 0; k < 300 && g.state.active(); k++ {
+		r.run(g, g.currShape, g.pos)
+		n := r.resting[rnd.Intn(len(r.resting))]
+		if n.top+n.shape().bounds().y == 0 {
+			continue // tops out
+		}
+
+		want := boardOf(&g.model)
+		want.place(n.shape(), n.pos())
+		cleared := want.clear()
+
+		rows := g.rows
+		g.currShape = n.shape()
+		g.moveTo(&Moving{g.pos, n.pos()})
+		g.lockShape()
+		if b := boardOf(&g.model); b != want {
+			t.Fatalf("shape %d at %+v: board %v, want %v", n.id, n.pos(), b, want)
+		}
+		if int(g.rows-rows) != cleared {
+			t.Fatalf("cleared %d rows, want %d", g.rows-rows, cleared)
+		}
+	}
+}
+
+func BenchmarkFitsGrid(b *testing.B) {
+	g := NewGame()
+	g.model = randomModel(rand.New(rand.NewSource(1)), ROW/2)
+	s := shapes[len(shapes)-1]
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		pos := Point{i % COL, i % ROW}
+		mv, err := checkMoving(s.area(pos), pos, pos)
+		g.canMoveShape(s, err, mv)
+	}
+}
+
+func BenchmarkFitsBitboard(b *testing.B) {
+	m := randomModel(rand.New(rand.NewSource(1)), ROW/2)
+	board := boardOf(&m)
+	s := shapes[len(shapes)-1]
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		board.fits(s, Point{i % COL, i % ROW})
+	}
+}
+
+func BenchmarkClearGrid(b *testing.B) {
+	m := randomModel(rand.New(rand.NewSource(1)), ROW/2)
+	for i := 0; i < b.N; i++ {
+		c := m
+		gridClear(&c)
+		gridHeights(&c)
+	}
+}
+
+func BenchmarkClearBitboard(b *testing.B) {
+	m := randomModel(rand.New(rand.NewSource(1)), ROW/2)
+	board := boardOf(&m)
+	for i := 0; i < b.N; i++ {
+		c := board
+		c.clear()
+		c.heights()
+	}
+}
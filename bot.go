@@ -0,0 +1,378 @@
+package tetris
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"time"
+)
+
+const (
+	BOT_PROTOCOL_VERSION = 1
+
+	BOT_PREVIEWS       = 5 // shapes in the queue after the current one
+	BOT_HANDSHAKE_TIME = time.Second * 5
+	DEFAULT_THINK_TIME = time.Second // to suggest the moves of a shape
+)
+
+// Message types of the bot protocol, one JSON object per line.
+// The bot starts with info, and answers rules with ready, and suggest
+// with suggestion; the others need no answer
+const (
+	BOT_INFO       = "info"       // bot: name, version & author
+	BOT_RULES      = "rules"      // size of the board & the shapes
+	BOT_READY      = "ready"      // bot: ready for games
+	BOT_START      = "start"      // a game starts: board, queue & hold
+	BOT_NEW_PIECE  = "new_piece"  // a shape added to the end of the queue
+	BOT_SUGGEST    = "suggest"    // asks for the moves of the current shape
+	BOT_SUGGESTION = "suggestion" // bot: moves, the first legal one is played
+	BOT_PLAY       = "play"       // the move played
+	BOT_STOP       = "stop"       // the game is over: score & lines
+	BOT_QUIT       = "quit"       // the bot should exit
+)
+
+var (
+	ErrorBotExited  = errors.New("bot exited")
+	ErrorBotTimeout = errors.New("bot timed out")
+)
+
+type botMessage struct {
+	Type string `json:"type"`
+
+	Name    string `json:"name,omitempty"` // info
+	Version string `json:"version,omitempty"`
+	Author  string `json:"author,omitempty"`
+
+	Protocol int        `json:"protocol,omitempty"` // rules
+	Rows     int        `json:"rows,omitempty"`
+	Cols     int        `json:"cols,omitempty"`
+	Shapes   []botShape `json:"shapes,omitempty"`
+
+	Board *[ROW][COL]uint8 `json:"board,omitempty"` // start, rows from the top
+	Queue []int            `json:"queue,omitempty"` // the current shape first
+	Hold  *int             `json:"hold,omitempty"`  // none if absent
+
+	Piece *int `json:"piece,omitempty"` // new_piece
+
+	Moves []botMove `json:"moves,omitempty"` // suggestion, the best first
+	Move  *botMove  `json:"move,omitempty"`  // play
+
+	Score uint64 `json:"score,omitempty"` // stop
+	Lines uint   `json:"lines,omitempty"`
+}
+
+// A shape and its rotations, the cells are {x, y} in the box of the shape
+type botShape struct {
+	Id    int      `json:"id"`
+	Cells [][2]int `json:"cells"`
+	Next  int      `json:"next"` // turned counterclockwise on the screen
+	Prev  int      `json:"prev"` // turned clockwise
+}
+
+// Where the shape rests, as the box of it on the board; with hold,
+// the shape is the one after hold
+type botMove struct {
+	Shape int  `json:"shape"`
+	Left  int  `json:"left"`
+	Top   int  `json:"top"`
+	Hold  bool `json:"hold,omitempty"`
+}
+
+func botShapes() []botShape {
+	var r []botShape
+	for _, s := range shapes {
+		b := botShape{Id: s.id, Next: s.next, Prev: s.prev}
+		for y := 0; y < SHAPE_SIZE; y++ {
+			for x := 0; x < SHAPE_SIZE; x++ {
+				if s.data[y][x] > 0 {
+					b.Cells = append(b.Cells, [2]int{x, y})
+				}
+			}
+		}
+		r = append(r, b)
+	}
+	return r
+}
+
+// Plays games by an external bot, checking the time it takes
+// and whether its moves are legal
+type botBridge struct {
+	g     *Game
+	enc   *json.Encoder
+	recv  chan *botMessage // closed when the bot exits
+	think time.Duration
+	info  *botMessage
+
+	known    int // shapes of the queue known by the bot
+	timeouts int // of the game
+	illegal  int // suggestions of no legal move, of the game
+}
+
+func newBotBridge(r io.Reader, w io.Writer, think time.Duration) *botBridge {
+	b := &botBridge{
+		enc:   json.NewEncoder(w),
+		recv:  make(chan *botMessage, INPUT_QUEUE_SIZE),
+		think: think,
+	}
+	go b.read(r)
+	return b
+}
+
+func (b *botBridge) read(r io.Reader) {
+	defer close(b.recv)
+
+	dec := json.NewDecoder(r)
+	for {
+		m := new(botMessage)
+		if err := dec.Decode(m); err != nil {
+			if err != io.EOF {
+				log.Println("[bot] read:", err)
+			}
+			return
+		}
+		b.recv <- m
+	}
+}
+
+func (b *botBridge) send(m *botMessage) error {
+	return b.enc.Encode(m)
+}
+
+// Wait for a message of type t within d, the others are dropped
+func (b *botBridge) wait(t string, d time.Duration) (*botMessage, error) {
+	timeout := time.After(d)
+	for {
+		select {
+		case m, ok := <-b.recv:
+			if !ok {
+				return nil, ErrorBotExited
+			}
+			if m.Type == t {
+				return m, nil
+			}
+			log.Printf("[bot] unexpected %q, want %q", m.Type, t)
+		case <-timeout:
+			return nil, ErrorBotTimeout
+		}
+	}
+}
+
+// Drop the messages received, e.g. a suggestion too late
+func (b *botBridge) drain() {
+	for {
+		select {
+		case m, ok := <-b.recv:
+			if !ok {
+				return
+			}
+			log.Printf("[bot] drop %q", m.Type)
+		default:
+			return
+		}
+	}
+}
+
+// Info from the bot, the rules to it, then wait for it to be ready
+func (b *botBridge) handshake() error {
+	info, err := b.wait(BOT_INFO, BOT_HANDSHAKE_TIME)
+	if err != nil {
+		return err
+	}
+	b.info = info
+	log.Printf("[bot] %s %s by %s", info.Name, info.Version, info.Author)
+
+	err = b.send(&botMessage{
+		Type:     BOT_RULES,
+		Protocol: BOT_PROTOCOL_VERSION,
+		Rows:     ROW,
+		Cols:     COL,
+		Shapes:   botShapes(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = b.wait(BOT_READY, BOT_HANDSHAKE_TIME)
+	return err
+}
+
+// Play a marathon of seed by the bot, up to pieces shapes locked
+func (b *botBridge) play(seed int64, pieces int) (aiResult, error) {
+	g := NewGame()
+	done := make(chan bool)
+	defer close(done)
+	go g.discardEvents(done)
+
+	b.g = g
+	g.stepped = true
+	g.setPreviews(BOT_PREVIEWS)
+	g.seed(seed)
+	g.start()
+
+	g.m.Lock()
+	start := &botMessage{Type: BOT_START, Board: &g.model, Queue: b.queue()}
+	if g.holdShape != nil {
+		start.Hold = &g.holdShape.id
+	}
+	err := b.send(start)
+	g.m.Unlock()
+
+	var r aiResult
+	over := false
+	b.known = BOT_PREVIEWS + 1
+	b.timeouts, b.illegal = 0, 0
+	for err == nil && r.pieces < pieces && !over {
+		b.drain()
+		if err = b.send(&botMessage{Type: BOT_SUGGEST}); err != nil {
+			break
+		}
+
+		var moves []botMove
+		m, werr := b.wait(BOT_SUGGESTION, b.think)
+		switch werr {
+		case nil:
+			moves = m.Moves
+		case ErrorBotTimeout:
+			b.timeouts++
+		default:
+			err = werr
+			continue
+		}
+
+		g.m.Lock()
+		move, revealed := b.playMove(moves)
+		queue := b.queue()
+		over = !g.state.active()
+		g.m.Unlock()
+		r.pieces++
+
+		if err = b.send(&botMessage{Type: BOT_PLAY, Move: &move}); err != nil {
+			break
+		}
+		b.known -= 1 + revealed
+		for ; err == nil && !over && b.known < len(queue); b.known++ {
+			err = b.send(&botMessage{Type: BOT_NEW_PIECE, Piece: &queue[b.known]})
+		}
+	}
+
+	g.m.Lock()
+	r.score = g.score
+	r.rows = g.rows
+	r.toppedOut = g.state == STATE_GAMEOVER
+	g.m.Unlock()
+	if err != nil {
+		return r, err
+	}
+	return r, b.send(&botMessage{Type: BOT_STOP, Score: r.score, Lines: r.rows})
+}
+
+// Ids of the current shape & the queue, the caller should hold g.m
+func (b *botBridge) queue() []int {
+	return append([]int{b.g.currShape.id}, shapeIds(b.g.queue)...)
+}
+
+// Play the first legal one of the moves, or hard drop where the shape
+// is if none; returns the move played and the number of shapes taken
+// from the queue by hold. The caller should hold g.m
+func (b *botBridge) playMove(moves []botMove) (botMove, int) {
+	g := b.g
+	for _, mv := range moves {
+		s, pos := g.currShape, g.pos
+		if mv.Hold {
+			if g.held {
+				continue
+			}
+			if s = g.holdShape; s == nil {
+				s = g.queue[0]
+			}
+			pos = spawnPoint(s)
+		}
+		n := aiNode{mv.Shape, mv.Left, mv.Top}
+		if mv.Shape < 0 || mv.Shape >= len(shapes) || !g.search(s, pos).canRest(n) {
+			log.Printf("[bot] illegal move %+v", mv)
+			continue
+		}
+
+		revealed := 0
+		if mv.Hold {
+			if g.holdShape == nil {
+				revealed = 1
+			}
+			g.swapHold()
+			if !g.state.active() {
+				return mv, revealed // blocked out
+			}
+		}
+		g.currShape = n.shape()
+		g.moveTo(&Moving{g.pos, n.pos()})
+		g.lockShape()
+		return mv, revealed
+	}
+
+	if len(moves) > 0 {
+		b.illegal++
+	}
+	g.dropDown()
+	move := botMove{Shape: g.currShape.id, Left: g.pos.left, Top: g.pos.top}
+	g.lockShape()
+	return move, 0
+}
+
+// The bot command, plays headless games by a bot program speaking
+// the bot protocol over its stdin & stdout, or over ours if no program
+func RunBot(args []string) error {
+	flags := flag.NewFlagSet("bot", flag.ContinueOnError)
+	seed := flags.Int64("seed", 1, "seed of the first game, increased for the others")
+	games := flags.Int("games", 1, "number of games")
+	pieces := flags.Int("pieces", 1000, "max shapes per game")
+	think := flags.Duration("think", DEFAULT_THINK_TIME, "time to suggest the moves of a shape")
+	verbose := flags.Bool("v", false, "log the games")
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+
+	var r io.Reader = os.Stdin
+	var w io.Writer = os.Stdout
+	if flags.NArg() > 0 {
+		cmd := exec.Command(flags.Arg(0), flags.Args()[1:]...)
+		cmd.Stderr = os.Stderr
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return err
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return err
+		}
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+		defer cmd.Wait()
+		defer stdin.Close()
+		r, w = stdout, stdin
+	}
+
+	b := newBotBridge(r, w, *think)
+	if err := b.handshake(); err != nil {
+		return err
+	}
+	for i := 0; i < *games; i++ {
+		s := *seed + int64(i)
+		res, err := b.play(s, *pieces)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "seed %d: score %d, rows %d, pieces %d, topped out %v, timeouts %d, illegal %d\n",
+			s, res.score, res.rows, res.pieces, res.toppedOut, b.timeouts, b.illegal)
+	}
+	return b.send(&botMessage{Type: BOT_QUIT})
+}
@@ -0,0 +1,155 @@
+package tetris
+
+import (
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+)
+
+// A bot in process over pipes, suggest answers the suggestions or nil
+// for none. The bot checks that its queue follows the game
+func newPipeBot(t *testing.T, think time.Duration,
+	suggest func(b *botBridge, queue []int, hold *int) *botMessage) (*botBridge, chan bool) {
+	toBot, fromBridge := io.Pipe()
+	fromBot, toBridge := io.Pipe()
+	b := newBotBridge(fromBot, fromBridge, think)
+	quit := make(chan bool)
+
+	go func() {
+		defer close(quit)
+		defer toBridge.Close()
+		enc, dec := json.NewEncoder(toBridge), json.NewDecoder(toBot)
+		enc.Encode(&botMessage{Type: BOT_INFO, Name: "pipe", Version: "1", Author: "test"})
+
+		var queue []int
+		var hold *int
+		for {
+			var m botMessage
+			if err := dec.Decode(&m); err != nil {
+				t.Error("bot read:", err)
+				return
+			}
+			switch m.Type {
+			case BOT_RULES:
+				if m.Protocol != BOT_PROTOCOL_VERSION || len(m.Shapes) != len(shapes) {
+					t.Errorf("rules: protocol %d, %d shapes", m.Protocol, len(m.Shapes))
+				}
+				enc.Encode(&botMessage{Type: BOT_READY})
+			case BOT_START:
+				queue, hold = m.Queue, m.Hold
+			case BOT_NEW_PIECE:
+				queue = append(queue, *m.Piece)
+			case BOT_SUGGEST:
+				b.g.m.Lock()
+				want := b.queue()
+				b.g.m.Unlock()
+				if !equalInts(queue, want) {
+					t.Errorf("bot queue %v, want %v", queue, want)
+				}
+				if r := suggest(b, queue, hold); r != nil {
+					enc.Encode(r)
+				}
+			case BOT_PLAY:
+				if m.Move.Hold {
+					if hold == nil {
+						hold, queue = &queue[0], queue[1:]
+					} else {
+						h := queue[0]
+						queue[0], hold = *hold, &h
+					}
+				}
+				queue = queue[1:]
+			case BOT_QUIT:
+				return
+			}
+		}
+	}()
+
+	if err := b.handshake(); err != nil {
+		t.Fatal("handshake:", err)
+	}
+	if b.info.Name != "pipe" {
+		t.Errorf("bot name %q", b.info.Name)
+	}
+	return b, quit
+}
+
+func TestBotBridge(t *testing.T) {
+	n := 0
+	b, quit := newPipeBot(t, time.Second, func(b *botBridge, queue []int, hold *int) *botMessage {
+		g := b.g
+		g.m.Lock()
+		defer g.m.Unlock()
+
+		n++
+		illegal := botMove{Shape: len(shapes)}
+		if n%3 == 0 { // hold, then the first resting position
+			s := shapes[queue[1]]
+			if hold != nil {
+				s = shapes[*hold]
+			}
+			r := g.search(s, spawnPoint(s))
+			m := r.resting[len(r.resting)-1]
+			return &botMessage{Type: BOT_SUGGESTION, Moves: []botMove{illegal, {m.id, m.left, m.top, true}}}
+		}
+		best := g.plan(defaultWeights())
+		return &botMessage{Type: BOT_SUGGESTION, Moves: []botMove{
+			illegal, {best.shape.id, best.pos.left, best.pos.top, false}}}
+	})
+
+	r, err := b.play(11, 150)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.pieces == 0 || r.rows == 0 {
+		t.Errorf("result %+v", r)
+	}
+	if b.timeouts != 0 || b.illegal != 0 {
+		t.Errorf("timeouts %d, illegal %d", b.timeouts, b.illegal)
+	}
+	b.send(&botMessage{Type: BOT_QUIT})
+	<-quit
+}
+
+func TestBotTimeout(t *testing.T) {
+	b, quit := newPipeBot(t, 5*time.Millisecond, func(*botBridge, []int, *int) *botMessage {
+		return nil
+	})
+
+	r, err := b.play(1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.timeouts != r.pieces {
+		t.Errorf("timeouts %d of %d shapes", b.timeouts, r.pieces)
+	}
+	b.send(&botMessage{Type: BOT_QUIT})
+	<-quit
+}
+
+// A hold into a shape blocked out where it enters tops out, without
+// locking the shape after the game is over
+func TestBotHoldBlockedOut(t *testing.T) {
+	g := newHeadlessGame()
+	g.stepped = true
+	g.start()
+	b := &botBridge{g: g}
+
+	g.m.Lock()
+	defer g.m.Unlock()
+	g.holdShape = shapes[53]
+	g.model[1][6] = CELL_GARBAGE // in the O where it enters, not a column left
+	mv := botMove{Shape: 53, Left: 3, Top: ROW - 2, Hold: true}
+	if !g.search(shapes[53], spawnPoint(shapes[53])).canRest(aiNode{mv.Shape, mv.Left, mv.Top}) {
+		t.Fatalf("%+v not legal", mv)
+	}
+
+	played, _ := b.playMove([]botMove{mv})
+	if played != mv || g.state != STATE_GAMEOVER {
+		t.Fatalf("played %+v, state %s", played, g.state)
+	}
+	if g.stats.placed() != 0 || g.model[ROW-1][4] != 0 {
+		t.Errorf("locked after topped out: %d placed", g.stats.placed())
+	}
+}
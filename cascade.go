@@ -0,0 +1,135 @@
+package tetris
+
+import "log"
+
+// Let the groups of blocks connected fall apart until they land, clearing
+// the rows filled in chains: the n-th chain scores n+1 times of the rows.
+// Returns the chains, the caller should hold g.m
+func (g *Game) cascade() int {
+	chains := 0
+	for g.settle() {
+		rows := g.fullRows()
+		if len(rows) == 0 {
+			break
+		}
+		chains++
+		for _, k := range rows {
+			g.hilighRow(k)
+			g.model[k] = [COL]uint8{}
+		}
+		g.emit(EVENT_CLEAR, rows...)
+
+		n := len(rows)
+		if n > SHAPE_SIZE {
+			n = SHAPE_SIZE
+		}
+		newScore := uint64(earnScore(n, g.level) * (chains + 1))
+		g.rows += uint(len(rows))
+		g.score += newScore
+		g.chanScore <- g.score
+		g.emit(EVENT_SCORE)
+		g.stats.clear(len(rows), false) // a perfect clear is of the piece locked
+		log.Printf("[cascade] chain %d rows=%d(+%d) score=%d(+%d)", chains, g.rows, len(rows), g.score, newScore)
+		g.levelUp()
+	}
+	g.updateTop()
+	g.chanRedraw <- &Area{y: 0, y2: ROW - 1}
+	return chains
+}
+
+// Drop the groups of blocks connected by sides, one row at a time, until
+// none can fall. Returns true if any fell
+func (g *Game) settle() bool {
+	m := &g.model
+	var group [ROW][COL]int // 1 based, 0 if empty
+	var groups [][]Point
+	for i := 0; i < ROW; i++ {
+		for j := 0; j < COL; j++ {
+			if m[i][j] > 0 && group[i][j] == 0 {
+				groups = append(groups, fillGroup(m, &group, Point{j, i}, len(groups)+1))
+			}
+		}
+	}
+
+	fell := false
+	for moved := true; moved; {
+		moved = false
+		for n, cells := range groups {
+			if !canFall(m, &group, cells, n+1) {
+				continue
+			}
+			values := make([]uint8, len(cells))
+			for k, c := range cells {
+				values[k] = m[c.top][c.left]
+				m[c.top][c.left] = 0
+				group[c.top][c.left] = 0
+			}
+			for k := range cells {
+				cells[k].top++
+				m[cells[k].top][cells[k].left] = values[k]
+				group[cells[k].top][cells[k].left] = n + 1
+			}
+			moved, fell = true, true
+		}
+	}
+	return fell
+}
+
+// The cells connected to p, labelled as n
+func fillGroup(m *[ROW][COL]uint8, group *[ROW][COL]int, p Point, n int) []Point {
+	var cells []Point
+	stack := []Point{p}
+	group[p.top][p.left] = n
+	for len(stack) > 0 {
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		cells = append(cells, c)
+		for _, d := range []Point{{-1, 0}, {1, 0}, {0, -1}, {0, 1}} {
+			i, j := c.top+d.top, c.left+d.left
+			if i >= 0 && i < ROW && j >= 0 && j < COL && m[i][j] > 0 && group[i][j] == 0 {
+				group[i][j] = n
+				stack = append(stack, Point{j, i})
+			}
+		}
+	}
+	return cells
+}
+
+// Returns true if the group n can fall a row
+func canFall(m *[ROW][COL]uint8, group *[ROW][COL]int, cells []Point, n int) bool {
+	for _, c := range cells {
+		i := c.top + 1
+		if i >= ROW || m[i][c.left] > 0 && group[i][c.left] != n {
+			return false
+		}
+	}
+	return true
+}
+
+// Rows filled, from the bottom
+func (g *Game) fullRows() []int {
+	var rows []int
+	for i := ROW - 1; i >= 0; i-- {
+		full := true
+		for _, c := range g.model[i] {
+			if c == 0 {
+				full = false
+				break
+			}
+		}
+		if full {
+			rows = append(rows, i)
+		}
+	}
+	return rows
+}
+
+// Set the water level to the top row of blocks, after rows emptied
+func (g *Game) updateTop() {
+	g.waterLevel = ROW
+	for i := ROW - 1; i >= 0; i-- {
+		if g.model[i] != [COL]uint8{} {
+			g.waterLevel = i
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package tetris
+
+import "testing"
+
+// Clearing the 2nd & 4th rows from the bottom drops the blocks left apart,
+// filling the bottom row in a chain
+func TestCascade(t *testing.T) {
+	n, err := parseNotation("current: 16\npos: 9 0\nboard:\nXXX........\nXXXXXXXXXX.\n...XXXXXXX.\nXXXXXXXXXX.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := newHeadlessGame()
+	g.setMode(MODE_CASCADE)
+	g.stepped = true
+	g.start()
+	if err := g.loadNotation(n); err != nil {
+		t.Fatal(err)
+	}
+	g.step(nil)
+	g.step([]inputEvent{{CTRL_HARD_DROP, true}})
+
+	g.m.Lock()
+	defer g.m.Unlock()
+	want := uint64(earnScore(2, 0) + 2*earnScore(1, 0))
+	if g.rows != 3 || g.score != want {
+		t.Errorf("rows %d, score %d; want 3, %d", g.rows, g.score, want)
+	}
+	if g.waterLevel != ROW-1 || g.model[ROW-1][COL-1] == 0 || g.holes() != 0 {
+		t.Errorf("water level %d, board %v", g.waterLevel, g.model[ROW-2:])
+	}
+	if g.stats.Clears != [SHAPE_SIZE]int{1, 1} {
+		t.Errorf("clears %v", g.stats.Clears)
+	}
+}
+
+// The rows of the chains count for the level, scored at the level reached
+func TestCascadeLevels(t *testing.T) {
+	n, err := parseNotation("current: 16\npos: 9 0\nboard:\nXXX........\nXXXXXXXXXX.\n...XXXXXXX.\nXXXXXXXXXX.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := newHeadlessGame()
+	g.setMode(MODE_CASCADE)
+	levels := DefaultLevelCurve()
+	levels.Lines = 1
+	if err := g.setLevels(levels, 0); err != nil {
+		t.Fatal(err)
+	}
+	g.stepped = true
+	g.start()
+	if err := g.loadNotation(n); err != nil {
+		t.Fatal(err)
+	}
+	g.step(nil)
+	g.step([]inputEvent{{CTRL_HARD_DROP, true}})
+
+	g.m.Lock()
+	defer g.m.Unlock()
+	want := uint64(earnScore(2, 0) + 2*earnScore(1, 2))
+	if g.level != 3 || g.score != want {
+		t.Errorf("level %d, score %d; want 3, %d", g.level, g.score, want)
+	}
+	if r := g.currentStats(); r.Clears != [SHAPE_SIZE]int{1, 1} || r.Level != 3 {
+		t.Errorf("stats clears %v, level %d", r.Clears, r.Level)
+	}
+}
+
+func TestSettle(t *testing.T) {
+	g := newHeadlessGame()
+	// an overhang falls as a whole, held by its lowest block
+	g.model[ROW-4] = [COL]uint8{1, 1, 1}
+	g.model[ROW-3] = [COL]uint8{0, 0, 1}
+	g.model[ROW-1] = [COL]uint8{0, 0, 0, 1}
+	if !g.settle() {
+		t.Fatal("nothing fell")
+	}
+	if g.model[ROW-2] != [COL]uint8{1, 1, 1} || g.model[ROW-1] != [COL]uint8{0, 0, 1, 1} {
+		t.Errorf("settled as %v", g.model[ROW-4:])
+	}
+	if g.settle() {
+		t.Error("fell again")
+	}
+}
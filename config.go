@@ -0,0 +1,127 @@
+package tetris
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// Config holds the user preferences, persisted as JSON
+// at $XDG_CONFIG_HOME/tetris/config.json (or the OS equivalent)
+type Config struct {
+	Keys     *KeyBindings `json:"keys"`
+	Handling Handling     `json:"handling"`
+	Previews int          `json:"previews"` // number of next shapes shown
+
+	Levels     LevelCurve `json:"levels"`      // level ups & gravity
+	StartLevel int        `json:"start_level"` // of new games
+
+	AutoPause bool `json:"auto_pause"` // pause when the window loses focus or is minimised
+
+	Garbage GarbagePattern `json:"garbage"`  // hole pattern of garbage rows
+	DigRows int            `json:"dig_rows"` // garbage rows at start of dig mode
+
+	FadeFrames int `json:"fade_frames"` // for the blocks locked to fade out in fading mode
+
+	VersusKeys   [2]*KeyBindings `json:"versus_keys"`
+	VersusRounds int             `json:"versus_rounds"` // best of
+
+	NetAddress string `json:"net_address"` // last hosted or joined
+	Lockstep   bool   `json:"lockstep"`    // hosted matches in lockstep
+	InputDelay int    `json:"input_delay"` // frames, in lockstep
+
+	SpectatorPort   int    `json:"spectator_port"`   // serve the game to spectators, 0 = off
+	SpectateAddress string `json:"spectate_address"` // last watched
+
+	AIWeights string `json:"ai_weights"` // JSON file of the weights of the demo, the defaults if empty
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		Keys:     DefaultKeyBindings(),
+		Handling: DefaultHandling(),
+		Previews: 3,
+		Garbage:  GARBAGE_CHEESE,
+		DigRows:  10,
+
+		Levels: DefaultLevelCurve(),
+
+		VersusKeys:   DefaultVersusKeyBindings(),
+		VersusRounds: 3,
+
+		NetAddress: DEFAULT_NET_ADDRESS,
+		Lockstep:   true,
+		InputDelay: DEFAULT_INPUT_DELAY,
+
+		SpectateAddress: fmt.Sprintf("localhost:%d", DEFAULT_SPECTATOR_PORT),
+
+		AutoPause: true,
+
+		FadeFrames: DEFAULT_FADE_FRAMES,
+	}
+}
+
+func configPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "tetris", "config.json"), nil
+}
+
+// Load the config file, falls back to defaults on any error
+func LoadConfig() *Config {
+	c := DefaultConfig()
+
+	path, err := configPath()
+	if err != nil {
+		log.Println("could not locate config:", err)
+		return c
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Println("could not read config:", err)
+		}
+		return c
+	}
+
+	if err := json.Unmarshal(data, c); err != nil {
+		log.Printf("could not parse config %s: %v", path, err)
+		return DefaultConfig()
+	}
+	if err := c.Levels.validate(); err != nil {
+		log.Printf("config %s: %v, the default levels used", path, err)
+		c.Levels = DefaultLevelCurve()
+	}
+	if c.Keys == nil {
+		c.Keys = DefaultKeyBindings()
+	}
+	for i, keys := range DefaultVersusKeyBindings() {
+		if c.VersusKeys[i] == nil {
+			c.VersusKeys[i] = keys
+		}
+	}
+	return c
+}
+
+func (c *Config) Save() error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	log.Println("save config to", path)
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,106 @@
+package tetris
+
+import "log"
+
+const (
+	DEFAULT_FADE_FRAMES = 5 * FPS // for the blocks locked to fade out
+	FADE_STEPS          = 8       // of the fading shown, redrawn at each
+	REVEAL_FRAMES       = FPS     // the stack is shown after a clear
+)
+
+// Visibility of the blocks locked in the fading & invisible modes, the
+// model is kept as it is
+type fading struct {
+	frames int           // for a block to fade out in fading mode
+	clock  int           // frames played
+	locked [ROW][COL]int // clock of each block when locked
+	reveal int           // clock until the stack is shown
+}
+
+// Returns true if the mode hides the blocks locked
+func (m Mode) hidesStack() bool {
+	return m == MODE_FADING || m == MODE_INVISIBLE
+}
+
+// Frames for the blocks locked to fade out in fading mode
+func (g *Game) setFadeFrames(frames int) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	if frames <= 0 {
+		log.Printf("fade frames %d, should be positive", frames)
+		return
+	}
+	g.fading.frames = frames
+}
+
+// Frames between the steps of fading
+func (f *fading) interval() int {
+	if n := f.frames / FADE_STEPS; n > 1 {
+		return n
+	}
+	return 1
+}
+
+// Visibility of the block at row i & column j, from 0 (hidden) to 1. All
+// shown unless hidden by the mode, and when the game is over
+func (g *Game) visibility(i, j int) float64 {
+	f := &g.fading
+	if !g.mode.hidesStack() || g.state.over() || f.clock < f.reveal {
+		return 1
+	}
+	if g.mode == MODE_INVISIBLE {
+		return 0
+	}
+
+	// by the step of the clock, to be redrawn at each
+	age := f.clock - f.clock%f.interval() - f.locked[i][j]
+	switch {
+	case age <= 0:
+		return 1
+	case age >= f.frames:
+		return 0
+	}
+	return 1 - float64(age)/float64(f.frames)
+}
+
+// Tick the clock, redrawing the stack when its visibility changes; the
+// caller should hold g.m
+func (g *Game) fade() {
+	if !g.mode.hidesStack() {
+		return
+	}
+	f := &g.fading
+	f.clock++
+	if f.clock == f.reveal || g.mode == MODE_FADING && f.clock%f.interval() == 0 {
+		g.chanRedraw <- &Area{y: g.waterLevel, y2: ROW - 1}
+		g.chanMoving <- &Moving{InvalidPoint, g.pos}
+	}
+}
+
+// Stamp the blocks of the shape locked, and hide them by the mode; the
+// caller should hold g.m
+func (g *Game) stampShape() {
+	p := g.pos
+	b := g.currShape.bounds()
+	d := &g.currShape.data
+	for i := b.x; i <= b.x2; i++ {
+		for j := b.y; j <= b.y2; j++ {
+			if d[j][i] > 0 {
+				g.fading.locked[p.top+j][p.left+i] = g.fading.clock
+			}
+		}
+	}
+	if g.mode == MODE_INVISIBLE {
+		g.chanRedraw <- &Area{y: p.top + b.y, y2: p.top + b.y2}
+	}
+}
+
+// Show the stack for a while after a clear, the caller should hold g.m
+func (g *Game) revealStack() {
+	if !g.mode.hidesStack() {
+		return
+	}
+	g.fading.reveal = g.fading.clock + REVEAL_FRAMES
+	g.chanRedraw <- &Area{y: g.waterLevel, y2: ROW - 1}
+}
@@ -0,0 +1,98 @@
+package tetris
+
+import "testing"
+
+// Lock a shape by hard drop, returns the row & column of a block of it
+func lockByHardDrop(t *testing.T, g *Game) (int, int) {
+	g.step(nil)
+	g.step([]inputEvent{{CTRL_HARD_DROP, true}})
+	g.step([]inputEvent{{CTRL_HARD_DROP, false}})
+
+	g.m.Lock()
+	defer g.m.Unlock()
+	for i := ROW - 1; i >= 0; i-- {
+		for j := 0; j < COL; j++ {
+			if g.model[i][j] > 0 {
+				return i, j
+			}
+		}
+	}
+	t.Fatal("no blocks locked")
+	return 0, 0
+}
+
+func TestFading(t *testing.T) {
+	g := newHeadlessGame()
+	g.setMode(MODE_FADING)
+	g.setFadeFrames(FADE_STEPS * 4)
+	g.stepped = true
+	g.start()
+	i, j := lockByHardDrop(t, g)
+
+	visibility := func() float64 {
+		g.m.Lock()
+		defer g.m.Unlock()
+		return g.visibility(i, j)
+	}
+	if v := visibility(); v != 1 {
+		t.Errorf("visibility %v when locked", v)
+	}
+	for k := 0; k < FADE_STEPS*2; k++ {
+		g.step(nil)
+	}
+	if v := visibility(); v <= 0 || v >= 1 {
+		t.Errorf("visibility %v half way", v)
+	}
+	for k := 0; k < FADE_STEPS*3; k++ { // and a step
+		g.step(nil)
+	}
+	if v := visibility(); v != 0 {
+		t.Errorf("visibility %v faded out", v)
+	}
+
+	g.m.Lock()
+	g.changeState(STATE_GAMEOVER)
+	g.m.Unlock()
+	if v := visibility(); v != 1 {
+		t.Errorf("visibility %v when over", v)
+	}
+}
+
+// Hidden at once, shown for a while after a clear
+func TestInvisible(t *testing.T) {
+	n, err := parseNotation("current: 16\npos: 9 0\nboard:\nXXXXXXXXXX.\nXXXXXXXXXX.\nXXXXXXXXXX.\nXXXXXXXXXX.\n.XXXXXXXXXX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := newHeadlessGame()
+	g.setMode(MODE_INVISIBLE)
+	g.stepped = true
+	g.start()
+	if err := g.loadNotation(n); err != nil {
+		t.Fatal(err)
+	}
+	g.m.Lock()
+	g.fading.locked[ROW-1][1] = 7 // shifted down by clears
+	g.m.Unlock()
+
+	g.step(nil)
+	g.step([]inputEvent{{CTRL_HARD_DROP, true}})
+
+	g.m.Lock()
+	if g.rows != 4 || g.visibility(ROW-1, 1) != 1 {
+		t.Errorf("rows %d, visibility %v after a clear", g.rows, g.visibility(ROW-1, 1))
+	}
+	if g.fading.locked[ROW-1][1] != 7 {
+		t.Errorf("stamps not kept by the clear: %v", g.fading.locked[ROW-1])
+	}
+	g.m.Unlock()
+
+	for k := 0; k < REVEAL_FRAMES; k++ {
+		g.step(nil)
+	}
+	g.m.Lock()
+	defer g.m.Unlock()
+	if v := g.visibility(ROW-1, 1); v != 0 {
+		t.Errorf("visibility %v after the reveal", v)
+	}
+}
@@ -0,0 +1,128 @@
+package tetris
+
+import (
+	"fmt"
+	"log"
+)
+
+// Finesse of a game: the keys pressed to place each shape,
+// against the fewest needed from where it landed
+type finesse struct {
+	pieces  int // judged
+	faults  int // placed by more presses than needed
+	presses int // of all pieces
+	needed  int
+	last    int // presses of the last piece
+	lastMin int // needed by the last piece
+
+	spawn aiNode // where the current shape landed
+}
+
+// Moves & rotations, the hard drop and hold are not counted
+func finesseControl(c Control) bool {
+	switch c {
+	case CTRL_LEFT, CTRL_RIGHT, CTRL_ROTATE, CTRL_ROTATE_CCW, CTRL_ROTATE_180, CTRL_SOFT_DROP:
+		return true
+	}
+	return false
+}
+
+// Judge the presses of the shape to lock, the caller should hold g.m
+func (g *Game) judgeFinesse() {
+	f := &g.finesse
+	board := boardOf(&g.model)
+	need := minPresses(&board, f.spawn, aiNode{g.currShape.id, g.pos.left, g.pos.top})
+	if need < 0 {
+		return // e.g. slid in by gravity
+	}
+
+	presses := g.input.presses
+	f.pieces++
+	f.presses += presses
+	f.needed += need
+	f.last, f.lastMin = presses, need
+	if presses > need {
+		f.faults++
+		log.Printf("[finesse] fault: %d presses, %d needed", presses, need)
+	}
+	g.chanFinesse <- *f
+}
+
+// Report of the finesse after game over
+func (f *finesse) report() string {
+	accuracy := 100.0
+	if f.pieces > 0 {
+		accuracy = 100 * float64(f.pieces-f.faults) / float64(f.pieces)
+	}
+	return fmt.Sprintf("Judged pieces: %d\nFaults: %d\nAccuracy: %.1f%%\nKeys pressed: %d, needed %d (+%d)",
+		f.pieces, f.faults, accuracy, f.presses, f.needed, f.presses-f.needed)
+}
+
+// Fewest presses to place a shape from spawn where target is, ended by
+// a hard drop; a held shift to the wall is a single press. -1 if none
+func minPresses(board *bitboard, spawn, target aiNode) int {
+	var want bitboard
+	want.place(target.shape(), target.pos())
+
+	seen := map[aiNode]bool{spawn: true}
+	level := []aiNode{spawn}
+	for presses := 0; len(level) > 0; presses++ {
+		var next []aiNode
+		for _, n := range level {
+			var cells bitboard
+			cells.place(n.shape(), drop(board, n).pos())
+			if cells == want {
+				return presses
+			}
+
+			for _, m := range finesseMoves(board, n) {
+				if !seen[m] {
+					seen[m] = true
+					next = append(next, m)
+				}
+			}
+		}
+		level = next
+	}
+	return -1
+}
+
+// Positions after a single press from n
+func finesseMoves(board *bitboard, n aiNode) []aiNode {
+	var moves []aiNode
+	fits := func(m aiNode) bool {
+		return board.fits(m.shape(), m.pos())
+	}
+
+	for _, c := range []Control{CTRL_LEFT, CTRL_RIGHT} {
+		m := n.move(c)
+		if !fits(m) {
+			continue
+		}
+		moves = append(moves, m) // tap
+		for fits(m.move(c)) {
+			m = m.move(c)
+		}
+		moves = append(moves, m) // shift to the wall
+	}
+
+	r180 := aiNode{shapes[shapes[n.id].next].next, n.left, n.top}
+	for _, m := range []aiNode{n.move(CTRL_ROTATE), n.move(CTRL_ROTATE_CCW), r180} {
+		if fits(m) {
+			moves = append(moves, m)
+		}
+	}
+
+	if m := drop(board, n); m != n {
+		moves = append(moves, m) // soft drop to the bottom
+	}
+	return moves
+}
+
+// Where n rests when dropped
+func drop(board *bitboard, n aiNode) aiNode {
+	for board.fits(n.shape(), Point{n.left, n.top + 1}) {
+		n.top++
+	}
+	return n
+}
@@ -0,0 +1,13 @@
+package tetris
+
+import "fmt"
+
+// Running faults of the finesse mode, and of the last piece if a fault
+func (v *view) showFinesse(f finesse) {
+	v.finesse = &f
+	text := fmt.Sprintf("FAULTS %d / %d", f.faults, f.pieces)
+	if f.pieces > 0 && f.last > f.lastMin {
+		text += fmt.Sprintf("\n+%d keys", f.last-f.lastMin)
+	}
+	v.finesseLabel.SetMarkup(markup("#000", UNIT_SIZE/2, text))
+}
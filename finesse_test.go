@@ -0,0 +1,78 @@
+package tetris
+
+import "testing"
+
+func TestMinPresses(t *testing.T) {
+	var empty bitboard
+	overhang := empty
+	overhang[ROW-3] = 0x7 // columns 0-2 over 2 empty rows
+	sealed := empty
+	sealed[ROW-3] = FULL_ROW
+
+	o := shapes[53] // 2x2 at columns 1-2 of its box
+	spawn := aiNode{o.id, 4, 0}
+	bottom := ROW - 2
+	cases := []struct {
+		name   string
+		board  *bitboard
+		spawn  aiNode
+		target aiNode
+		want   int
+	}{
+		{"in place", &empty, spawn, aiNode{o.id, 4, bottom}, 0},
+		{"tap", &empty, spawn, aiNode{o.id, 3, bottom}, 1},
+		{"two taps", &empty, spawn, aiNode{o.id, 2, bottom}, 2},
+		{"left wall", &empty, spawn, aiNode{o.id, -1, bottom}, 1},
+		{"right wall", &empty, spawn, aiNode{o.id, 8, bottom}, 1},
+		{"wall & tap", &empty, spawn, aiNode{o.id, 7, bottom}, 2},
+		{"rotate", &empty, aiNode{1, 4, 0}, aiNode{2, 4, bottom}, 1},
+		{"rotate back", &empty, aiNode{1, 4, 0}, aiNode{1, 4, ROW - 1}, 0},
+		{"tuck", &overhang, spawn, aiNode{o.id, -1, bottom}, 2},
+		{"on the overhang", &overhang, spawn, aiNode{o.id, -1, ROW - 5}, 1},
+		{"sealed", &sealed, spawn, aiNode{o.id, -1, bottom}, -1},
+	}
+	for _, c := range cases {
+		if got := minPresses(c.board, c.spawn, c.target); got != c.want {
+			t.Errorf("%s: %d presses, want %d", c.name, got, c.want)
+		}
+	}
+}
+
+func TestFinesseFaults(t *testing.T) {
+	g := newHeadlessGame()
+	g.setMode(MODE_FINESSE)
+	g.stepped = true
+	g.seed(1)
+	g.start()
+
+	// left & back right, 2 presses for none
+	for _, events := range [][]inputEvent{
+		{{CTRL_LEFT, true}}, {{CTRL_LEFT, false}},
+		{{CTRL_RIGHT, true}}, {{CTRL_RIGHT, false}},
+		{{CTRL_HARD_DROP, true}}, {{CTRL_HARD_DROP, false}},
+	} {
+		g.step(events)
+	}
+	g.m.Lock()
+	f := g.finesse
+	g.m.Unlock()
+	if f.pieces != 1 || f.faults != 1 || f.last != 2 || f.lastMin != 0 {
+		t.Fatalf("finesse %+v, want a fault of 2 presses for none", f)
+	}
+
+	for g.step(nil) {
+		g.m.Lock()
+		entering := g.entry > 0
+		g.m.Unlock()
+		if !entering {
+			break
+		}
+	}
+	g.step([]inputEvent{{CTRL_HARD_DROP, true}})
+	g.m.Lock()
+	f = g.finesse
+	g.m.Unlock()
+	if f.pieces != 2 || f.faults != 1 || f.presses != 2 || f.needed != 0 {
+		t.Errorf("finesse %+v, want no more faults", f)
+	}
+}
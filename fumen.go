@@ -0,0 +1,847 @@
+package tetris
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// The fumen format of boards shared by the community, version 1.15:
+// pages of a 10 wide field and a piece placed, with comments
+const (
+	FUMEN_VERSION = "115@"
+	FUMEN_PREFIX  = "v" + FUMEN_VERSION
+
+	FUMEN_WIDTH  = 10
+	FUMEN_TOP    = 23                            // rows of the field, above the garbage row
+	FUMEN_BLOCKS = (FUMEN_TOP + 1) * FUMEN_WIDTH // cells, with the garbage row
+	FUMEN_TABLE  = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+	FUMEN_CHARS  = ` !"#$%&'()*+,-./0123456789:;<=>?@ABCDEFGHIJKLMNOPQRSTUVWXYZ[\]^_` + "`" + `abcdefghijklmnopqrstuvwxyz{|}~`
+
+	FUMEN_MAX_COMMENT = 4095
+	FUMEN_QUIZ        = "#Q=" // prefix of a quiz comment, e.g. #Q=[hold](current)next
+)
+
+// Pieces & cells of fumen, by value
+const (
+	FUMEN_EMPTY = iota
+	FUMEN_I
+	FUMEN_L
+	FUMEN_O
+	FUMEN_Z
+	FUMEN_T
+	FUMEN_J
+	FUMEN_S
+	FUMEN_GRAY
+)
+
+const fumenLetters = " ILOZTJS"
+
+// Rotations of fumen, by value
+const (
+	FUMEN_REVERSE = iota
+	FUMEN_RIGHT
+	FUMEN_SPAWN
+	FUMEN_LEFT
+)
+
+var ErrorBadFumen = errors.New("bad fumen")
+
+// Cells of the pieces in spawn rotation around the center, y is up
+var fumenBlocks = [FUMEN_GRAY][4][2]int{
+	FUMEN_I: {{0, 0}, {-1, 0}, {1, 0}, {2, 0}},
+	FUMEN_L: {{0, 0}, {-1, 0}, {1, 0}, {1, 1}},
+	FUMEN_O: {{0, 0}, {1, 0}, {0, 1}, {1, 1}},
+	FUMEN_Z: {{0, 0}, {1, 0}, {0, 1}, {-1, 1}},
+	FUMEN_T: {{0, 0}, {-1, 0}, {1, 0}, {0, 1}},
+	FUMEN_J: {{0, 0}, {-1, 0}, {1, 0}, {-1, 1}},
+	FUMEN_S: {{0, 0}, {-1, 0}, {0, 1}, {1, 1}},
+}
+
+// A piece placed on a page, at its center; y is up from the bottom row
+type fumenPiece struct {
+	kind     int // FUMEN_EMPTY if none
+	rotation int
+	x, y     int
+}
+
+// Cells of the piece
+func (p fumenPiece) cells() [4][2]int {
+	cells := fumenBlocks[p.kind]
+	for i, c := range cells {
+		x, y := c[0], c[1]
+		switch p.rotation {
+		case FUMEN_RIGHT:
+			x, y = y, -x
+		case FUMEN_REVERSE:
+			x, y = -x, -y
+		case FUMEN_LEFT:
+			x, y = -y, x
+		}
+		cells[i] = [2]int{p.x + x, p.y + y}
+	}
+	return cells
+}
+
+// Fumen keeps the position of some rotations off the center by a cell
+func (p fumenPiece) offset() (dx, dy int) {
+	switch {
+	case p.kind == FUMEN_O && p.rotation == FUMEN_LEFT:
+		return 1, -1
+	case p.kind == FUMEN_O && p.rotation == FUMEN_REVERSE,
+		p.kind == FUMEN_I && p.rotation == FUMEN_REVERSE,
+		p.kind == FUMEN_Z && p.rotation == FUMEN_LEFT:
+		return 1, 0
+	case p.kind == FUMEN_O && p.rotation == FUMEN_SPAWN,
+		p.kind == FUMEN_I && p.rotation == FUMEN_LEFT,
+		p.kind == FUMEN_S && p.rotation == FUMEN_SPAWN,
+		p.kind == FUMEN_Z && p.rotation == FUMEN_SPAWN:
+		return 0, -1
+	case p.kind == FUMEN_S && p.rotation == FUMEN_RIGHT:
+		return -1, 0
+	}
+	return 0, 0
+}
+
+// Field of a page, from the top left cell; the last row is the garbage row
+type fumenField [FUMEN_BLOCKS]uint8
+
+// Index of the cell at x & y, y is -1 for the garbage row
+func fumenIndex(x, y int) int {
+	return (FUMEN_TOP-1-y)*FUMEN_WIDTH + x
+}
+
+type fumenPage struct {
+	field   fumenField
+	piece   fumenPiece
+	comment string
+	lock    bool // the piece locks and the lines clear in the next page
+	rise    bool // then the garbage row rises
+	mirror  bool // then the field is mirrored
+}
+
+// Field of the next page
+func (p *fumenPage) next() (fumenField, error) {
+	f := p.field
+	if !p.lock {
+		return f, nil
+	}
+
+	if p.piece.kind != FUMEN_EMPTY {
+		for _, c := range p.piece.cells() {
+			if c[0] < 0 || c[0] >= FUMEN_WIDTH || c[1] < 0 || c[1] >= FUMEN_TOP {
+				return f, fmt.Errorf("%w: piece out of the field", ErrorBadFumen)
+			}
+			f[fumenIndex(c[0], c[1])] = uint8(p.piece.kind)
+		}
+	}
+	f.clearLines()
+	if p.rise {
+		copy(f[:], f[FUMEN_WIDTH:])
+		for x := 0; x < FUMEN_WIDTH; x++ {
+			f[fumenIndex(x, -1)] = FUMEN_EMPTY
+		}
+	}
+	if p.mirror {
+		for y := -1; y < FUMEN_TOP; y++ {
+			for x := 0; x < FUMEN_WIDTH/2; x++ {
+				i, j := fumenIndex(x, y), fumenIndex(FUMEN_WIDTH-1-x, y)
+				f[i], f[j] = f[j], f[i]
+			}
+		}
+	}
+	return f, nil
+}
+
+// Clear the full rows above the garbage row, returns the rows cleared
+func (f *fumenField) clearLines() int {
+	n := 0
+	for y := 0; y < FUMEN_TOP; y++ {
+		full := true
+		for x := 0; x < FUMEN_WIDTH; x++ {
+			full = full && f[fumenIndex(x, y)] != FUMEN_EMPTY
+		}
+		if !full {
+			continue
+		}
+
+		// the rows above fall
+		top := fumenIndex(0, FUMEN_TOP-1)
+		copy(f[top+FUMEN_WIDTH:fumenIndex(0, y)+FUMEN_WIDTH], f[top:fumenIndex(0, y)])
+		for x := 0; x < FUMEN_WIDTH; x++ {
+			f[top+x] = FUMEN_EMPTY
+		}
+		n++
+		y--
+	}
+	return n
+}
+
+// Returns true if text looks like a fumen, e.g. v115@vhAAgH or an URL of it
+func isFumen(text string) bool {
+	return strings.Contains(text, FUMEN_VERSION)
+}
+
+// Values of fumen chars, little endian by base 64
+type fumenReader struct {
+	data string
+	i    int
+	err  error
+}
+
+func (r *fumenReader) poll(n int) int {
+	v, unit := 0, 1
+	for k := 0; k < n; k++ {
+		c := -1
+		if r.i < len(r.data) {
+			c = strings.IndexByte(FUMEN_TABLE, r.data[r.i])
+		}
+		if c < 0 {
+			if r.err == nil {
+				r.err = fmt.Errorf("%w: unexpected end or char at %d", ErrorBadFumen, r.i)
+			}
+			return 0
+		}
+		v += c * unit
+		unit *= len(FUMEN_TABLE)
+		r.i++
+	}
+	return v
+}
+
+// Decode the pages of a fumen
+func decodeFumen(text string) ([]fumenPage, error) {
+	text = strings.TrimSpace(text)
+	i := strings.Index(text, FUMEN_VERSION)
+	if i < 1 || !strings.ContainsRune("vVmMdD", rune(text[i-1])) {
+		return nil, fmt.Errorf("%w: not of version %s", ErrorBadFumen, FUMEN_VERSION[:3])
+	}
+	data := text[i+len(FUMEN_VERSION):]
+	if j := strings.IndexAny(data, "#&"); j >= 0 {
+		data = data[:j] // the rest of an URL
+	}
+	r := &fumenReader{data: strings.Map(func(c rune) rune {
+		if c == '?' || strings.ContainsRune(" \t\r\n", c) {
+			return -1
+		}
+		return c
+	}, data)}
+
+	var pages []fumenPage
+	var field fumenField
+	repeat, comment := 0, ""
+	for r.i < len(r.data) && r.err == nil {
+		page := fumenPage{field: field}
+		if repeat > 0 {
+			repeat--
+		} else if !r.field(&page.field) {
+			repeat = r.poll(1)
+		}
+
+		v := r.poll(3)
+		page.piece.kind = v % 8
+		v /= 8
+		page.piece.rotation = v % 4
+		v /= 4
+		n := v % FUMEN_BLOCKS
+		v /= FUMEN_BLOCKS
+		page.rise = v%2 == 1
+		page.mirror = v/2%2 == 1
+		// v/4%2 is to colour the pieces
+		hasComment := v/8%2 == 1
+		page.lock = v/16%2 == 0
+
+		if page.piece.kind != FUMEN_EMPTY {
+			page.piece.x = n % FUMEN_WIDTH
+			page.piece.y = FUMEN_TOP - 1 - n/FUMEN_WIDTH
+			dx, dy := page.piece.offset()
+			page.piece.x += dx
+			page.piece.y += dy
+		}
+		if hasComment {
+			comment = r.comment()
+		}
+		page.comment = comment
+
+		if r.err != nil {
+			return nil, r.err
+		}
+		var err error
+		if field, err = page.next(); err != nil {
+			return nil, err
+		}
+		pages = append(pages, page)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("%w: no pages", ErrorBadFumen)
+	}
+	return pages, nil
+}
+
+// Apply the diff of the field to f, returns false if nothing changed
+func (r *fumenReader) field(f *fumenField) bool {
+	for i := 0; i < FUMEN_BLOCKS && r.err == nil; {
+		v := r.poll(2)
+		diff, count := v/FUMEN_BLOCKS-8, v%FUMEN_BLOCKS+1
+		if diff == 0 && count == FUMEN_BLOCKS {
+			return false
+		}
+		if i+count > FUMEN_BLOCKS {
+			r.err = fmt.Errorf("%w: field overflow", ErrorBadFumen)
+			return true
+		}
+		for ; count > 0; count-- {
+			c := int(f[i]) + diff
+			if c < FUMEN_EMPTY || c > FUMEN_GRAY {
+				r.err = fmt.Errorf("%w: bad cell", ErrorBadFumen)
+				return true
+			}
+			f[i] = uint8(c)
+			i++
+		}
+	}
+	return true
+}
+
+// A comment, escaped as by javascript, 4 chars by 5 values
+func (r *fumenReader) comment() string {
+	n := r.poll(2)
+	var b strings.Builder
+	for i := 0; i < n && r.err == nil; i += 4 {
+		v := r.poll(5)
+		for k := i; k < i+4 && k < n; k++ {
+			c := v % (len(FUMEN_CHARS) + 1)
+			if c >= len(FUMEN_CHARS) {
+				r.err = fmt.Errorf("%w: bad comment", ErrorBadFumen)
+				return ""
+			}
+			b.WriteByte(FUMEN_CHARS[c])
+			v /= len(FUMEN_CHARS) + 1
+		}
+	}
+	return unescape(b.String())
+}
+
+// Values to encode as fumen chars
+type fumenWriter struct {
+	values []int
+}
+
+func (w *fumenWriter) push(v, n int) {
+	for k := 0; k < n; k++ {
+		w.values = append(w.values, v%len(FUMEN_TABLE))
+		v /= len(FUMEN_TABLE)
+	}
+}
+
+// Encode the pages as a fumen, the same as the fumen editor
+func encodeFumen(pages []fumenPage) (string, error) {
+	w := &fumenWriter{}
+	var field fumenField
+	repeat := -1 // index of the count of the pages repeating the field, -1 if none
+	comment := ""
+
+	for i := range pages {
+		page := &pages[i]
+		if w.field(&field, &page.field) {
+			repeat = -1
+		} else if repeat < 0 || w.values[repeat] == len(FUMEN_TABLE)-1 {
+			repeat = len(w.values)
+			w.push(0, 1)
+		} else {
+			w.values = w.values[:len(w.values)-2] // the same field again
+			w.values[repeat]++
+		}
+
+		p := page.piece
+		n := 0
+		if p.kind != FUMEN_EMPTY {
+			dx, dy := p.offset()
+			n = fumenIndex(p.x-dx, p.y-dy)
+			if n < 0 || n >= FUMEN_BLOCKS {
+				return "", fmt.Errorf("%w: piece out of the field", ErrorBadFumen)
+			}
+		}
+		hasComment := page.comment != comment
+
+		v := bit(!page.lock)
+		v = v*2 + bit(hasComment)
+		v = v*2 + bit(i == 0) // colour the pieces
+		v = v*2 + bit(page.mirror)
+		v = v*2 + bit(page.rise)
+		v = (v*FUMEN_BLOCKS+n)*4 + p.rotation
+		w.push(v*8+p.kind, 3)
+
+		if hasComment {
+			w.comment(page.comment)
+			comment = page.comment
+		}
+
+		var err error
+		if field, err = page.next(); err != nil {
+			return "", err
+		}
+	}
+
+	var b strings.Builder
+	for i, v := range w.values {
+		if i == 42 || i > 42 && (i-42)%47 == 0 {
+			b.WriteByte('?') // as the fumen editor breaks the lines
+		}
+		b.WriteByte(FUMEN_TABLE[v])
+	}
+	return FUMEN_PREFIX + b.String(), nil
+}
+
+// Push the diff from prev to f by runs, returns false if nothing changed
+func (w *fumenWriter) field(prev, f *fumenField) bool {
+	run, count := -1, 0
+	for i := range f {
+		diff := int(f[i]) - int(prev[i]) + 8
+		if diff != run && count > 0 {
+			w.push(run*FUMEN_BLOCKS+count-1, 2)
+			count = 0
+		}
+		run = diff
+		count++
+	}
+	w.push(run*FUMEN_BLOCKS+count-1, 2)
+	return run != 8 || count != FUMEN_BLOCKS
+}
+
+func (w *fumenWriter) comment(comment string) {
+	s := escape(comment)
+	if len(s) > FUMEN_MAX_COMMENT {
+		s = s[:FUMEN_MAX_COMMENT]
+	}
+	w.push(len(s), 2)
+	for i := 0; i < len(s); i += 4 {
+		v, unit := 0, 1
+		for k := i; k < i+4 && k < len(s); k++ {
+			v += strings.IndexByte(FUMEN_CHARS, s[k]) * unit
+			unit *= len(FUMEN_CHARS) + 1
+		}
+		w.push(v, 5)
+	}
+}
+
+func bit(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Escape as the escape of javascript, by UTF-16 units
+func escape(s string) string {
+	var b strings.Builder
+	for _, u := range utf16.Encode([]rune(s)) {
+		switch {
+		case u < 0x80 && (u >= 'a' && u <= 'z' || u >= 'A' && u <= 'Z' ||
+			u >= '0' && u <= '9' || strings.ContainsRune("@*_+-./", rune(u))):
+			b.WriteByte(byte(u))
+		case u < 0x100:
+			fmt.Fprintf(&b, "%%%02X", u)
+		default:
+			fmt.Fprintf(&b, "%%u%04X", u)
+		}
+	}
+	return b.String()
+}
+
+// Unescape as the unescape of javascript, bad escapes are kept as they are
+func unescape(s string) string {
+	var units []uint16
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' {
+			if i+6 <= len(s) && s[i+1] == 'u' {
+				if u, err := strconv.ParseUint(s[i+2:i+6], 16, 16); err == nil {
+					units = append(units, uint16(u))
+					i += 5
+					continue
+				}
+			}
+			if i+3 <= len(s) {
+				if u, err := strconv.ParseUint(s[i+1:i+3], 16, 8); err == nil {
+					units = append(units, uint16(u))
+					i += 2
+					continue
+				}
+			}
+		}
+		units = append(units, uint16(s[i]))
+	}
+	return string(utf16.Decode(units))
+}
+
+// Cells of a shape in the box, ordered by row and column
+func shapeCells(s *Shape) [][2]int {
+	var cells [][2]int
+	for j := 0; j < SHAPE_SIZE; j++ {
+		for i := 0; i < SHAPE_SIZE; i++ {
+			if s.data[j][i] > 0 {
+				cells = append(cells, [2]int{i, j})
+			}
+		}
+	}
+	return cells
+}
+
+// Board cells of the fumen piece, x the column from the left & y the row
+// from the top of the board; ordered by row and column
+func (p fumenPiece) boardCells(dx int) [][2]int {
+	var cells [][2]int
+	for _, c := range p.cells() {
+		cells = append(cells, [2]int{c[0] + dx, ROW - 1 - c[1]})
+	}
+	sort.Slice(cells, func(i, j int) bool {
+		a, b := cells[i], cells[j]
+		return a[1] < b[1] || a[1] == b[1] && a[0] < b[0]
+	})
+	return cells
+}
+
+// The shape & box position of the cells, false if no shape is of them
+func nodeOfCells(cells [][2]int) (aiNode, bool) {
+	for _, s := range shapes {
+		sc := shapeCells(s)
+		if len(sc) != len(cells) {
+			continue
+		}
+		dx, dy := cells[0][0]-sc[0][0], cells[0][1]-sc[0][1]
+		same := true
+		for i := range sc {
+			same = same && cells[i][0]-sc[i][0] == dx && cells[i][1]-sc[i][1] == dy
+		}
+		if same {
+			return aiNode{s.id, dx, dy}, true
+		}
+	}
+	return aiNode{}, false
+}
+
+// The fumen piece of the shape at the box position, the columns of the
+// board shifted by dx; false if not a piece of fumen
+func fumenPieceOf(n aiNode, dx int) (fumenPiece, bool) {
+	cells := shapeCells(n.shape())
+	for kind := FUMEN_I; kind < FUMEN_GRAY; kind++ {
+		for _, rotation := range []int{FUMEN_SPAWN, FUMEN_RIGHT, FUMEN_REVERSE, FUMEN_LEFT} {
+			p := fumenPiece{kind: kind, rotation: rotation}
+			pc := p.boardCells(0)
+			if len(pc) != len(cells) {
+				continue
+			}
+			// move the center by the offset of the first cells
+			offX := n.left + cells[0][0] + dx - pc[0][0]
+			offY := n.top + cells[0][1] - pc[0][1]
+			p.x, p.y = offX, -offY
+			same := true
+			for i, c := range p.boardCells(0) {
+				same = same && c[0] == n.left+cells[i][0]+dx && c[1] == n.top+cells[i][1]
+			}
+			if same {
+				return p, true
+			}
+		}
+	}
+	return fumenPiece{}, false
+}
+
+// Shape id of the piece of fumen in spawn rotation
+func fumenShape(kind int) int {
+	n, _ := nodeOfCells(fumenPiece{kind: kind, rotation: FUMEN_SPAWN}.boardCells(0))
+	return n.id
+}
+
+// Letter of fumen of the shape, 0 if not a piece of fumen
+func fumenLetter(id int) byte {
+	if p, ok := fumenPieceOf(aiNode{id, 0, 0}, 0); ok {
+		return fumenLetters[p.kind]
+	}
+	return 0
+}
+
+// Shapes of a quiz comment, e.g. #Q=[T](I)OSZ; false if not a quiz
+func parseQuiz(comment string) (hold int, queue []int, ok bool) {
+	if !strings.HasPrefix(comment, FUMEN_QUIZ) {
+		return -1, nil, false
+	}
+	hold = -1
+	for _, c := range comment[len(FUMEN_QUIZ):] {
+		kind := strings.IndexRune(fumenLetters, c)
+		switch {
+		case kind > 0 && kind < FUMEN_GRAY:
+			queue = append(queue, fumenShape(kind))
+		case c == ']' && len(queue) > 0:
+			hold, queue = queue[0], nil
+		case c == ';':
+			return hold, queue, len(queue) > 0 // the rest is the goal of the quiz
+		}
+	}
+	return hold, queue, len(queue) > 0
+}
+
+// The board of a field, the columns beyond the fumen field are filled up
+// to the top of the setup, i.e. rows up to top (from the bottom); false
+// if the field is taller than the board
+func fumenBoard(f *fumenField, top int) ([ROW][COL]uint8, bool) {
+	var board [ROW][COL]uint8
+	for y := 0; y < FUMEN_TOP; y++ {
+		for x := 0; x < FUMEN_WIDTH; x++ {
+			c := f[fumenIndex(x, y)]
+			if c == FUMEN_EMPTY {
+				continue
+			}
+			if y >= ROW {
+				return board, false
+			}
+			board[ROW-1-y][x] = CELL_BLOCK
+			if c == FUMEN_GRAY {
+				board[ROW-1-y][x] = CELL_GARBAGE
+			}
+		}
+	}
+	for y := 0; y <= top && y < ROW; y++ {
+		for x := FUMEN_WIDTH; x < COL; x++ {
+			board[ROW-1-y][x] = CELL_GARBAGE
+		}
+	}
+	return board, true
+}
+
+// Highest row (from the bottom) of the blocks of the pages, -1 if none.
+// A row a piece fills has blocks of the field before, pieces are 4 cells
+func fumenTop(pages []fumenPage) int {
+	top := -1
+	for _, page := range pages {
+		for i, c := range page.field[:FUMEN_BLOCKS-FUMEN_WIDTH] {
+			if y := FUMEN_TOP - 1 - i/FUMEN_WIDTH; c != FUMEN_EMPTY && y > top {
+				top = y
+			}
+		}
+	}
+	return top
+}
+
+// Notation of the first page: the board, its piece as the current shape,
+// the pieces of the next pages as the next shapes; or the shapes of its
+// quiz comment
+func fumenNotation(pages []fumenPage) (*notation, error) {
+	first := &pages[0]
+	board, ok := fumenBoard(&first.field, fumenTop(pages))
+	if !ok {
+		return nil, fmt.Errorf("%w: taller than %d rows", ErrorBadFumen, ROW)
+	}
+	n := &notation{board: board, shape: -1, hold: -1}
+
+	if hold, queue, ok := parseQuiz(first.comment); ok {
+		n.hold, n.shape, n.nexts = hold, queue[0], queue[1:]
+	} else {
+		for _, page := range pages {
+			if page.piece.kind != FUMEN_EMPTY {
+				n.nexts = append(n.nexts, fumenShape(page.piece.kind))
+			}
+		}
+		if len(n.nexts) == 0 {
+			return nil, fmt.Errorf("%w: no pieces", ErrorBadFumen)
+		}
+		n.shape, n.nexts = n.nexts[0], n.nexts[1:]
+	}
+	if len(n.nexts) > MAX_PREVIEWS {
+		n.nexts = n.nexts[:MAX_PREVIEWS]
+	}
+
+	// where the piece of the page is, if it is the current shape & fits,
+	// otherwise at the top
+	b := boardOf(&n.board)
+	sp := spawnPoint(shapes[n.shape])
+	node := aiNode{n.shape, sp.left, sp.top}
+	if p := first.piece; p.kind != FUMEN_EMPTY && fumenShape(p.kind) == n.shape {
+		if at, ok := nodeOfCells(p.boardCells(0)); ok && b.fits(at.shape(), at.pos()) {
+			node = at
+		}
+	}
+	n.shape, n.pos = node.id, node.pos()
+	if !b.fits(node.shape(), node.pos()) {
+		return nil, fmt.Errorf("%w: no room for the current shape", ErrorBadFumen)
+	}
+	return n, nil
+}
+
+// Puzzle of the pages: the board of the first page, the shapes of the
+// pieces placed or of the quiz comment. The goal is of the pieces placed,
+// a perfect clear if no blocks are left, otherwise the lines cleared,
+// none if no lines
+func fumenPuzzle(pages []fumenPage) (*puzzle, error) {
+	board, ok := fumenBoard(&pages[0].field, fumenTop(pages))
+	if !ok {
+		return nil, fmt.Errorf("%w: taller than %d rows", ErrorBadFumen, ROW)
+	}
+	p := &puzzle{name: "Fumen", board: board, hold: -1}
+
+	var quiz bool
+	p.hold, p.queue, quiz = parseQuiz(pages[0].comment)
+	if !quiz && pages[0].comment != "" {
+		p.name = pages[0].comment
+	}
+
+	var placed []int
+	field := pages[0].field
+	for i := range pages {
+		page := pages[i]
+		page.field = field
+		if page.piece.kind != FUMEN_EMPTY && page.lock {
+			placed = append(placed, fumenShape(page.piece.kind))
+		}
+		lines, err := page.clears()
+		if err != nil {
+			return nil, err
+		}
+		p.lines += lines
+		if field, err = page.next(); err != nil {
+			return nil, err
+		}
+	}
+	if !quiz {
+		p.queue = placed
+	}
+	if len(p.queue) == 0 {
+		return nil, fmt.Errorf("%w: no pieces", ErrorBadFumen)
+	}
+
+	empty := true
+	for _, c := range field[:FUMEN_BLOCKS-FUMEN_WIDTH] {
+		empty = empty && c == FUMEN_EMPTY
+	}
+	if empty && len(placed) > 0 {
+		p.goal, p.lines = GOAL_PERFECT, 0
+	}
+	return p, nil
+}
+
+// Puzzle of a fumen, with a goal
+func importFumen(text string) (*puzzle, error) {
+	pages, err := decodeFumen(text)
+	if err != nil {
+		return nil, err
+	}
+	p, err := fumenPuzzle(pages)
+	if err == nil && p.goal == GOAL_LINES && p.lines == 0 {
+		err = fmt.Errorf("%w: no lines cleared", ErrorBadFumen)
+	}
+	return p, err
+}
+
+// Lines the piece of the page clears when locked
+func (p *fumenPage) clears() (int, error) {
+	if !p.lock || p.piece.kind == FUMEN_EMPTY {
+		return 0, nil
+	}
+	page := *p
+	page.rise, page.mirror = false, false
+	f, err := page.next()
+	if err != nil {
+		return 0, err
+	}
+	// next cleared the lines already, count the blocks gone
+	before, after := 4, 0
+	for i := 0; i < FUMEN_BLOCKS-FUMEN_WIDTH; i++ {
+		before += bit(p.field[i] != FUMEN_EMPTY)
+		after += bit(f[i] != FUMEN_EMPTY)
+	}
+	return (before - after) / FUMEN_WIDTH, nil
+}
+
+// Fumen of the notation: a page of the board & the current shape, with
+// the shapes in a quiz comment if all are pieces of fumen. A column of
+// the board beyond the fumen field is left out, e.g. one filled by
+// fumenBoard, or the last one
+func notationFumen(n *notation) (string, error) {
+	dx := 0
+	if dropColumn(&n.board) == 0 {
+		dx = -1
+	}
+
+	var page fumenPage
+	page.lock = true
+	for i := range n.board {
+		for j, c := range n.board[i] {
+			x, y := j+dx, ROW-1-i
+			if c == CELL_EMPTY || x < 0 || x >= FUMEN_WIDTH {
+				continue
+			}
+			page.field[fumenIndex(x, y)] = FUMEN_GRAY
+		}
+	}
+
+	if n.shape >= 0 {
+		if p, ok := fumenPieceOf(aiNode{n.shape, n.pos.left, n.pos.top}, dx); ok {
+			inside := true
+			for _, c := range p.cells() {
+				inside = inside && c[0] >= 0 && c[0] < FUMEN_WIDTH
+			}
+			if inside {
+				page.piece = p
+			}
+		}
+		page.comment = quizOf(n)
+	}
+	return encodeFumen([]fumenPage{page})
+}
+
+// Column of the board to leave out of fumen: the last or the first, if
+// it is empty or filled from the bottom as by fumenBoard
+func dropColumn(board *[ROW][COL]uint8) int {
+	filler := func(col int) bool {
+		top := ROW
+		for top > 0 && board[top-1][col] == CELL_GARBAGE {
+			top--
+		}
+		for i := 0; i < top; i++ {
+			if board[i][col] != CELL_EMPTY {
+				return false
+			}
+		}
+		return true
+	}
+	switch {
+	case filler(COL - 1):
+	case filler(0):
+		return 0
+	default:
+		log.Printf("[fumen] the blocks of column %d are left out", COL-1)
+	}
+	return COL - 1
+}
+
+// Quiz comment of the shapes, empty if any is not a piece of fumen
+func quizOf(n *notation) string {
+	var b strings.Builder
+	b.WriteString(FUMEN_QUIZ + "[")
+	if n.hold >= 0 {
+		c := fumenLetter(n.hold)
+		if c == 0 {
+			return ""
+		}
+		b.WriteByte(c)
+	}
+	b.WriteString("](")
+	for i, id := range append([]int{n.shape}, n.nexts...) {
+		c := fumenLetter(id)
+		if c == 0 {
+			return ""
+		}
+		b.WriteByte(c)
+		if i == 0 {
+			b.WriteByte(')')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,306 @@
+package tetris
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestFumenEmpty(t *testing.T) {
+	const empty = "v115@vhAAgH" // of the fumen editor
+	pages, err := decodeFumen("https://fumen.zui.jp/?" + empty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []fumenPage{{lock: true}}
+	if !reflect.DeepEqual(pages, want) {
+		t.Fatalf("decoded %+v, want %+v", pages, want)
+	}
+	if got, _ := encodeFumen(pages); got != empty {
+		t.Errorf("encoded %q, want %q", got, empty)
+	}
+
+	for _, text := range []string{"", "v114@vhAAgH", "v115@", "v115@vh", "v115@vhAAg!"} {
+		if _, err := decodeFumen(text); !errors.Is(err, ErrorBadFumen) {
+			t.Errorf("decoded %q: %v, want %v", text, err, ErrorBadFumen)
+		}
+	}
+}
+
+// Pages of the pieces in every rotation, locked or not, the fields of the
+// locked ones carried to the next pages
+func TestFumenRoundTrip(t *testing.T) {
+	var first fumenPage
+	for x := 0; x < FUMEN_WIDTH-1; x++ {
+		first.field[fumenIndex(x, 0)] = FUMEN_GRAY
+		first.field[fumenIndex(x, -1)] = FUMEN_GRAY
+	}
+	first.comment = "Setup 日本 %u 😀"
+
+	pages := []fumenPage{first}
+	add := func(p fumenPage) {
+		last := &pages[len(pages)-1]
+		f, err := last.next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.field = f
+		pages = append(pages, p)
+	}
+	for kind := FUMEN_I; kind < FUMEN_GRAY; kind++ {
+		for rotation := FUMEN_REVERSE; rotation <= FUMEN_LEFT; rotation++ {
+			add(fumenPage{piece: fumenPiece{kind, rotation, 4, 10}, comment: "same"})
+		}
+	}
+	add(fumenPage{piece: fumenPiece{FUMEN_I, FUMEN_LEFT, 9, 1}, lock: true, rise: true})
+	add(fumenPage{piece: fumenPiece{FUMEN_T, FUMEN_SPAWN, 1, 1}, lock: true, mirror: true})
+	for i := 0; i < 70; i++ {
+		add(fumenPage{comment: strings.Repeat("long ", 20)}) // repeated fields
+	}
+
+	text, err := encodeFumen(pages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := decodeFumen(text)
+	if err != nil {
+		t.Fatalf("decode %q: %v", text, err)
+	}
+	if len(got) != len(pages) {
+		t.Fatalf("decoded %d pages, want %d", len(got), len(pages))
+	}
+	for i := range pages {
+		if !reflect.DeepEqual(got[i], pages[i]) {
+			t.Errorf("page %d decoded %+v, want %+v", i, got[i], pages[i])
+		}
+	}
+
+	// the I of the rising page cleared the row, then the garbage rose
+	f, _ := pages[len(pages)-1].next()
+	if f[fumenIndex(0, 0)] != FUMEN_EMPTY || f[fumenIndex(9, 0)] != FUMEN_GRAY {
+		t.Errorf("bottom row after the rise & mirror %v", f[fumenIndex(0, 0):fumenIndex(0, -1)])
+	}
+}
+
+// Every piece of fumen is a shape of ours at the same cells, and back
+func TestFumenShapes(t *testing.T) {
+	for kind := FUMEN_I; kind < FUMEN_GRAY; kind++ {
+		for rotation := FUMEN_REVERSE; rotation <= FUMEN_LEFT; rotation++ {
+			p := fumenPiece{kind, rotation, 4, 5}
+			n, ok := nodeOfCells(p.boardCells(0))
+			if !ok {
+				t.Fatalf("no shape of %+v", p)
+			}
+			q, ok := fumenPieceOf(n, 0)
+			if !ok || q.kind != kind || !reflect.DeepEqual(q.boardCells(0), p.boardCells(0)) {
+				t.Errorf("%+v is shape %d, back to %+v", p, n.id, q)
+			}
+		}
+		if c := fumenLetter(fumenShape(kind)); c != fumenLetters[kind] {
+			t.Errorf("letter of piece %d is %q", kind, c)
+		}
+	}
+	if _, ok := fumenPieceOf(aiNode{33, 4, 5}, 0); ok {
+		t.Error("an odd shape is a piece of fumen")
+	}
+}
+
+func TestFumenNotation(t *testing.T) {
+	board, err := parseBoard([]string{
+		"X..........",
+		"GGG.GGGGG.G",
+		"GGGG.GGGGGG",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := &notation{board: board, shape: 27, pos: Point{2, 5}, nexts: []int{15, 53}, hold: 29}
+
+	text, err := notationFumen(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages, err := decodeFumen(text)
+	if err != nil {
+		t.Fatalf("decode %q: %v", text, err)
+	}
+	if pages[0].comment != "#Q=[S](T)IO" {
+		t.Errorf("quiz %q", pages[0].comment)
+	}
+	got, err := fumenNotation(pages)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the last column is filled up to the top of the setup
+	want := *n
+	for i := ROW - 3; i < ROW; i++ {
+		want.board[i][COL-1] = CELL_GARBAGE
+	}
+	for i, row := range want.board {
+		for j, c := range row {
+			if c == CELL_BLOCK {
+				want.board[i][j] = CELL_GARBAGE // the colours are not kept
+			}
+		}
+	}
+	if !reflect.DeepEqual(got, &want) {
+		t.Errorf("back from %q\n%s want\n%s", text, got, &want)
+	}
+}
+
+func TestFumenTooTall(t *testing.T) {
+	var page fumenPage
+	page.field[fumenIndex(0, ROW)] = FUMEN_GRAY
+	page.piece = fumenPiece{FUMEN_O, FUMEN_SPAWN, 4, 0}
+	if _, err := fumenNotation([]fumenPage{page}); !errors.Is(err, ErrorBadFumen) {
+		t.Errorf("notation of a tall field: %v", err)
+	}
+}
+
+func TestImportFumen(t *testing.T) {
+	var page fumenPage
+	for x := 0; x < 6; x++ {
+		page.field[fumenIndex(x, 0)] = FUMEN_GRAY
+	}
+	page.comment = "Sweep"
+	page.piece = fumenPiece{FUMEN_I, FUMEN_SPAWN, 7, 0}
+	page.lock = true
+	text, err := encodeFumen([]fumenPage{page})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := importFumen(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.name != "Sweep" || p.goal != GOAL_PERFECT || !reflect.DeepEqual(p.queue, []int{fumenShape(FUMEN_I)}) {
+		t.Errorf("imported %+v", p)
+	}
+	if !canSolve(p, boardOf(&p.board), p.queue, p.hold, 0) {
+		t.Errorf("could not solve\n%s", formatBoard(&p.board))
+	}
+
+	// a puzzle file of the fumen, the goal given
+	text = "name: f\ngoal: lines 1\nfumen: " + text
+	puzzles, err := parsePuzzles(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q := puzzles[0]; q.goal != GOAL_LINES || q.lines != 1 || q.board != p.board {
+		t.Errorf("parsed %+v", q)
+	}
+
+	// no lines cleared
+	page.piece.y = 1
+	text, _ = encodeFumen([]fumenPage{page})
+	if _, err := importFumen(text); !errors.Is(err, ErrorBadFumen) {
+		t.Errorf("imported a fumen of no goal: %v", err)
+	}
+}
+
+// Fumens of the editor's format: the pages of every piece in every rotation,
+// at x 4 & y 2 as kept in the data, not locked; the cells are the rows from
+// y 4 down to 0
+func TestFumenPieces(t *testing.T) {
+	const text = "v115@vhbRGnJGnBGnZGnSGnKGnCGnaGnTGnLGnDGnbGnUGnMGnEGncGnVGnNGnFGndGnWGnOGnGGneGnXGnPGnHGnfGn"
+	want := []struct {
+		kind, rotation int
+		cells          string
+	}{
+		{FUMEN_I, FUMEN_SPAWN, "..........|..........|...####...|..........|.........."},
+		{FUMEN_I, FUMEN_RIGHT, "..........|....#.....|....#.....|....#.....|....#....."},
+		{FUMEN_I, FUMEN_REVERSE, "..........|..........|...####...|..........|.........."},
+		{FUMEN_I, FUMEN_LEFT, "..........|....#.....|....#.....|....#.....|....#....."},
+		{FUMEN_L, FUMEN_SPAWN, "..........|.....#....|...###....|..........|.........."},
+		{FUMEN_L, FUMEN_RIGHT, "..........|....#.....|....#.....|....##....|.........."},
+		{FUMEN_L, FUMEN_REVERSE, "..........|..........|...###....|...#......|.........."},
+		{FUMEN_L, FUMEN_LEFT, "..........|...##.....|....#.....|....#.....|.........."},
+		{FUMEN_O, FUMEN_SPAWN, "..........|..........|....##....|....##....|.........."},
+		{FUMEN_O, FUMEN_RIGHT, "..........|..........|....##....|....##....|.........."},
+		{FUMEN_O, FUMEN_REVERSE, "..........|..........|....##....|....##....|.........."},
+		{FUMEN_O, FUMEN_LEFT, "..........|..........|....##....|....##....|.........."},
+		{FUMEN_Z, FUMEN_SPAWN, "..........|..........|...##.....|....##....|.........."},
+		{FUMEN_Z, FUMEN_RIGHT, "..........|.....#....|....##....|....#.....|.........."},
+		{FUMEN_Z, FUMEN_REVERSE, "..........|..........|...##.....|....##....|.........."},
+		{FUMEN_Z, FUMEN_LEFT, "..........|.....#....|....##....|....#.....|.........."},
+		{FUMEN_T, FUMEN_SPAWN, "..........|....#.....|...###....|..........|.........."},
+		{FUMEN_T, FUMEN_RIGHT, "..........|....#.....|....##....|....#.....|.........."},
+		{FUMEN_T, FUMEN_REVERSE, "..........|..........|...###....|....#.....|.........."},
+		{FUMEN_T, FUMEN_LEFT, "..........|....#.....|...##.....|....#.....|.........."},
+		{FUMEN_J, FUMEN_SPAWN, "..........|...#......|...###....|..........|.........."},
+		{FUMEN_J, FUMEN_RIGHT, "..........|....##....|....#.....|....#.....|.........."},
+		{FUMEN_J, FUMEN_REVERSE, "..........|..........|...###....|.....#....|.........."},
+		{FUMEN_J, FUMEN_LEFT, "..........|....#.....|....#.....|...##.....|.........."},
+		{FUMEN_S, FUMEN_SPAWN, "..........|..........|....##....|...##.....|.........."},
+		{FUMEN_S, FUMEN_RIGHT, "..........|...#......|...##.....|....#.....|.........."},
+		{FUMEN_S, FUMEN_REVERSE, "..........|..........|....##....|...##.....|.........."},
+		{FUMEN_S, FUMEN_LEFT, "..........|...#......|...##.....|....#.....|.........."},
+	}
+	pages, err := decodeFumen(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != len(want) {
+		t.Fatalf("decoded %d pages, want %d", len(pages), len(want))
+	}
+	for i, w := range want {
+		p := pages[i]
+		if p.piece.kind != w.kind || p.piece.rotation != w.rotation || p.lock || p.field != (fumenField{}) {
+			t.Errorf("page %d decoded %+v", i, p)
+			continue
+		}
+		var cells [][2]int
+		for k, row := range strings.Split(w.cells, "|") {
+			for x, c := range row {
+				if c == '#' {
+					cells = append(cells, [2]int{x, 4 - k})
+				}
+			}
+		}
+		got := p.piece.cells()
+		sort.Slice(got[:], func(i, j int) bool {
+			a, b := got[i], got[j]
+			return a[1] > b[1] || a[1] == b[1] && a[0] < b[0]
+		})
+		if !reflect.DeepEqual(got[:], cells) {
+			t.Errorf("page %d cells %v, want %s", i, got, w.cells)
+		}
+	}
+}
+
+// A quiz on a field of garbage, no piece placed
+func TestFumenQuiz(t *testing.T) {
+	const text = "v115@ThH8AeI8JeAgWaAFLDmClcJSAVztSAVG88A4N88AZyytC6/AAA"
+	pages, err := decodeFumen(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 1 || pages[0].comment != "#Q=[T](I)LOSZJ" || pages[0].piece.kind != FUMEN_EMPTY {
+		t.Fatalf("decoded %+v", pages)
+	}
+	n, err := fumenNotation(pages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	board, err := parseBoard([]string{
+		"..GGGGGGGGG",
+		".GGGGGGGGGG",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.board != board {
+		t.Errorf("board\n%s", formatBoard(&n.board))
+	}
+	queue := string(fumenLetter(n.shape))
+	for _, id := range n.nexts {
+		queue += string(fumenLetter(id))
+	}
+	if fumenLetter(n.hold) != 'T' || queue != "ILOSZJ" {
+		t.Errorf("hold %c, queue %s", fumenLetter(n.hold), queue)
+	}
+}
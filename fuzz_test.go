@@ -0,0 +1,165 @@
+package tetris
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Time to step a frame, longer is taken for a deadlock
+const STEP_TIMEOUT = 2 * time.Second
+
+var REPLAYS_DIR = filepath.Join("testdata", "replays")
+
+var errorInvariant = errors.New("invariant broken")
+
+// Modes played by random inputs, puzzles need a puzzle
+var fuzzModes = []Mode{MODE_MARATHON, MODE_DIG, MODE_FINESSE, MODE_MASTER, MODE_FADING, MODE_INVISIBLE, MODE_CASCADE}
+
+// Replay of a fuzz input: each byte is an event of a game control, the low
+// 3 bits the control, the 4th set if released, the high 4 bits the frames
+// without events after it
+func fuzzReplay(seed int64, mode uint8, data []byte) *replay {
+	r := &replay{Seed: seed, Mode: fuzzModes[int(mode)%len(fuzzModes)]}
+	for _, b := range data {
+		e := inputEvent{Control(b % uint8(CTRL_PAUSE)), b&8 == 0}
+		r.Frames = append(r.Frames, []inputEvent{e})
+		for n := b >> 4; n > 0; n-- {
+			r.Frames = append(r.Frames, nil)
+		}
+	}
+	return r
+}
+
+// Play the replay checking the invariants of the engine after every frame,
+// returns the first broken and the frame of it
+func checkReplay(r *replay) (int, error) {
+	g := r.start()
+	var score uint64
+	var rows uint
+	for f, events := range r.Frames {
+		done := make(chan bool)
+		go func() {
+			g.step(events)
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(STEP_TIMEOUT):
+			return f, fmt.Errorf("frame %d: deadlock", f)
+		}
+
+		g.m.Lock()
+		err := g.checkInvariants(score, rows)
+		score, rows = g.score, g.rows
+		running := g.state.active()
+		g.m.Unlock()
+		if err != nil {
+			return f, fmt.Errorf("frame %d: %w", f, err)
+		}
+		if !running {
+			break
+		}
+	}
+	return len(r.Frames), nil
+}
+
+// The caller should hold g.m
+func (g *Game) checkInvariants(score uint64, rows uint) error {
+	for i := range g.model {
+		for j, c := range g.model[i] {
+			if c > CELL_GARBAGE {
+				return fmt.Errorf("%w: cell %d at %d,%d", errorInvariant, c, j, i)
+			}
+		}
+	}
+	if g.score < score || g.rows < rows {
+		return fmt.Errorf("%w: score %d & rows %d after %d & %d", errorInvariant, g.score, g.rows, score, rows)
+	}
+	if !g.state.active() {
+		return nil
+	}
+
+	if top := stackTop(&g.model); g.waterLevel != top {
+		return fmt.Errorf("%w: water level %d, the stack at %d\n%s", errorInvariant,
+			g.waterLevel, top, formatBoard(&g.model))
+	}
+	if g.currShape == nil {
+		return fmt.Errorf("%w: no shape", errorInvariant)
+	}
+	if g.currShape.area(g.pos).outOfBounds() {
+		return fmt.Errorf("%w: shape %d at %v out of the board", errorInvariant, g.currShape.id, g.pos)
+	}
+	if !g.canMoveShape(g.currShape, nil, &Moving{g.pos, g.pos}) {
+		return fmt.Errorf("%w: shape %d at %v on the stack\n%s", errorInvariant,
+			g.currShape.id, g.pos, formatBoard(&g.model))
+	}
+	return nil
+}
+
+// Save the replay failing at the frame to REPLAYS_DIR, named by its hash
+func saveFailingReplay(t *testing.T, r *replay, frame int) string {
+	r.Frames = r.Frames[:frame+1]
+	if err := os.MkdirAll(REPLAYS_DIR, 0755); err != nil {
+		t.Fatal(err)
+	}
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%d %d %v", r.Seed, r.Mode, r.Frames)
+	path := filepath.Join(REPLAYS_DIR, fmt.Sprintf("%s-%08x.json", r.Mode, h.Sum32()))
+	if err := r.save(path); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func FuzzEngine(f *testing.F) {
+	f.Add(int64(1), uint8(MODE_MARATHON), []byte{0x06, 0x0e, 0x16, 0x26, 0x36})
+	f.Add(int64(2), uint8(MODE_DIG), []byte{0x00, 0x08, 0x01, 0x09, 0x06, 0x0e, 0xf5})
+	f.Add(int64(3), uint8(MODE_FINESSE), []byte{0x07, 0x0f, 0x02, 0x0a, 0x03, 0x0b, 0x04, 0x06})
+
+	f.Fuzz(func(t *testing.T, seed int64, mode uint8, data []byte) {
+		r := fuzzReplay(seed, mode, data)
+		if f, err := checkReplay(r); err != nil {
+			t.Fatalf("%v, replay saved to %s", err, saveFailingReplay(t, r, f))
+		}
+	})
+}
+
+// Random inputs of every mode, the same as the fuzz target without -fuzz
+func TestRandomInputs(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	n := 30
+	if testing.Short() {
+		n = 3
+	}
+	for k := 0; k < n; k++ {
+		data := make([]byte, 1000)
+		rnd.Read(data)
+		r := fuzzReplay(rnd.Int63(), uint8(k), data)
+		if f, err := checkReplay(r); err != nil {
+			t.Fatalf("%v, replay saved to %s", err, saveFailingReplay(t, r, f))
+		}
+	}
+}
+
+// The replays saved of failures found are kept as regression tests
+func TestReplays(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join(REPLAYS_DIR, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		r, err := loadReplay(path)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if _, err := checkReplay(r); err != nil {
+			t.Errorf("%s: %v", path, err)
+		}
+	}
+}
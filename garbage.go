@@ -0,0 +1,140 @@
+package tetris
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Values of g.model cells
+const (
+	CELL_EMPTY uint8 = iota
+	CELL_BLOCK
+	CELL_GARBAGE
+)
+
+// How holes are placed in garbage rows
+type GarbagePattern int
+
+const (
+	GARBAGE_WELL   GarbagePattern = iota // the same column all the game
+	GARBAGE_RANDOM                       // a random column per batch of rows
+	GARBAGE_CHEESE                       // a random column per row
+
+	GARBAGE_PATTERNS // number of patterns
+)
+
+var garbagePatternNames = [GARBAGE_PATTERNS]string{"well", "random", "cheese"}
+
+func (p GarbagePattern) String() string {
+	return garbagePatternNames[p]
+}
+
+func (p GarbagePattern) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *GarbagePattern) UnmarshalText(text []byte) error {
+	for i, name := range garbagePatternNames {
+		if name == string(text) {
+			*p = GarbagePattern(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown garbage pattern %q", text)
+}
+
+// Queue n garbage rows, they rise when the current shape locks.
+// It's safe to call from other goroutines, e.g. by an opponent
+func (g *Game) sendGarbage(n int) {
+	g.chanGarbage <- int(atomic.AddInt32(&g.pendingGarbage, int32(n)))
+}
+
+// Rise the pending garbage rows, the caller should hold g.m;
+// returns false if the stack is pushed out of the top
+func (g *Game) risePendingGarbage() bool {
+	n := atomic.SwapInt32(&g.pendingGarbage, 0)
+	if n == 0 {
+		return true
+	}
+	g.chanGarbage <- 0
+	return g.addGarbage(int(n), g.garbage)
+}
+
+// Push n garbage rows from the bottom, the caller should hold g.m;
+// returns false if the stack is pushed out of the top
+func (g *Game) addGarbage(n int, pattern GarbagePattern) bool {
+	if n <= 0 {
+		return true
+	}
+	if n > ROW {
+		n = ROW
+	}
+
+	toppedOut := g.waterLevel < n
+	m := &g.model
+	copy(m[:ROW-n], m[n:])
+	locked := &g.fading.locked
+	copy(locked[:ROW-n], locked[n:])
+
+	hole := g.nextHole(pattern)
+	for i := ROW - n; i < ROW; i++ {
+		if pattern == GARBAGE_CHEESE && i > ROW-n {
+			hole = g.nextHole(pattern)
+		}
+		m[i] = garbageRow(hole)
+		for j := range locked[i] {
+			locked[i][j] = g.fading.clock
+		}
+	}
+
+	g.waterLevel -= n
+	if g.waterLevel < 0 {
+		g.waterLevel = 0
+	}
+
+	// notify gui to redraw the risen rows
+	g.chanRedraw <- &Area{y: g.waterLevel, y2: ROW - 1}
+	g.emit(EVENT_GARBAGE)
+	return !toppedOut
+}
+
+// Returns the hole column of the next garbage row
+func (g *Game) nextHole(pattern GarbagePattern) int {
+	switch pattern {
+	case GARBAGE_WELL:
+		return g.well
+	case GARBAGE_CHEESE:
+		// never the same column as the row below
+		hole := g.rand.Intn(COL - 1)
+		if hole >= g.hole {
+			hole++
+		}
+		g.hole = hole
+		return hole
+	default:
+		g.hole = g.rand.Intn(COL)
+		return g.hole
+	}
+}
+
+func garbageRow(hole int) [COL]uint8 {
+	var row [COL]uint8
+	for j := range row {
+		if j != hole {
+			row[j] = CELL_GARBAGE
+		}
+	}
+	return row
+}
+
+// Returns true if any garbage cell left
+func (g *Game) hasGarbage() bool {
+	for i := g.waterLevel; i < ROW; i++ {
+		for j := 0; j < COL; j++ {
+			if g.model[i][j] == CELL_GARBAGE {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package tetris
+
+import "testing"
+
+// Column of the hole of a garbage row, -1 if not one hole of garbage
+func holeOf(row [COL]uint8) int {
+	hole := -1
+	for j, c := range row {
+		switch {
+		case c == CELL_EMPTY && hole < 0:
+			hole = j
+		case c != CELL_GARBAGE:
+			return -1
+		}
+	}
+	return hole
+}
+
+// Garbage rows of two batches pushing up the stack, holes by the pattern
+// of some seeds
+func TestAddGarbage(t *testing.T) {
+	for k := 0; k < 10*int(GARBAGE_PATTERNS); k++ {
+		pattern := GarbagePattern(k) % GARBAGE_PATTERNS
+		g := boardGame(t, "X..........")
+		g.seed(int64(k))
+		g.well = 3
+		if !g.addGarbage(5, pattern) || !g.addGarbage(6, pattern) {
+			t.Fatalf("%s: topped out", pattern)
+		}
+		if g.model[ROW-12] != [COL]uint8{CELL_BLOCK} || g.waterLevel != ROW-12 {
+			t.Errorf("%s: stack not pushed up, water level %d", pattern, g.waterLevel)
+		}
+
+		var holes []int
+		for i := ROW - 11; i < ROW; i++ {
+			holes = append(holes, holeOf(g.model[i]))
+			if holes[len(holes)-1] < 0 {
+				t.Fatalf("%s: row %d %v", pattern, i, g.model[i])
+			}
+		}
+		for k := 1; k < len(holes); k++ {
+			same := holes[k] == holes[k-1]
+			switch {
+			case pattern == GARBAGE_WELL && holes[k] != 3:
+				t.Errorf("%s: holes %v", pattern, holes)
+			case pattern == GARBAGE_RANDOM && k != 5 && !same:
+				t.Errorf("%s: holes %v, not one per batch", pattern, holes)
+			case pattern == GARBAGE_CHEESE && same:
+				t.Errorf("%s: holes %v, the same in adjacent rows", pattern, holes)
+			}
+		}
+	}
+
+	// pushed out of the top
+	g := boardGame(t, "X..........", "X..........")
+	if g.addGarbage(ROW-1, GARBAGE_CHEESE) {
+		t.Error("not topped out")
+	}
+}
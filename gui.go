@@ -19,15 +19,29 @@ const (
 	SIGNAL_DRAW            = "draw"
 	SIGNAL_KEY_PRESS_EVENT = "key-press-event"
 
-	KEY_LEFT  uint = 65361
-	KEY_UP    uint = 65362
-	KEY_RIGHT uint = 65363
-	KEY_DOWN  uint = 65364
-
-	ACTION_QUIT    = "app.quit"
-	ACTION_PAUSE   = "win.pause"
-	ACTION_RESUME  = "win.resume"
-	ACTION_NEWGAME = "win.start"
+	SIGNAL_KEY_RELEASE_EVENT = "key-release-event"
+	SIGNAL_FOCUS_OUT_EVENT   = "focus-out-event"
+	SIGNAL_WINDOW_STATE      = "window-state-event"
+
+	ACTION_QUIT     = "app.quit"
+	ACTION_PAUSE    = "win.pause"
+	ACTION_RESUME   = "win.resume"
+	ACTION_NEWGAME  = "win.start"
+	ACTION_SETUP    = "win.new-game"
+	ACTION_PREFS    = "win.prefs"
+	ACTION_MARATHON = "win.marathon"
+	ACTION_DIG      = "win.dig"
+	ACTION_FINESSE  = "win.finesse"
+	ACTION_MASTER   = "win.master"
+	ACTION_PUZZLE   = "win.puzzle"
+	ACTION_VERSUS   = "win.versus"
+	ACTION_ONLINE   = "win.online"
+	ACTION_SPECTATE = "win.spectate"
+	ACTION_DEMO     = "win.demo"
+	ACTION_COPY     = "win.copy-board"
+	ACTION_PASTE    = "win.paste-board"
+	ACTION_FUMEN    = "win.copy-fumen"
+	ACTION_STATS    = "win.stats"
 
 	ACTION_ROTATE = "win.rotate"
 	ACTION_LEFT   = "win.left"
@@ -36,29 +50,76 @@ const (
 
 	LABEL_PAUSE     = "Pause"
 	LABEL_RESUME    = "Resume"
+	LABEL_PAUSED    = "PAUSED"
 	LABEL_STARTGAME = "Start Game"
+	LABEL_SETUP     = "New Game..."
+	LABEL_PREFS     = "Preferences"
+	LABEL_MARATHON  = "Marathon"
+	LABEL_DIG       = "Dig Mode"
+	LABEL_FINESSE   = "Finesse Trainer"
+	LABEL_MASTER    = "Master Mode"
+	LABEL_PUZZLE    = "Puzzles"
+	LABEL_VERSUS    = "Versus"
+	LABEL_ONLINE    = "Online Versus"
+	LABEL_SPECTATE  = "Spectate"
+	LABEL_DEMO      = "Demo"
+	LABEL_COPY      = "Copy Board"
+	LABEL_PASTE     = "Paste Board"
+	LABEL_FUMEN     = "Copy Fumen"
+	LABEL_STATS     = "Statistics"
 
 	LABEL_SCORE = "SCORE"
 
 	UNIT_SIZE = 32
 	SPAN_SIZE = UNIT_SIZE - 2
+
+	PREVIEW_GAP = UNIT_SIZE / 4
 )
 
 var (
 	RGB_COLOR_GRAY  = Rgb{231 / 255.0, 231 / 255.0, 231 / 255.0}
 	RGB_COLOR_BLUE  = Rgb{168 / 255.0, 202 / 255.0, 1}
 	RGB_COLOR_GREEN = Rgb{132 / 255.0, 212 / 255.0, 129 / 255.0}
+	RGB_COLOR_DARK  = Rgb{150 / 255.0, 150 / 255.0, 150 / 255.0}
+	RGB_COLOR_RED   = Rgb{230 / 255.0, 90 / 255.0, 90 / 255.0}
 
-	leftDa  *gtk.DrawingArea
-	rightDa *gtk.DrawingArea
-
-	stateLabel *gtk.Label
-	scoreValue *gtk.Label
-	levelValue *gtk.Label
+	config *Config
+	demo   *aiPlayer // playing the main game, if any
 )
 
 type Rgb [3]float64
 
+// Widgets showing a game
+type view struct {
+	boardDa *gtk.DrawingArea
+	nextDa  *gtk.DrawingArea
+	holdDa  *gtk.DrawingArea
+	meterDa *gtk.DrawingArea // incoming garbage, nil if not versus
+
+	stateLabel   *gtk.Label
+	scoreValue   *gtk.Label
+	levelValue   *gtk.Label
+	finesseLabel *gtk.Label // faults in finesse mode
+	modeLabel    *gtk.Label // name & goal in puzzle mode, grade in master mode
+	pauseBtn     *gtk.Button
+	win          gtk.IWindow // of the report, nil if none
+
+	stateActions []stateAction // enabled by the state of the game
+
+	nextShapes []*Shape   // drawn by nextDa
+	hidden     bool       // the board, hold & nexts covered while paused
+	garbage    int        // drawn by meterDa
+	finesse    *finesse   // of the game, nil if not in finesse mode
+	stats      *gameStats // of the game over, nil if not over
+
+	fontSize     int // of score & level
+	finishedText string
+}
+
+func newView() *view {
+	return &view{fontSize: UNIT_SIZE, finishedText: "FINISHED"}
+}
+
 func GUI() {
 	const appID = "com.github.cloudecho.tetris"
 	application, err := gtk.ApplicationNew(appID, glib.APPLICATION_FLAGS_NONE)
@@ -66,12 +127,16 @@ func GUI() {
 		log.Fatal("Could not create application:", err)
 	}
 
+	config = LoadConfig()
+
 	// Initialize game
-	game := NewGame()
-	go showGame(game)
+	game := newConfiguredGame()
+	game.puzzleSolved = savePuzzleSolved
+	v := newView()
+	go v.show(game)
 
 	application.Connect(SIGNAL_ACTIVATE, func() {
-		win := newWindow(application, game)
+		win := newWindow(application, game, v)
 
 		aQuit := glib.SimpleActionNew("quit", nil)
 		aQuit.Connect(SIGNAL_ACTIVATE, func() {
@@ -80,46 +145,91 @@ func GUI() {
 		application.AddAction(aQuit)
 
 		win.ShowAll()
+		game.setPreviews(config.Previews)
 		game.start()
+		updateSpectatorServer(game)
 	})
 
 	os.Exit(application.Run(os.Args))
 }
 
-func showGame(g *Game) {
+// Game with settings of the config, previews are set once shown
+func newConfiguredGame() *Game {
+	g := NewGame()
+	g.setHandling(config.Handling)
+	g.setGarbage(config.Garbage, config.DigRows)
+	g.setFadeFrames(config.FadeFrames)
+	if err := g.setLevels(config.Levels, config.StartLevel); err != nil {
+		log.Println("Could not set levels:", err)
+	}
+	return g
+}
+
+func (v *view) show(g *Game) {
 	for {
 		select {
 		case mv := <-g.chanMoving:
-			showCurrentShape(mv, g)
-		case <-g.chanNexts:
-			showNextShape(g)
+			showCurrentShape(mv, g, v.boardDa)
+		case nexts := <-g.chanNexts:
+			v.showNextShapes(nexts)
+		case <-g.chanHold:
+			showHoldShape(g, v.holdDa)
+		case n := <-g.chanGarbage:
+			v.showGarbage(n)
+		case n := <-g.chanCount:
+			v.stateLabel.SetLabel(strconv.Itoa(n))
 		case state := <-g.chanState:
+			if v.hidden && state != STATE_PAUSED {
+				v.uncoverBoard(g)
+			}
 			switch state {
-			case SATE_GAMEOVER:
-				stateLabel.SetLabel("GAME OVER")
-			case STATE_GAMING:
-				stateLabel.SetLabel("")
+			case STATE_COUNTDOWN:
+				v.stateLabel.SetLabel("READY")
+			case STATE_GAMEOVER:
+				v.stateLabel.SetLabel("GAME OVER")
+				v.revealStack(g)
+				v.showGameReport()
+			case STATE_PLAYING:
+				v.stateLabel.SetLabel("")
+				v.showModeInfo(g)
 			case STATE_PAUSED:
-				stateLabel.SetLabel("PAUSED")
-			case STATE_ZERO:
+				v.stateLabel.SetLabel(LABEL_PAUSED)
+				v.coverBoard()
+			case STATE_FINISHED:
+				v.stateLabel.SetLabel(v.finishedText)
+				v.revealStack(g)
+				v.showGameReport()
+			case STATE_READY:
 				// reset gui
-				resetGui()
+				v.reset()
 			}
+			v.updatePauseButton(state)
+			v.updateActions(state)
 		case level := <-g.chanLevel:
-			levelValue.SetMarkup(markup("#000", UNIT_SIZE, strconv.Itoa(int(level))))
+			v.levelValue.SetMarkup(markup("#000", v.fontSize, strconv.Itoa(int(level))))
 		case score := <-g.chanScore:
-			scoreValue.SetMarkup(markup("#000", UNIT_SIZE, strconv.FormatUint(score, 10)))
+			v.scoreValue.SetMarkup(markup("#000", v.fontSize, strconv.FormatUint(score, 10)))
+			v.showModeInfo(g)
 		case area := <-g.chanRedraw:
-			redrawArea(area, leftDa, g)
+			redrawArea(area, v.boardDa, g)
 		case row := <-g.chanHiligh:
-			drawHiligh(row, leftDa)
+			drawHiligh(row, v.boardDa)
+		case f := <-g.chanFinesse:
+			v.showFinesse(f)
+		case s := <-g.chanStats:
+			v.stats = &s
 		}
 	}
 }
 
-func resetGui() {
-	fillBackgroud(leftDa, ROW, COL)
-	leftDa.QueueDraw()
+func (v *view) reset() {
+	fillBackgroud(v.boardDa, ROW, COL)
+	v.boardDa.QueueDraw()
+	v.showGarbage(0)
+	v.finesse = nil
+	if v.finesseLabel != nil {
+		v.finesseLabel.SetLabel("")
+	}
 }
 
 // Redraw area (top~otop rows)
@@ -128,7 +238,7 @@ func redrawArea(area *Area, da *gtk.DrawingArea, g *Game) {
 	da.Connect(SIGNAL_DRAW, func(da *gtk.DrawingArea, cr *cairo.Context) {
 		for i := area.y; i <= area.y2; i++ { // top
 			for j := 0; j < COL; j++ { // left
-				rgb := rgb(m[i][j])
+				rgb := fadedRgb(rgb(m[i][j]), g.visibility(i, j))
 				cr.SetSourceRGB(rgb[0], rgb[1], rgb[2])
 				cr.Rectangle(float64(j*UNIT_SIZE), float64(i*UNIT_SIZE), SPAN_SIZE, SPAN_SIZE)
 				cr.Fill()
@@ -160,33 +270,146 @@ func _drawHiligh(row int, da *gtk.DrawingArea, color Rgb) {
 }
 
 func rgb(v uint8) Rgb {
-	if v > 0 {
-		return RGB_COLOR_BLUE
+	switch v {
+	case CELL_EMPTY:
+		return RGB_COLOR_GRAY
+	case CELL_GARBAGE:
+		return RGB_COLOR_DARK
 	}
-	return RGB_COLOR_GRAY
+	return RGB_COLOR_BLUE
 }
 
-func showCurrentShape(mv *Moving, g *Game) {
+// The color faded into the background by the visibility
+func fadedRgb(c Rgb, visibility float64) Rgb {
+	for k := range c {
+		c[k] = RGB_COLOR_GRAY[k] + (c[k]-RGB_COLOR_GRAY[k])*visibility
+	}
+	return c
+}
+
+// Show the blocks hidden by the mode when the game is over, g.m is held
+// by the sender of the state
+func (v *view) revealStack(g *Game) {
+	if g.mode.hidesStack() {
+		redrawArea(&Area{x: 0, y: 0, x2: COL - 1, y2: ROW - 1}, v.boardDa, g)
+	}
+}
+
+func showCurrentShape(mv *Moving, g *Game, da *gtk.DrawingArea) {
 	toErase := g.currShape
-	if mv.from.equals(mv.to) {
+	if mv.from.equals(mv.to) || !mv.to.valid() {
 		toErase = g.oldShape
 	}
 
 	// erase the old shape
-	drawShape(mv.from, toErase, RGB_COLOR_GRAY, leftDa)
+	drawShape(mv.from, toErase, RGB_COLOR_GRAY, da)
 
 	// draw the current shape
-	drawShape(mv.to, g.currShape, RGB_COLOR_BLUE, leftDa)
+	drawShape(mv.to, g.currShape, RGB_COLOR_BLUE, da)
+}
+
+// Cover the board, hold & nexts while paused, not to plan ahead
+func (v *view) coverBoard() {
+	v.hidden = true
+	v.boardDa.Connect(SIGNAL_DRAW, drawCover)
+	v.boardDa.QueueDraw()
+	drawShape(Point{0, 0}, nil, RGB_COLOR_GRAY, v.holdDa)
+	v.nextDa.QueueDraw()
+}
+
+func (v *view) uncoverBoard(g *Game) {
+	v.hidden = false
+	redrawArea(&Area{x: 0, y: 0, x2: COL - 1, y2: ROW - 1}, v.boardDa, g)
+	drawShape(g.pos, g.currShape, RGB_COLOR_BLUE, v.boardDa)
+	showHoldShape(g, v.holdDa)
+	v.nextDa.QueueDraw()
+}
+
+func drawCover(da *gtk.DrawingArea, cr *cairo.Context) {
+	cr.SetSourceRGB(RGB_COLOR_DARK[0], RGB_COLOR_DARK[1], RGB_COLOR_DARK[2])
+	cr.Rectangle(0, 0, COL*UNIT_SIZE-2, ROW*UNIT_SIZE-2)
+	cr.Fill()
+
+	cr.SetSourceRGB(1, 1, 1)
+	cr.SelectFontFace("Sans", cairo.FONT_SLANT_NORMAL, cairo.FONT_WEIGHT_BOLD)
+	cr.SetFontSize(UNIT_SIZE)
+	ext := cr.TextExtents(LABEL_PAUSED)
+	cr.MoveTo((COL*UNIT_SIZE-ext.Width)/2, (ROW*UNIT_SIZE+ext.Height)/2)
+	cr.ShowText(LABEL_PAUSED)
+}
+
+func (v *view) showNextShapes(nexts []*Shape) {
+	if len(nexts) != len(v.nextShapes) {
+		v.nextDa.SetSizeRequest(SHAPE_SIZE*UNIT_SIZE, nextPanelHeight(len(nexts)))
+	}
+	v.nextShapes = nexts
+	v.nextDa.QueueDraw()
+}
+
+func (v *view) showGarbage(n int) {
+	if v.meterDa == nil {
+		return
+	}
+	v.garbage = n
+	v.meterDa.QueueDraw()
+}
+
+// Incoming garbage rows from the bottom
+func (v *view) drawMeter(da *gtk.DrawingArea, cr *cairo.Context) {
+	n := v.garbage
+	if n > ROW {
+		n = ROW
+	}
+	cr.SetSourceRGB(RGB_COLOR_GRAY[0], RGB_COLOR_GRAY[1], RGB_COLOR_GRAY[2])
+	cr.Rectangle(0, 0, UNIT_SIZE/4, ROW*UNIT_SIZE-2)
+	cr.Fill()
+	cr.SetSourceRGB(RGB_COLOR_RED[0], RGB_COLOR_RED[1], RGB_COLOR_RED[2])
+	cr.Rectangle(0, float64((ROW-n)*UNIT_SIZE), UNIT_SIZE/4, float64(n*UNIT_SIZE-2))
+	cr.Fill()
 }
 
-func showNextShape(g *Game) {
+// The first next shape in full size, the others in half
+func nextPanelHeight(n int) int {
+	if n == 0 {
+		return 0
+	}
+	return SHAPE_SIZE*UNIT_SIZE + (n-1)*(SHAPE_SIZE*UNIT_SIZE/2+PREVIEW_GAP)
+}
+
+func (v *view) drawNextShapes(da *gtk.DrawingArea, cr *cairo.Context) {
+	if v.hidden {
+		return
+	}
+	y := 0.0
+	unit := float64(UNIT_SIZE)
+	for _, s := range v.nextShapes {
+		drawBox(cr, s, 0, y, unit)
+		y += SHAPE_SIZE*unit + PREVIEW_GAP
+		unit = UNIT_SIZE / 2
+	}
+}
+
+// Draw a shape within its box at (x, y), in cells of unit size
+func drawBox(cr *cairo.Context, s *Shape, x, y, unit float64) {
+	for i := 0; i < SHAPE_SIZE; i++ { // left
+		for j := 0; j < SHAPE_SIZE; j++ { // top
+			rgb := rgb(s.data[j][i])
+			cr.SetSourceRGB(rgb[0], rgb[1], rgb[2])
+			cr.Rectangle(x+float64(i)*unit, y+float64(j)*unit, unit-2, unit-2)
+			cr.Fill()
+		}
+	}
+}
+
+func showHoldShape(g *Game, da *gtk.DrawingArea) {
 	pos := Point{0, 0}
 
 	// erase the old shape
-	drawShape(pos, nil, RGB_COLOR_GRAY, rightDa)
+	drawShape(pos, nil, RGB_COLOR_GRAY, da)
 
-	// draw the current shape
-	drawShape(pos, g.nextShape, RGB_COLOR_BLUE, rightDa)
+	if g.holdShape != nil {
+		drawShape(pos, g.holdShape, RGB_COLOR_BLUE, da)
+	}
 }
 
 func drawShape(pos Point, shape *Shape, rgb Rgb, da *gtk.DrawingArea) {
@@ -195,7 +418,7 @@ func drawShape(pos Point, shape *Shape, rgb Rgb, da *gtk.DrawingArea) {
 	}
 
 	var a *Area
-	if shape == nil { // for erase & rightDa
+	if shape == nil { // for erase & holdDa
 		a = &Area{x: 0, y: 0, x2: SHAPE_SIZE - 1, y2: SHAPE_SIZE - 1}
 	} else {
 		a = shape.area(pos)
@@ -220,20 +443,25 @@ func drawShape(pos Point, shape *Shape, rgb Rgb, da *gtk.DrawingArea) {
 	da.QueueDraw()
 }
 
-func newWindow(application *gtk.Application, g *Game) *gtk.ApplicationWindow {
+func newWindow(application *gtk.Application, g *Game, v *view) *gtk.ApplicationWindow {
 	win, err := gtk.ApplicationWindowNew(application)
 	if err != nil {
 		log.Fatal("Unable to create window:", err)
 	}
 
 	win.SetTitle("TETRIS")
-	initTitleBar(win, g)
+	initTitleBar(win, g, v)
+	v.win = win
 
 	// Left & Right panels
 	box, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 10)
-	initLeftPanel(box)
-	initRightPanel(box)
-	addMovingButtonActions(win, g)
+	initHoldPanel(box, v)
+	initLeftPanel(box, v)
+	initNextPanel(box, v)
+	initRightPanel(box, v)
+	addMovingButtonActions(win, g, v)
+	connectAutoPause(win, g.autoPause)
+	v.updateActions(STATE_READY)
 
 	// Assemble the window
 	win.Add(box)
@@ -242,7 +470,7 @@ func newWindow(application *gtk.Application, g *Game) *gtk.ApplicationWindow {
 	return win
 }
 
-func initTitleBar(win *gtk.ApplicationWindow, g *Game) {
+func initTitleBar(win *gtk.ApplicationWindow, g *Game, v *view) {
 	// Create a header bar
 	header, err := gtk.HeaderBarNew()
 	if err != nil {
@@ -262,6 +490,21 @@ func initTitleBar(win *gtk.ApplicationWindow, g *Game) {
 	// Actions with the prefix 'win' reference actions on the current window (specific to ApplicationWindow)
 	// Other prefixes can be added to widgets via InsertActionGroup
 	menu.Append(LABEL_STARTGAME, ACTION_NEWGAME)
+	menu.Append(LABEL_SETUP, ACTION_SETUP)
+	menu.Append(LABEL_MARATHON, ACTION_MARATHON)
+	menu.Append(LABEL_DIG, ACTION_DIG)
+	menu.Append(LABEL_FINESSE, ACTION_FINESSE)
+	menu.Append(LABEL_MASTER, ACTION_MASTER)
+	menu.Append(LABEL_PUZZLE, ACTION_PUZZLE)
+	menu.Append(LABEL_VERSUS, ACTION_VERSUS)
+	menu.Append(LABEL_ONLINE, ACTION_ONLINE)
+	menu.Append(LABEL_SPECTATE, ACTION_SPECTATE)
+	menu.Append(LABEL_DEMO, ACTION_DEMO)
+	menu.Append(LABEL_COPY, ACTION_COPY)
+	menu.Append(LABEL_PASTE, ACTION_PASTE)
+	menu.Append(LABEL_FUMEN, ACTION_FUMEN)
+	menu.Append(LABEL_STATS, ACTION_STATS)
+	menu.Append(LABEL_PREFS, ACTION_PREFS)
 	menu.Append("Quit", ACTION_QUIT)
 
 	// Create a new menu button
@@ -276,16 +519,16 @@ func initTitleBar(win *gtk.ApplicationWindow, g *Game) {
 	header.PackStart(mbtn)
 
 	// Title buttons
-	btnPause := btnPause()
+	v.pauseBtn = btnPause()
 	btnStart := btnStart()
 
 	// Add title buttons to the end
 	buttonBox, _ := gtk.ButtonBoxNew(gtk.ORIENTATION_HORIZONTAL)
 	buttonBox.Add(btnStart)
-	buttonBox.Add(btnPause)
+	buttonBox.Add(v.pauseBtn)
 	header.PackEnd(buttonBox)
 
-	addTitleButtonActions(win, btnPause, g)
+	addTitleButtonActions(win, g, v)
 	win.SetTitlebar(header)
 }
 
@@ -304,43 +547,188 @@ func btnStart() *gtk.Button {
 	return btn
 }
 
-func addTitleButtonActions(win *gtk.ApplicationWindow, btnPause *gtk.Button, g *Game) {
-	addActionTo(win, simpleActionName4Win(ACTION_NEWGAME), func() {
+func addTitleButtonActions(win *gtk.ApplicationWindow, g *Game, v *view) {
+	a := addActionTo(win, simpleActionName4Win(ACTION_NEWGAME), func() {
 		g.start()
 	})
+	v.enableBy(a, func(s State) bool { return s == STATE_READY || s.over() })
+
+	addActionTo(win, simpleActionName4Win(ACTION_SETUP), func() {
+		showNewGameDialog(win, g)
+	})
+
+	addActionTo(win, simpleActionName4Win(ACTION_MARATHON), func() {
+		g.setMode(MODE_MARATHON)
+		g.restart()
+	})
+
+	addActionTo(win, simpleActionName4Win(ACTION_DIG), func() {
+		g.setMode(MODE_DIG)
+		g.restart()
+	})
+
+	addActionTo(win, simpleActionName4Win(ACTION_FINESSE), func() {
+		g.setMode(MODE_FINESSE)
+		g.restart()
+	})
+
+	addActionTo(win, simpleActionName4Win(ACTION_MASTER), func() {
+		g.setMode(MODE_MASTER)
+		g.restart()
+	})
+
+	addActionTo(win, simpleActionName4Win(ACTION_PUZZLE), func() {
+		showPuzzleDialog(win, g)
+	})
+
+	addActionTo(win, simpleActionName4Win(ACTION_VERSUS), func() {
+		go g.pause()
+		showVersusWindow(win)
+	})
+
+	addActionTo(win, simpleActionName4Win(ACTION_ONLINE), func() {
+		go g.pause()
+		showOnlineDialog(win)
+	})
+
+	addActionTo(win, simpleActionName4Win(ACTION_SPECTATE), func() {
+		showSpectateDialog(win)
+	})
+
+	addActionTo(win, simpleActionName4Win(ACTION_DEMO), func() {
+		if demo != nil {
+			demo.stop()
+		}
+		demo = startDemo(g, configuredWeights())
+	})
 
-	addActionTo(win, simpleActionName4Win(ACTION_PAUSE), func() {
-		btnPause.SetLabel(LABEL_RESUME)
-		btnPause.SetActionName(ACTION_RESUME)
+	a = addActionTo(win, simpleActionName4Win(ACTION_COPY), func() {
+		copyBoard(g)
+	})
+	v.enableBy(a, State.running)
+
+	a = addActionTo(win, simpleActionName4Win(ACTION_PASTE), func() {
+		pasteBoard(win, g)
+	})
+	v.enableBy(a, State.running)
+
+	a = addActionTo(win, simpleActionName4Win(ACTION_FUMEN), func() {
+		copyFumen(g)
+	})
+	v.enableBy(a, State.running)
+
+	a = addActionTo(win, simpleActionName4Win(ACTION_PAUSE), func() {
 		g.pause()
 	})
+	v.enableBy(a, func(s State) bool { return s.check(STATE_PAUSED) == nil })
 
-	addActionTo(win, simpleActionName4Win(ACTION_RESUME), func() {
-		btnPause.SetLabel(LABEL_PAUSE)
-		btnPause.SetActionName(ACTION_PAUSE)
+	a = addActionTo(win, simpleActionName4Win(ACTION_RESUME), func() {
 		g.resume()
 	})
+	v.enableBy(a, func(s State) bool { return s == STATE_PAUSED })
+
+	addActionTo(win, simpleActionName4Win(ACTION_STATS), func() {
+		showStatsDialog(win)
+	})
+
+	addActionTo(win, simpleActionName4Win(ACTION_PREFS), func() {
+		showPrefsDialog(win, g)
+	})
+}
+
+// The pause button toggles between pause & resume
+func (v *view) updatePauseButton(state State) {
+	if v.pauseBtn == nil {
+		return
+	}
+	if state == STATE_PAUSED {
+		v.pauseBtn.SetLabel(LABEL_RESUME)
+		v.pauseBtn.SetActionName(ACTION_RESUME)
+	} else {
+		v.pauseBtn.SetLabel(LABEL_PAUSE)
+		v.pauseBtn.SetActionName(ACTION_PAUSE)
+	}
+}
+
+// An action, and the states of the game it is enabled in
+type stateAction struct {
+	action  *glib.SimpleAction
+	enabled func(State) bool
+}
+
+func (v *view) enableBy(a *glib.SimpleAction, enabled func(State) bool) {
+	v.stateActions = append(v.stateActions, stateAction{a, enabled})
+}
+
+// Enable the actions by the state, and so the buttons & menu items of them
+func (v *view) updateActions(state State) {
+	for _, a := range v.stateActions {
+		a.action.SetEnabled(a.enabled(state))
+	}
 }
 
 // Create an action in the win action group
 func addActionTo(
 	win *gtk.ApplicationWindow,
 	actionName string,
-	activateFunc func()) {
+	activateFunc func()) *glib.SimpleAction {
 	a := glib.SimpleActionNew(actionName, nil)
 	a.Connect(SIGNAL_ACTIVATE, activateFunc)
 	win.AddAction(a)
+	return a
 }
 
-func initLeftPanel(parent *gtk.Box) {
+func initLeftPanel(parent *gtk.Box, v *view) {
 	da, _ := gtk.DrawingAreaNew()
 	fillBackgroud(da, ROW, COL)
 	da.SetSizeRequest(COL*UNIT_SIZE, (ROW+1)*UNIT_SIZE)
-	leftDa = da
+	v.boardDa = da
 
 	parent.PackStart(da, true, true, 10)
 }
 
+// The incoming garbage meter next to the board
+func initMeter(parent *gtk.Box, v *view) {
+	da, _ := gtk.DrawingAreaNew()
+	da.Connect(SIGNAL_DRAW, v.drawMeter)
+	da.SetSizeRequest(UNIT_SIZE/4, ROW*UNIT_SIZE)
+	v.meterDa = da
+
+	parent.PackStart(da, false, false, 0)
+}
+
+func initHoldPanel(parent *gtk.Box, v *view) {
+	holdLabel, _ := gtk.LabelNew("")
+	holdLabel.SetMarkup(markup("#000", UNIT_SIZE/2, "HOLD"))
+
+	da, _ := gtk.DrawingAreaNew()
+	fillBackgroud(da, SHAPE_SIZE, SHAPE_SIZE)
+	da.SetSizeRequest(SHAPE_SIZE*UNIT_SIZE, SHAPE_SIZE*UNIT_SIZE)
+	v.holdDa = da
+
+	grid, _ := gtk.GridNew()
+	grid.Attach(holdLabel, 0, 0, 1, 1)
+	grid.Attach(da, 0, 1, 1, 1)
+
+	parent.PackStart(grid, false, false, 10)
+}
+
+func initNextPanel(parent *gtk.Box, v *view) {
+	nextLabel, _ := gtk.LabelNew("")
+	nextLabel.SetMarkup(markup("#000", UNIT_SIZE/2, "NEXT"))
+
+	da, _ := gtk.DrawingAreaNew()
+	da.Connect(SIGNAL_DRAW, v.drawNextShapes)
+	da.SetSizeRequest(SHAPE_SIZE*UNIT_SIZE, 0)
+	v.nextDa = da
+
+	grid, _ := gtk.GridNew()
+	grid.Attach(nextLabel, 0, 0, 1, 1)
+	grid.Attach(da, 0, 1, 1, 1)
+
+	parent.PackStart(grid, false, false, 10)
+}
+
 func fillBackgroud(da *gtk.DrawingArea, row, col int) {
 	da.Connect(SIGNAL_DRAW, func(da *gtk.DrawingArea, cr *cairo.Context) {
 		cr.SetSourceRGB(RGB_COLOR_GRAY[0], RGB_COLOR_GRAY[1], RGB_COLOR_GRAY[2])
@@ -353,17 +741,10 @@ func fillBackgroud(da *gtk.DrawingArea, row, col int) {
 	})
 }
 
-func initRightPanel(parent *gtk.Box) {
-	initValueLabels()
+func initRightPanel(parent *gtk.Box, v *view) {
+	initValueLabels(v)
 	btnRotate, btnLeft, btnRight, btnDown := initMovingButtons()
 
-	da, _ := gtk.DrawingAreaNew()
-	fillBackgroud(da, SHAPE_SIZE, SHAPE_SIZE)
-	da.SetSizeRequest(SHAPE_SIZE*UNIT_SIZE, SHAPE_SIZE*UNIT_SIZE)
-	da.SetMarginTop(UNIT_SIZE)
-	rightDa = da
-
-	stateLabel, _ = gtk.LabelNew("")
 	scoreLabel, _ := gtk.LabelNew("")
 	levelLabel, _ := gtk.LabelNew("")
 	separator1, _ := gtk.LabelNew("")
@@ -372,29 +753,28 @@ func initRightPanel(parent *gtk.Box) {
 	separator4, _ := gtk.LabelNew("")
 
 	scoreLabel.SetMarkup(markup("#000", UNIT_SIZE, "SCORE"))
-	scoreValue.SetMarkup(markup("#000", UNIT_SIZE, "0"))
 	levelLabel.SetMarkup(markup("#000", UNIT_SIZE, "LEVEL"))
-	levelValue.SetMarkup(markup("#000", UNIT_SIZE, "0"))
 	separator1.SetMarkup(markup("#000", UNIT_SIZE, " "))
 	separator2.SetMarkup(markup("#000", UNIT_SIZE/2, " "))
 	separator3.SetMarkup(markup("#000", UNIT_SIZE/2, " "))
 	separator4.SetMarkup(markup("#000", UNIT_SIZE/2, " "))
 
 	grid, _ := gtk.GridNew()
-	grid.Attach(da, 0, 0, 3, 1)
 	grid.Attach(separator1, 0, 1, 3, 1)
 	grid.Attach(scoreLabel, 0, 2, 3, 1)
-	grid.Attach(scoreValue, 0, 3, 3, 1)
+	grid.Attach(v.scoreValue, 0, 3, 3, 1)
 	grid.Attach(separator2, 0, 4, 3, 1)
 	grid.Attach(levelLabel, 0, 5, 3, 1)
-	grid.Attach(levelValue, 0, 6, 3, 1)
+	grid.Attach(v.levelValue, 0, 6, 3, 1)
 	grid.Attach(separator3, 0, 7, 3, 1)
 	grid.Attach(btnRotate, 1, 8, 1, 1)
 	grid.Attach(btnLeft, 0, 9, 1, 1)
 	grid.Attach(btnRight, 2, 9, 1, 1)
 	grid.Attach(btnDown, 1, 10, 1, 1)
 	grid.Attach(separator4, 0, 11, 3, 1)
-	grid.Attach(stateLabel, 0, 12, 3, 1)
+	grid.Attach(v.stateLabel, 0, 12, 3, 1)
+	grid.Attach(v.finesseLabel, 0, 13, 3, 1)
+	grid.Attach(v.modeLabel, 0, 14, 3, 1)
 
 	parent.PackEnd(grid, true, true, 10)
 }
@@ -405,9 +785,14 @@ func markup(color string, fontSize int, text string) string {
 		color, fontSize, text)
 }
 
-func initValueLabels() {
-	scoreValue, _ = gtk.LabelNew("")
-	levelValue, _ = gtk.LabelNew("")
+func initValueLabels(v *view) {
+	v.stateLabel, _ = gtk.LabelNew("")
+	v.scoreValue, _ = gtk.LabelNew("")
+	v.levelValue, _ = gtk.LabelNew("")
+	v.finesseLabel, _ = gtk.LabelNew("")
+	v.modeLabel, _ = gtk.LabelNew("")
+	v.scoreValue.SetMarkup(markup("#000", v.fontSize, "0"))
+	v.levelValue.SetMarkup(markup("#000", v.fontSize, "0"))
 }
 
 func initMovingButtons() (*gtk.Button, *gtk.Button, *gtk.Button, *gtk.Button) {
@@ -424,45 +809,110 @@ func initMovingButtons() (*gtk.Button, *gtk.Button, *gtk.Button, *gtk.Button) {
 	return btnRotate, btnLeft, btnRight, btnDown
 }
 
-var chanKey chan uint = make(chan uint, 1)
+func addMovingButtonActions(win *gtk.ApplicationWindow, g *Game, v *view) {
+	connectKeys(win, func(key uint, pressed bool) bool {
+		c, found := config.Keys.lookup(key)
+		if !found {
+			return false
+		}
+		if !pressed {
+			g.release(c)
+			return true
+		}
+
+		// any key ends the demo, and starts a game
+		if demo != nil && demo.stop() {
+			go g.restart()
+			return true
+		}
+
+		// Not to block the gui while the game is busy
+		switch c {
+		case CTRL_PAUSE:
+			go g.togglePause()
+		case CTRL_RESTART:
+			go g.restart()
+		default:
+			g.press(c)
+		}
+		return true
+	}, g.releaseAll)
 
-func addMovingButtonActions(win *gtk.ApplicationWindow, g *Game) {
-	keyMap := map[uint]func(){
-		KEY_LEFT:  func() { g.moveLeft() },
-		KEY_UP:    func() { g.rotate() },
-		KEY_RIGHT: func() { g.moveRight() },
-		KEY_DOWN:  func() { g.dropDown() },
+	// the buttons are keys tapped, on the frames of the inputs
+	tap := func(c Control) func() {
+		return func() { g.tap(c) }
 	}
+	v.enableBy(addActionTo(win, simpleActionName4Win(ACTION_ROTATE), tap(CTRL_ROTATE)), State.active)
+	v.enableBy(addActionTo(win, simpleActionName4Win(ACTION_LEFT), tap(CTRL_LEFT)), State.active)
+	v.enableBy(addActionTo(win, simpleActionName4Win(ACTION_RIGHT), tap(CTRL_RIGHT)), State.active)
+	v.enableBy(addActionTo(win, simpleActionName4Win(ACTION_DOWN), tap(CTRL_HARD_DROP)), State.active)
+}
+
+type signalConnector interface {
+	Connect(string, interface{}) glib.SignalHandle
+}
 
-	win.Connect(SIGNAL_KEY_PRESS_EVENT, func(win *gtk.ApplicationWindow, ev *gdk.Event) {
-		// Discard if chanKey not empty
-		if len(chanKey) > 0 {
-			return
+// Route key presses & releases of w to handle, which returns true if
+// the key is handled. Key repeats are discarded, and all keys are
+// released on focus lost as their releases would be lost
+func connectKeys(w signalConnector, handle func(key uint, pressed bool) bool, releaseAll func()) {
+	// keys being held
+	keysDown := make(map[uint]bool)
+
+	w.Connect(SIGNAL_KEY_PRESS_EVENT, func(_ interface{}, ev *gdk.Event) bool {
+		keyVal := gdk.KeyvalToLower((&gdk.EventKey{ev}).KeyVal())
+		if keysDown[keyVal] {
+			return true
 		}
-		keyEvent := &gdk.EventKey{ev}
-		keyVal := keyEvent.KeyVal()
-		if _, found := keyMap[keyVal]; found {
-			chanKey <- keyVal
+		if !handle(keyVal, true) {
+			return false
 		}
+		keysDown[keyVal] = true
+		return true
 	})
 
-	go func() {
-		for {
-			k := <-chanKey
-			if action, found := keyMap[k]; found {
-				action()
-			}
-			// To avoid too frequently key events
-			time.Sleep(time.Millisecond * 100)
+	w.Connect(SIGNAL_KEY_RELEASE_EVENT, func(_ interface{}, ev *gdk.Event) bool {
+		keyVal := gdk.KeyvalToLower((&gdk.EventKey{ev}).KeyVal())
+		delete(keysDown, keyVal)
+		return handle(keyVal, false)
+	})
+
+	w.Connect(SIGNAL_FOCUS_OUT_EVENT, func() {
+		keysDown = make(map[uint]bool)
+		releaseAll()
+	})
+}
+
+// Pause when w loses focus or is minimised, if enabled in the config
+func connectAutoPause(w signalConnector, pause func()) {
+	w.Connect(SIGNAL_FOCUS_OUT_EVENT, func() {
+		if config.AutoPause {
+			go pause()
 		}
-	}()
+	})
 
-	addActionTo(win, simpleActionName4Win(ACTION_ROTATE), keyMap[KEY_UP])
-	addActionTo(win, simpleActionName4Win(ACTION_LEFT), keyMap[KEY_LEFT])
-	addActionTo(win, simpleActionName4Win(ACTION_RIGHT), keyMap[KEY_RIGHT])
-	addActionTo(win, simpleActionName4Win(ACTION_DOWN), keyMap[KEY_DOWN])
+	w.Connect(SIGNAL_WINDOW_STATE, func(_ interface{}, ev *gdk.Event) bool {
+		s := gdk.EventWindowStateNewFromEvent(ev)
+		if config.AutoPause && s.NewWindowState()&gdk.WINDOW_STATE_ICONIFIED != 0 {
+			go pause()
+		}
+		return false
+	})
 }
 
 func simpleActionName4Win(fullname string) string {
 	return strings.TrimPrefix(fullname, "win.")
 }
+
+// Weights of the file in the config, the defaults if none or bad
+func configuredWeights() *aiWeights {
+	if config.AIWeights == "" {
+		return defaultWeights()
+	}
+	w, err := loadWeights(config.AIWeights)
+	if err != nil {
+		log.Println("could not load AI weights:", err)
+		return defaultWeights()
+	}
+	return w
+}
@@ -0,0 +1,31 @@
+package tetris
+
+// Game without ui, e.g. for tests & network peers,
+// the notifications are discarded
+func newHeadlessGame() *Game {
+	g := NewGame()
+	go g.discardEvents(nil)
+	return g
+}
+
+// Read all notifications of g and drop them, until done is closed
+func (g *Game) discardEvents(done chan bool) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-g.chanMoving:
+		case <-g.chanRedraw:
+		case <-g.chanHiligh:
+		case <-g.chanLevel:
+		case <-g.chanScore:
+		case <-g.chanState:
+		case <-g.chanCount:
+		case <-g.chanNexts:
+		case <-g.chanHold:
+		case <-g.chanGarbage:
+		case <-g.chanFinesse:
+		case <-g.chanStats:
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package tetris
+
+import (
+	"fmt"
+	"log"
+)
+
+const INPUT_QUEUE_SIZE = 64
+
+// Handling settings, all in frames (see FPS)
+type Handling struct {
+	DAS            int  `json:"das"`              // delayed auto shift
+	ARR            int  `json:"arr"`              // auto repeat rate, 0 = instant
+	SoftDropFactor int  `json:"soft_drop_factor"` // gravity multiplier, 0 = instant
+	EntryDelay     int  `json:"entry_delay"`      // frames before the next shape moves
+	ChargeDAS      bool `json:"charge_das"`       // charge DAS during entry delay
+}
+
+func DefaultHandling() Handling {
+	return Handling{
+		DAS:            10,
+		ARR:            2,
+		SoftDropFactor: 20,
+		EntryDelay:     6,
+		ChargeDAS:      true,
+	}
+}
+
+// A key press or release of a control
+type inputEvent struct {
+	control Control
+	pressed bool
+}
+
+// Text form on the wire, e.g. "+left" for pressed, "-left" for released
+func (e inputEvent) MarshalText() ([]byte, error) {
+	sign := "-"
+	if e.pressed {
+		sign = "+"
+	}
+	return []byte(sign + e.control.String()), nil
+}
+
+func (e *inputEvent) UnmarshalText(text []byte) error {
+	if len(text) == 0 || (text[0] != '+' && text[0] != '-') {
+		return fmt.Errorf("bad input %q", text)
+	}
+	c, err := controlByName(string(text[1:]))
+	if err != nil {
+		return err
+	}
+	e.control = c
+	e.pressed = text[0] == '+'
+	return nil
+}
+
+// Input state, only touched by the game loop
+type input struct {
+	held    [CONTROLS]bool
+	pressed [CONTROLS]bool // pressed since the last frame
+	shift   Control        // current horizontal direction, -1 if none
+	das     int            // frames the shift key has been held
+	arr     int            // frames until the next auto shift
+	presses int            // of moves & rotations since the shape landed, for finesse
+	keys    int            // of the game, for stats
+}
+
+func newInput() input {
+	return input{shift: -1}
+}
+
+func (in *input) apply(e inputEvent) {
+	c := e.control
+
+	if !e.pressed {
+		in.held[c] = false
+		if c == in.shift {
+			// fall back to the opposite direction if it's still held
+			in.shift = -1
+			if o := opposite(c); in.held[o] {
+				in.startShift(o)
+			}
+		}
+		return
+	}
+
+	if in.held[c] { // key repeat
+		return
+	}
+	in.held[c] = true
+	in.pressed[c] = true
+	in.keys++
+	if finesseControl(c) {
+		in.presses++
+	}
+	if c == CTRL_LEFT || c == CTRL_RIGHT {
+		in.startShift(c)
+	}
+}
+
+func (in *input) startShift(c Control) {
+	in.shift = c
+	in.das = 0
+	in.arr = 0
+}
+
+func opposite(c Control) Control {
+	if c == CTRL_LEFT {
+		return CTRL_RIGHT
+	}
+	return CTRL_LEFT
+}
+
+// Queue a key press, it's processed on the next frame
+func (g *Game) press(c Control) {
+	g.sendInput(inputEvent{c, true})
+}
+
+// Queue a key release, it's processed on the next frame
+func (g *Game) release(c Control) {
+	g.sendInput(inputEvent{c, false})
+}
+
+// Queue a press & release, e.g. of a button clicked
+func (g *Game) tap(c Control) {
+	g.press(c)
+	g.release(c)
+}
+
+// Release all held controls, e.g. on focus lost
+func (g *Game) releaseAll() {
+	for c := CTRL_LEFT; c < CONTROLS; c++ {
+		g.release(c)
+	}
+}
+
+func (g *Game) sendInput(e inputEvent) {
+	select {
+	case g.chanInput <- e:
+	default:
+		log.Println("input queue is full, discard", e.control)
+	}
+}
+
+func (g *Game) setHandling(h Handling) {
+	g.m.Lock()
+	defer g.m.Unlock()
+	g.handling = h
+}
+
+// Take the queued inputs, for a lockstep driver to stamp them with frames
+func (g *Game) takeInputs() []inputEvent {
+	var events []inputEvent
+	for n := len(g.chanInput); n > 0; n-- {
+		events = append(events, <-g.chanInput)
+	}
+	return events
+}
+
+// Process the inputs applied in this frame, the caller should hold g.m
+func (g *Game) handleInput() {
+	in := &g.input
+	h := &g.handling
+
+	if in.shift >= 0 {
+		if g.entry > 0 && !h.ChargeDAS {
+			in.das = 0
+		} else {
+			in.das++
+		}
+	}
+
+	// presses are kept until the shape enters
+	if g.entry > 0 {
+		return
+	}
+	defer func() { in.pressed = [CONTROLS]bool{} }()
+
+	if in.pressed[CTRL_HOLD] {
+		g.swapHold()
+	}
+	if in.pressed[CTRL_ROTATE] {
+		g.tryRotate((*Shape).rotate)
+	}
+	if in.pressed[CTRL_ROTATE_CCW] {
+		g.tryRotate((*Shape).rotateCCW)
+	}
+	if in.pressed[CTRL_ROTATE_180] {
+		g.tryRotate((*Shape).rotate180)
+	}
+
+	if in.pressed[CTRL_LEFT] {
+		g.tryMove((*Shape).moveLeft)
+	}
+	if in.pressed[CTRL_RIGHT] {
+		g.tryMove((*Shape).moveRight)
+	}
+	if in.shift >= 0 && !in.pressed[in.shift] && in.das >= h.DAS {
+		g.autoShift()
+	}
+
+	if in.pressed[CTRL_HARD_DROP] {
+		g.dropDown()
+		g.lockShape()
+	}
+}
+
+// Auto repeat the shift, the caller should hold g.m
+func (g *Game) autoShift() {
+	in := &g.input
+	move := (*Shape).moveLeft
+	if in.shift == CTRL_RIGHT {
+		move = (*Shape).moveRight
+	}
+
+	if g.handling.ARR == 0 {
+		// at 1G or more, the shape falls into the gaps on the way
+		falls := g.gravity() >= GRAVITY_G
+		for g.tryMove(move) {
+			if falls && g.tryMove((*Shape).moveDown) {
+				g.dropDown()
+				g.locking = 0 // reset by the rows fallen
+			}
+		}
+		return
+	}
+
+	if in.arr > 0 {
+		in.arr--
+	}
+	if in.arr == 0 {
+		in.arr = g.handling.ARR
+		g.tryMove(move)
+	}
+}
@@ -0,0 +1,132 @@
+package tetris
+
+import (
+	"reflect"
+	"testing"
+)
+
+// A stepped game of the mode & handling, falling at the gravity unless
+// master, the board & shape of the notation
+func handlingGame(t *testing.T, mode Mode, h Handling, gravity Gravity, text string) *Game {
+	t.Helper()
+	n, err := parseNotation(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := newHeadlessGame()
+	g.setMode(mode)
+	g.setHandling(h)
+	if err := g.setLevels(LevelCurve{Rule: LEVEL_FIXED, Lines: ROW, Gravity: []Gravity{gravity}}, 0); err != nil {
+		t.Fatal(err)
+	}
+	g.stepped = true
+	g.start()
+	if err := g.loadNotation(n); err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+// Columns of the box of the shape after each frame, holding the control
+// from the first one
+func holdFrames(g *Game, c Control, frames int) []int {
+	var cols []int
+	for k := 0; k < frames; k++ {
+		var events []inputEvent
+		if k == 0 {
+			events = []inputEvent{{c, true}}
+		}
+		g.step(events)
+		g.m.Lock()
+		cols = append(cols, g.pos.left)
+		g.m.Unlock()
+	}
+	return cols
+}
+
+// The O is in the middle columns of its box, from the left wall
+func TestAutoShift(t *testing.T) {
+	const (
+		flat = "current: 53\npos: -1 0\nboard:\n..........."
+		gap  = "current: 53\npos: -1 0\nboard:\nXXXX..XXXXX\nXXXX..XXXXX"
+	)
+	slow := gravityPer(1000)
+	tests := []struct {
+		name     string
+		mode     Mode // of 20G & lock delay if master, else of the gravity
+		handling Handling
+		gravity  Gravity
+		board    string
+		entry    int   // frames of the entry delay at the first
+		want     []int // columns after each frame
+		bottom   int   // row of the bottom of the shape at last
+	}{
+		{"DAS 10, ARR 2", MODE_MARATHON, Handling{DAS: 10, ARR: 2}, slow, flat, 0,
+			[]int{0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4}, 1},
+		{"ARR 0", MODE_MARATHON, Handling{DAS: 10, ARR: 0}, slow, flat, 0,
+			[]int{0, 0, 0, 0, 0, 0, 0, 0, 0, 8, 8}, 1},
+		{"ARR 0 at 20G over a gap", MODE_MASTER, Handling{DAS: 10, ARR: 0}, MAX_GRAVITY, gap, 0,
+			[]int{0, 0, 0, 0, 0, 0, 0, 0, 0, 3, 3}, ROW - 1},
+		{"ARR 0 slow over a gap", MODE_MARATHON, Handling{DAS: 10, ARR: 0}, slow, gap, 0,
+			[]int{0, 0, 0, 0, 0, 0, 0, 0, 0, 8, 8}, 1},
+		{"DAS charged", MODE_MARATHON, Handling{DAS: 4, ARR: 1, ChargeDAS: true}, slow, flat, 4,
+			[]int{-1, -1, -1, -1, 0, 1, 2, 3}, 1},
+		{"DAS not charged", MODE_MARATHON, Handling{DAS: 4, ARR: 1}, slow, flat, 4,
+			[]int{-1, -1, -1, -1, 0, 0, 0, 1}, 1},
+	}
+	for _, test := range tests {
+		g := handlingGame(t, test.mode, test.handling, test.gravity, test.board)
+		g.m.Lock()
+		g.entry = test.entry
+		g.m.Unlock()
+		got := holdFrames(g, CTRL_RIGHT, len(test.want))
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: columns %v, want %v", test.name, got, test.want)
+		}
+		g.m.Lock()
+		if bottom := g.pos.top + g.currShape.bounds().y2; bottom != test.bottom {
+			t.Errorf("%s: bottom at row %d, want %d", test.name, bottom, test.bottom)
+		}
+		g.m.Unlock()
+	}
+}
+
+// Rows fallen holding soft drop, no faster than 1G unless the level is
+func TestSoftDrop(t *testing.T) {
+	const text = "current: 53\npos: 4 0\nboard:\n..........."
+	tests := []struct {
+		name    string
+		factor  int
+		gravity Gravity
+		frames  int
+		want    int // top of the box
+	}{
+		{"factor 20", 20, gravityPer(60), 9, 3},
+		{"no faster than 1G", 20, gravityPer(2), 4, 4},
+		{"at 2G", 20, 2 * GRAVITY_G, 4, 8},
+		{"instant", 0, gravityPer(60), 1, ROW - 2},
+	}
+	for _, test := range tests {
+		g := handlingGame(t, MODE_MARATHON, Handling{SoftDropFactor: test.factor}, test.gravity, text)
+		holdFrames(g, CTRL_SOFT_DROP, test.frames)
+		g.m.Lock()
+		if g.pos.top != test.want {
+			t.Errorf("%s: top %d after %d frames, want %d", test.name, g.pos.top, test.frames, test.want)
+		}
+		g.m.Unlock()
+	}
+}
+
+// A button clicked is a key pressed & released in a frame, counted as one
+func TestTap(t *testing.T) {
+	g := handlingGame(t, MODE_MARATHON, DefaultHandling(), gravityPer(1000), "current: 53\npos: 4 0\nboard:\n...........")
+	g.tap(CTRL_RIGHT)
+	g.tap(CTRL_ROTATE)
+	g.step(g.takeInputs())
+
+	g.m.Lock()
+	defer g.m.Unlock()
+	if g.pos.left != 5 || g.input.keys != 2 || g.input.presses != 2 || g.input.held != [CONTROLS]bool{} {
+		t.Errorf("at %+v, %d keys, %d presses, held %v", g.pos, g.input.keys, g.input.presses, g.input.held)
+	}
+}
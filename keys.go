@@ -0,0 +1,183 @@
+package tetris
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Key values, same as GDK_KEY_*
+const (
+	KEY_SPACE     uint = 0x0020
+	KEY_A         uint = 0x0061
+	KEY_C         uint = 0x0063
+	KEY_D         uint = 0x0064
+	KEY_E         uint = 0x0065
+	KEY_P         uint = 0x0070
+	KEY_Q         uint = 0x0071
+	KEY_S         uint = 0x0073
+	KEY_W         uint = 0x0077
+	KEY_X         uint = 0x0078
+	KEY_Z         uint = 0x007a
+	KEY_RETURN    uint = 0xff0d
+	KEY_ESCAPE    uint = 0xff1b
+	KEY_LEFT      uint = 0xff51
+	KEY_UP        uint = 0xff52
+	KEY_RIGHT     uint = 0xff53
+	KEY_DOWN      uint = 0xff54
+	KEY_F2        uint = 0xffbf
+	KEY_SHIFT_L   uint = 0xffe1
+	KEY_SHIFT_R   uint = 0xffe2
+	KEY_CONTROL_L uint = 0xffe3
+	KEY_CONTROL_R uint = 0xffe4
+)
+
+// Control is a game action which could be bound to keys
+type Control int
+
+const (
+	CTRL_LEFT Control = iota
+	CTRL_RIGHT
+	CTRL_ROTATE
+	CTRL_ROTATE_CCW
+	CTRL_ROTATE_180
+	CTRL_SOFT_DROP
+	CTRL_HARD_DROP
+	CTRL_HOLD
+	CTRL_PAUSE
+	CTRL_RESTART
+
+	CONTROLS // number of controls
+)
+
+var (
+	// names used in the config file
+	controlNames = [CONTROLS]string{
+		"left", "right", "rotate", "rotate_ccw", "rotate_180",
+		"soft_drop", "hard_drop", "hold", "pause", "restart",
+	}
+
+	// labels shown in the preferences dialog
+	controlLabels = [CONTROLS]string{
+		"Move Left", "Move Right", "Rotate", "Rotate Counterclockwise", "Rotate 180",
+		"Soft Drop", "Hard Drop", "Hold", "Pause", "Restart",
+	}
+)
+
+func (c Control) String() string {
+	return controlNames[c]
+}
+
+func (c Control) Label() string {
+	return controlLabels[c]
+}
+
+// KeyBindings maps each control to its keys, multiple keys per control
+type KeyBindings [CONTROLS][]uint
+
+func DefaultKeyBindings() *KeyBindings {
+	return &KeyBindings{
+		CTRL_LEFT:       {KEY_LEFT},
+		CTRL_RIGHT:      {KEY_RIGHT},
+		CTRL_ROTATE:     {KEY_UP, KEY_X},
+		CTRL_ROTATE_CCW: {KEY_Z, KEY_CONTROL_L},
+		CTRL_ROTATE_180: {KEY_A},
+		CTRL_SOFT_DROP:  {KEY_S},
+		CTRL_HARD_DROP:  {KEY_DOWN, KEY_SPACE},
+		CTRL_HOLD:       {KEY_C, KEY_SHIFT_L},
+		CTRL_PAUSE:      {KEY_P, KEY_ESCAPE},
+		CTRL_RESTART:    {KEY_F2},
+	}
+}
+
+// Key bindings of the two players sharing one keyboard in versus
+func DefaultVersusKeyBindings() [2]*KeyBindings {
+	return [2]*KeyBindings{
+		{
+			CTRL_LEFT:       {KEY_A},
+			CTRL_RIGHT:      {KEY_D},
+			CTRL_ROTATE:     {KEY_W},
+			CTRL_ROTATE_CCW: {KEY_Q},
+			CTRL_ROTATE_180: {KEY_E},
+			CTRL_SOFT_DROP:  {KEY_S},
+			CTRL_HARD_DROP:  {KEY_SPACE},
+			CTRL_HOLD:       {KEY_SHIFT_L},
+			CTRL_PAUSE:      {KEY_ESCAPE},
+		},
+		{
+			CTRL_LEFT:       {KEY_LEFT},
+			CTRL_RIGHT:      {KEY_RIGHT},
+			CTRL_ROTATE:     {KEY_UP},
+			CTRL_ROTATE_CCW: {KEY_CONTROL_R},
+			CTRL_SOFT_DROP:  {KEY_DOWN},
+			CTRL_HARD_DROP:  {KEY_RETURN},
+			CTRL_HOLD:       {KEY_SHIFT_R},
+			CTRL_PAUSE:      {KEY_P},
+		},
+	}
+}
+
+// Returns the control bound to key
+func (kb *KeyBindings) lookup(key uint) (Control, bool) {
+	for c, keys := range kb {
+		for _, k := range keys {
+			if k == key {
+				return Control(c), true
+			}
+		}
+	}
+	return 0, false
+}
+
+// Bind key to c, the key is unbound from any other control first
+func (kb *KeyBindings) bind(c Control, key uint) {
+	kb.unbindKey(key)
+	kb[c] = append(kb[c], key)
+}
+
+func (kb *KeyBindings) unbindKey(key uint) {
+	for c, keys := range kb {
+		for i, k := range keys {
+			if k == key {
+				kb[c] = append(keys[:i:i], keys[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+func (kb *KeyBindings) clear(c Control) {
+	kb[c] = nil
+}
+
+func (kb *KeyBindings) MarshalJSON() ([]byte, error) {
+	m := make(map[string][]uint, CONTROLS)
+	for c, keys := range kb {
+		m[controlNames[c]] = append([]uint{}, keys...)
+	}
+	return json.Marshal(m)
+}
+
+// Controls missing in data keep their current keys
+func (kb *KeyBindings) UnmarshalJSON(data []byte) error {
+	var m map[string][]uint
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	for name, keys := range m {
+		c, err := controlByName(name)
+		if err != nil {
+			return err
+		}
+		kb[c] = keys
+	}
+	return nil
+}
+
+func controlByName(name string) (Control, error) {
+	for c, n := range controlNames {
+		if n == name {
+			return Control(c), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown control %q", name)
+}
@@ -0,0 +1,204 @@
+package tetris
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	GRAVITY_G   = 1 << 16        // 1G, a cell per frame
+	MAX_GRAVITY = 20 * GRAVITY_G // 20G, to the floor in a frame
+)
+
+// Gravity in 1/GRAVITY_G cells per frame
+type Gravity int32
+
+// Gravity of a cell every n frames
+func gravityPer(frames int) Gravity {
+	return Gravity((GRAVITY_G + frames - 1) / frames)
+}
+
+// Text form, e.g. "20G" for cells per frame, "1/60" for frames per cell,
+// or "0.25" cells per frame
+func (g Gravity) MarshalText() ([]byte, error) {
+	if g >= GRAVITY_G && g%GRAVITY_G == 0 {
+		return []byte(fmt.Sprintf("%dG", g/GRAVITY_G)), nil
+	}
+	if g <= 0 {
+		return []byte(strconv.Itoa(int(g))), nil // not valid, but kept as it is
+	}
+	if n := (GRAVITY_G + int(g) - 1) / int(g); gravityPer(n) == g {
+		return []byte(fmt.Sprintf("1/%d", n)), nil
+	}
+	return []byte(strconv.FormatFloat(float64(g)/GRAVITY_G, 'g', -1, 64)), nil
+}
+
+func (g *Gravity) UnmarshalText(text []byte) error {
+	s := string(text)
+	switch {
+	case strings.HasSuffix(s, "G"):
+		n, err := strconv.Atoi(strings.TrimSuffix(s, "G"))
+		if err != nil {
+			return fmt.Errorf("bad gravity %q", s)
+		}
+		*g = Gravity(n * GRAVITY_G)
+	case strings.HasPrefix(s, "1/"):
+		n, err := strconv.Atoi(s[2:])
+		if err != nil || n <= 0 {
+			return fmt.Errorf("bad gravity %q", s)
+		}
+		*g = gravityPer(n)
+	default:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("bad gravity %q", s)
+		}
+		*g = Gravity(f * GRAVITY_G)
+	}
+	if *g <= 0 { // too slow to fall
+		return fmt.Errorf("bad gravity %q", s)
+	}
+	return nil
+}
+
+// How the level goes up by the lines cleared
+type LevelRule int
+
+const (
+	LEVEL_FIXED    LevelRule = iota // every Lines lines
+	LEVEL_VARIABLE                  // 5 lines more for each level: 5 at 0, 10 at 1...
+	LEVEL_TABLE                     // Goals lines at each level, the last one beyond
+
+	LEVEL_RULES // number of rules
+)
+
+var levelRuleNames = [LEVEL_RULES]string{"fixed", "variable", "table"}
+
+func (r LevelRule) String() string {
+	return levelRuleNames[r]
+}
+
+func (r LevelRule) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *LevelRule) UnmarshalText(text []byte) error {
+	for i, name := range levelRuleNames {
+		if name == string(text) {
+			*r = LevelRule(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown level rule %q", text)
+}
+
+// Levels by the lines cleared, and the gravity of each level
+type LevelCurve struct {
+	Rule    LevelRule `json:"rule"`
+	Lines   int       `json:"lines"`   // of each level, by LEVEL_FIXED
+	Goals   []int     `json:"goals"`   // lines of each level, by LEVEL_TABLE
+	Gravity []Gravity `json:"gravity"` // of each level, the last one beyond
+}
+
+var ErrorBadLevels = errors.New("bad level curve")
+
+func DefaultLevelCurve() LevelCurve {
+	c := LevelCurve{Rule: LEVEL_FIXED, Lines: ROW}
+	for _, frames := range []int{90, 78, 60, 48, 30, 18, 12, 9, 6, 4, 3, 2, 1} {
+		c.Gravity = append(c.Gravity, gravityPer(frames))
+	}
+	for _, cells := range []int{2, 3, 4, 5, 10, 15, 20} {
+		c.Gravity = append(c.Gravity, Gravity(cells*GRAVITY_G))
+	}
+	return c
+}
+
+func (c *LevelCurve) validate() error {
+	if c.Rule < LEVEL_FIXED || c.Rule >= LEVEL_RULES {
+		return fmt.Errorf("%w: rule %d", ErrorBadLevels, c.Rule)
+	}
+	if c.Rule == LEVEL_FIXED && c.Lines <= 0 {
+		return fmt.Errorf("%w: %d lines", ErrorBadLevels, c.Lines)
+	}
+	if c.Rule == LEVEL_TABLE && len(c.Goals) == 0 {
+		return fmt.Errorf("%w: no goals", ErrorBadLevels)
+	}
+	for _, n := range c.Goals {
+		if n <= 0 {
+			return fmt.Errorf("%w: goal of %d lines", ErrorBadLevels, n)
+		}
+	}
+	if len(c.Gravity) == 0 {
+		return fmt.Errorf("%w: no gravity", ErrorBadLevels)
+	}
+	for _, g := range c.Gravity {
+		if g <= 0 || g > MAX_GRAVITY {
+			return fmt.Errorf("%w: gravity %d", ErrorBadLevels, g)
+		}
+	}
+	return nil
+}
+
+// Lines to clear at the level, to the next one
+func (c *LevelCurve) goal(level int) int {
+	switch c.Rule {
+	case LEVEL_VARIABLE:
+		return 5 * (level + 1)
+	case LEVEL_TABLE:
+		if level < len(c.Goals) {
+			return c.Goals[level]
+		}
+		return c.Goals[len(c.Goals)-1]
+	}
+	return c.Lines
+}
+
+// Level after the lines cleared from the start level, below LEVELS
+func (c *LevelCurve) levelOf(start uint8, lines uint) uint8 {
+	l := int(start)
+	for l < LEVELS-1 && lines >= uint(c.goal(l)) {
+		lines -= uint(c.goal(l))
+		l++
+	}
+	return uint8(l)
+}
+
+func (c *LevelCurve) gravity(level uint8) Gravity {
+	if int(level) < len(c.Gravity) {
+		return c.Gravity[level]
+	}
+	return c.Gravity[len(c.Gravity)-1]
+}
+
+// Set the level curve & the level to start from, unless invalid
+func (g *Game) setLevels(c LevelCurve, start int) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+	if start < 0 || start >= LEVELS {
+		return fmt.Errorf("%w: start level %d", ErrorBadLevels, start)
+	}
+	g.m.Lock()
+	defer g.m.Unlock()
+	g.levels = c
+	g.startLevel = uint8(start)
+	return nil
+}
+
+// Gravity of the level, faster while soft dropping but no faster than
+// 1G unless the level is; the caller should hold g.m
+func (g *Game) gravity() Gravity {
+	v := g.levelCurve().gravity(g.level)
+	if f := g.handling.SoftDropFactor; f > 0 && g.input.held[CTRL_SOFT_DROP] {
+		soft := v * Gravity(f)
+		if soft > GRAVITY_G {
+			soft = GRAVITY_G
+		}
+		if soft > v {
+			v = soft
+		}
+	}
+	return v
+}
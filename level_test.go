@@ -0,0 +1,151 @@
+package tetris
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestGravityText(t *testing.T) {
+	tests := []struct {
+		text string
+		want Gravity
+		as   string // marshalled
+	}{
+		{"20G", 20 * GRAVITY_G, "20G"},
+		{"1G", GRAVITY_G, "1G"},
+		{"1/60", gravityPer(60), "1/60"},
+		{"0.5", GRAVITY_G / 2, "1/2"},
+		{"0.75", GRAVITY_G * 3 / 4, "0.75"},
+	}
+	for _, test := range tests {
+		var g Gravity
+		if err := g.UnmarshalText([]byte(test.text)); err != nil || g != test.want {
+			t.Errorf("%s: gravity %d, %v; want %d", test.text, g, err, test.want)
+		}
+		if text, _ := g.MarshalText(); string(text) != test.as {
+			t.Errorf("%d: text %s, want %s", g, text, test.as)
+		}
+	}
+	// slower than a cell in a frame, back as they were
+	for _, g := range []Gravity{1, 3, GRAVITY_G/1000 + 1, GRAVITY_G - 1} {
+		text, err := g.MarshalText()
+		var back Gravity
+		if err != nil || back.UnmarshalText(text) != nil || back != g {
+			t.Errorf("%d: text %s, %v; back as %d", g, text, err, back)
+		}
+	}
+	if text, err := Gravity(0).MarshalText(); err != nil || string(text) != "0" {
+		t.Errorf("0: text %s, %v", text, err)
+	}
+	for _, bad := range []string{"G", "1/0", "fast", "0", "0G", "0.000001", "-1"} {
+		var g Gravity
+		if err := g.UnmarshalText([]byte(bad)); err == nil {
+			t.Errorf("%s: no error", bad)
+		}
+	}
+
+	// the level curve in the config file
+	c := DefaultLevelCurve()
+	data, err := json.Marshal(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loaded LevelCurve
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Gravity) != len(c.Gravity) || loaded.Gravity[0] != c.Gravity[0] || loaded.Rule != c.Rule {
+		t.Errorf("loaded %s as %+v", data, loaded)
+	}
+}
+
+func TestLevelOf(t *testing.T) {
+	tests := []struct {
+		name  string
+		curve LevelCurve
+		start uint8
+		lines uint
+		want  uint8
+	}{
+		{"fixed", LevelCurve{Rule: LEVEL_FIXED, Lines: 10}, 0, 25, 2},
+		{"fixed from 5", LevelCurve{Rule: LEVEL_FIXED, Lines: 10}, 5, 9, 5},
+		{"fixed to the last", LevelCurve{Rule: LEVEL_FIXED, Lines: 1}, 0, 100, LEVELS - 1},
+		{"variable", LevelCurve{Rule: LEVEL_VARIABLE}, 0, 14, 1},
+		{"variable to 2", LevelCurve{Rule: LEVEL_VARIABLE}, 0, 15, 2},
+		{"variable from 2", LevelCurve{Rule: LEVEL_VARIABLE}, 2, 15, 3},
+		{"table", LevelCurve{Rule: LEVEL_TABLE, Goals: []int{2, 4}}, 0, 6, 2},
+		{"table beyond", LevelCurve{Rule: LEVEL_TABLE, Goals: []int{2, 4}}, 0, 13, 3},
+	}
+	for _, test := range tests {
+		if l := test.curve.levelOf(test.start, test.lines); l != test.want {
+			t.Errorf("%s: level %d, want %d", test.name, l, test.want)
+		}
+	}
+}
+
+func TestSetLevels(t *testing.T) {
+	g := newHeadlessGame()
+	bad := []LevelCurve{
+		{Rule: LEVEL_FIXED, Gravity: []Gravity{1}},
+		{Rule: LEVEL_TABLE, Gravity: []Gravity{1}},
+		{Rule: LEVEL_VARIABLE},
+		{Rule: LEVEL_VARIABLE, Gravity: []Gravity{MAX_GRAVITY + 1}},
+		{Rule: LEVEL_RULES, Lines: 1, Gravity: []Gravity{1}},
+	}
+	for _, c := range bad {
+		if err := g.setLevels(c, 0); !errors.Is(err, ErrorBadLevels) {
+			t.Errorf("%+v: %v", c, err)
+		}
+	}
+	if err := g.setLevels(DefaultLevelCurve(), LEVELS); !errors.Is(err, ErrorBadLevels) {
+		t.Errorf("start level %d: %v", LEVELS, err)
+	}
+
+	if err := g.setLevels(DefaultLevelCurve(), 3); err != nil {
+		t.Fatal(err)
+	}
+	g.stepped = true
+	g.start()
+	g.m.Lock()
+	defer g.m.Unlock()
+	if g.level != 3 {
+		t.Errorf("started at level %d", g.level)
+	}
+}
+
+// Frames for the shape to fall a row at 1/3G, 1G and to the floor at 20G
+func TestGravity(t *testing.T) {
+	tests := []struct {
+		name    string
+		gravity Gravity
+		frames  int // to fall the first row
+		rows    int // fallen in a frame
+	}{
+		{"sub 1G", gravityPer(3), 3, 1},
+		{"1G", GRAVITY_G, 1, 1},
+		{"20G", MAX_GRAVITY, 1, ROW},
+	}
+	for _, test := range tests {
+		g := newHeadlessGame()
+		g.setLevels(LevelCurve{Rule: LEVEL_FIXED, Lines: 10, Gravity: []Gravity{test.gravity}}, 0)
+		g.stepped = true
+		g.start()
+
+		g.m.Lock()
+		top := g.pos.top
+		g.m.Unlock()
+		for i := 0; i < test.frames; i++ {
+			g.step(nil)
+		}
+
+		g.m.Lock()
+		fallen := g.pos.top - top
+		b := boardOf(&g.model)
+		landed := !b.fits(g.currShape, Point{g.pos.left, g.pos.top + 1})
+		g.m.Unlock()
+		if fallen != test.rows && !(test.rows == ROW && landed) {
+			t.Errorf("%s: fallen %d rows in %d frames", test.name, fallen, test.frames)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package tetris
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DEFAULT_INPUT_DELAY = 3  // frames
+	MAX_INPUT_DELAY     = 10 // frames
+
+	HASH_INTERVAL = 30  // frames between desync checks
+	INPUT_HISTORY = 120 // frames of inputs kept, to step again after a resync
+	MAX_STEPS     = 2   // frames stepped per tick, to catch up with the peer
+
+	FNV_PRIME = 1099511628211 // to combine the hashes of games
+)
+
+// Settings of a lockstep match, decided by the host
+type lockstepSettings struct {
+	Delay   int            `json:"delay"` // frames of input delay
+	Garbage GarbagePattern `json:"garbage"`
+}
+
+// Steps the local game and the copy of the remote game together,
+// from the frame stamped inputs of both peers. Both peers step the
+// same games in the same order, the host checks nothing but sends
+// its hashes, the guest asks for a snapshot on desync
+type lockstep struct {
+	n      *NetMatch
+	delay  int
+	games  [2]*Game // in player order, the host first
+	local  int      // index of the local game
+	remote int
+
+	round   int
+	frame   int  // next frame to step
+	playing bool // from the start of a round until a game is over
+	loser   int  // index of the game topped out first, -1 if none
+
+	inputs     [2]map[int][]inputEvent // by frame, in player order
+	hashes     map[int]uint64          // by frame, of the local steps
+	hostHashes map[int]uint64          // by frame, received by the guest
+	epoch      int                     // resyncs of the round, stale messages are dropped
+	resyncing  bool                    // the guest waits for a snapshot
+	resyncs    int32                   // resyncs of the match, accessed atomically
+
+	chanMsg chan *message // lockstep messages, in the order received
+}
+
+func newLockstep(n *NetMatch, delay int) *lockstep {
+	l := &lockstep{
+		n:       n,
+		delay:   delay,
+		local:   0,
+		remote:  1,
+		chanMsg: make(chan *message, INPUT_QUEUE_SIZE),
+	}
+	if !n.host {
+		l.local, l.remote = 1, 0
+	}
+	l.games[l.local] = n.local
+	l.games[l.remote] = n.remote
+
+	for i, g := range l.games {
+		i := i // for closures
+		g.m.Lock()
+		g.stepped = true
+		g.attack = l.games[1-i].sendGarbage
+		g.toppedOut = func() {
+			if l.loser < 0 {
+				l.loser = i
+			}
+		}
+		g.m.Unlock()
+	}
+	return l
+}
+
+func (l *lockstep) run() {
+	ticker := time.NewTicker(FRAME)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			l.tick()
+		case msg := <-l.chanMsg:
+			l.handle(msg)
+		case <-l.n.chanDone:
+			return
+		}
+	}
+}
+
+func (l *lockstep) handle(msg *message) {
+	if msg.Type == MSG_START {
+		l.begin(msg.Round, msg.Seed)
+		return
+	}
+	if msg.Round != l.round {
+		return
+	}
+
+	switch msg.Type {
+	case MSG_INPUT:
+		if msg.Frame >= l.frame-INPUT_HISTORY && msg.Frame < l.frame+INPUT_HISTORY {
+			l.inputs[l.remote][msg.Frame] = msg.Events
+		}
+	case MSG_HASH:
+		if msg.Epoch == l.epoch && !l.resyncing {
+			l.hostHashes[msg.Frame] = msg.Hash
+			l.check(msg.Frame)
+		}
+	case MSG_RESYNC:
+		if msg.Epoch == l.epoch {
+			l.sendSnapshot()
+		}
+	case MSG_SNAPSHOT:
+		l.restore(msg)
+	}
+}
+
+// Start a round, all games with the same seed
+func (l *lockstep) begin(round int, seed int64) {
+	log.Printf("[lockstep] round %d, seed %d, input delay %d", round, seed, l.delay)
+	l.round = round
+	l.frame = 0
+	l.playing = true
+	l.loser = -1
+	l.epoch = 0
+	l.resyncing = false
+	l.hashes = make(map[int]uint64)
+	l.hostHashes = make(map[int]uint64)
+	for i := range l.inputs {
+		l.inputs[i] = make(map[int][]inputEvent)
+		for f := 0; f < l.delay; f++ {
+			l.inputs[i][f] = nil
+		}
+	}
+
+	l.n.local.takeInputs() // pressed before the round
+	for _, g := range l.games {
+		g.seed(seed)
+		g.start()
+	}
+}
+
+// Step the frames of which the inputs of both peers are known
+func (l *lockstep) tick() {
+	for i := 0; i < MAX_STEPS && l.playing && !l.resyncing; i++ {
+		f := l.frame
+		if _, ok := l.inputs[l.remote][f]; !ok {
+			return // wait for the peer
+		}
+
+		// inputs of now are applied after the delay
+		for t := f; t <= f+l.delay; t++ {
+			if _, ok := l.inputs[l.local][t]; !ok {
+				events := l.n.local.takeInputs()
+				l.inputs[l.local][t] = events
+				l.n.send(&message{Type: MSG_INPUT, Round: l.round, Frame: t, Events: events})
+			}
+		}
+
+		for j, g := range l.games {
+			g.step(l.inputs[j][f])
+		}
+		for j := range l.inputs {
+			delete(l.inputs[j], f-INPUT_HISTORY)
+		}
+		l.frame++
+
+		if l.loser >= 0 {
+			l.playing = false
+			loser := 0
+			if l.loser == l.remote {
+				loser = 1
+			}
+			select {
+			case l.n.chanOver <- loser:
+			default:
+			}
+			return
+		}
+
+		if f%HASH_INTERVAL == 0 {
+			l.hash(f)
+		}
+	}
+}
+
+// The host sends the hash of frame f, the guest checks it
+func (l *lockstep) hash(f int) {
+	h := l.games[0].hash()*FNV_PRIME ^ l.games[1].hash()
+	if l.n.host {
+		l.n.send(&message{Type: MSG_HASH, Round: l.round, Frame: f, Hash: h, Epoch: l.epoch})
+		return
+	}
+	l.hashes[f] = h
+	l.check(f)
+}
+
+// Compare the hashes of frame f if both known, ask for a snapshot on desync
+func (l *lockstep) check(f int) {
+	h, ok := l.hashes[f]
+	hostHash, hostOk := l.hostHashes[f]
+	if !ok || !hostOk {
+		return
+	}
+	delete(l.hashes, f)
+	delete(l.hostHashes, f)
+	if h == hostHash {
+		return
+	}
+
+	log.Printf("[lockstep] desync at frame %d of round %d", f, l.round)
+	l.resyncing = true
+	l.n.send(&message{Type: MSG_RESYNC, Round: l.round, Epoch: l.epoch})
+}
+
+// The host sends the full state of the games, by the guest's request
+func (l *lockstep) sendSnapshot() {
+	l.epoch++
+	log.Printf("[lockstep] send snapshot at frame %d", l.frame)
+	l.n.send(&message{
+		Type:  MSG_SNAPSHOT,
+		Round: l.round,
+		Frame: l.frame,
+		Epoch: l.epoch,
+		Games: []*gameState{l.games[0].saveState(), l.games[1].saveState()},
+	})
+}
+
+// The guest restores the games from the host's snapshot,
+// and steps again from the frame of it
+func (l *lockstep) restore(msg *message) {
+	if len(msg.Games) != len(l.games) {
+		log.Println("[lockstep] bad snapshot")
+		return
+	}
+	for _, s := range msg.Games {
+		if s == nil || s.validate() != nil {
+			log.Println("[lockstep] bad snapshot")
+			return
+		}
+	}
+	for i, g := range l.games {
+		g.restoreState(msg.Games[i])
+	}
+	log.Printf("[lockstep] resync at frame %d", msg.Frame)
+
+	l.frame = msg.Frame
+	l.epoch = msg.Epoch
+	l.resyncing = false
+	l.loser = -1
+	l.playing = true
+	for _, g := range l.games {
+		g.m.Lock()
+		if !g.state.active() {
+			l.playing = false
+		}
+		g.m.Unlock()
+	}
+	l.hashes = make(map[int]uint64)
+	l.hostHashes = make(map[int]uint64)
+	atomic.AddInt32(&l.resyncs, 1)
+}
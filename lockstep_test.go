@@ -0,0 +1,117 @@
+package tetris
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newSteppedGame(seed int64) *Game {
+	g := newHeadlessGame()
+	g.stepped = true
+	g.seed(seed)
+	g.start()
+	return g
+}
+
+// Inputs of a frame, pressing & releasing some controls now and then
+func scriptedInputs(f int) []inputEvent {
+	controls := []Control{CTRL_LEFT, CTRL_ROTATE, CTRL_RIGHT, CTRL_HOLD, CTRL_SOFT_DROP, CTRL_HARD_DROP}
+	c := controls[f/7%len(controls)]
+	switch f % 7 {
+	case 0:
+		return []inputEvent{{c, true}}
+	case 4:
+		return []inputEvent{{c, false}}
+	}
+	return nil
+}
+
+func TestStepDeterministic(t *testing.T) {
+	a, b := newSteppedGame(42), newSteppedGame(42)
+	var c *Game
+
+	for f := 0; f < 1000; f++ {
+		events := scriptedInputs(f)
+		a.step(events)
+		b.step(events)
+		if c != nil {
+			c.step(events)
+		}
+
+		if f == 300 {
+			// a game restored from a snapshot steps the same
+			c = newSteppedGame(7)
+			if err := c.restoreState(a.saveState()); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if a.hash() != b.hash() || (c != nil && c.hash() != a.hash()) {
+			t.Fatalf("games differ at frame %d", f)
+		}
+	}
+}
+
+// Hard drop until topped out
+func topOut(t *testing.T, g *Game) {
+	for i := 0; i < 200 && stateOf(g).active(); i++ {
+		g.press(CTRL_HARD_DROP)
+		g.release(CTRL_HARD_DROP)
+		time.Sleep(2 * FRAME)
+	}
+	if s := stateOf(g); s != STATE_GAMEOVER {
+		t.Fatalf("state %s, want game over", s)
+	}
+}
+
+func checkSynced(t *testing.T, host, guest *NetMatch) {
+	if host.local.hash() != guest.remote.hash() {
+		t.Error("the host's game differs on the guest")
+	}
+	if host.remote.hash() != guest.local.hash() {
+		t.Error("the guest's game differs on the host")
+	}
+}
+
+func TestLockstepLoopback(t *testing.T) {
+	host, guest := newLoopbackMatch(t, &lockstepSettings{Delay: 2, Garbage: GARBAGE_CHEESE})
+	if guest.lockstep == nil || guest.lockstep.delay != 2 {
+		t.Fatal("the guest is not in lockstep")
+	}
+
+	waitFor(t, "guest to start", func() bool { return stateOf(guest.local).active() })
+	host.local.press(CTRL_LEFT)
+	guest.local.press(CTRL_RIGHT)
+	topOut(t, guest.local)
+
+	waitDone(t, host)
+	waitDone(t, guest)
+	if host.err != nil || guest.err != nil {
+		t.Fatalf("match errors: host %v, guest %v", host.err, guest.err)
+	}
+	if host.wins != [2]int{1, 0} || guest.wins != [2]int{0, 1} {
+		t.Errorf("wins: host %v, guest %v", host.wins, guest.wins)
+	}
+	checkSynced(t, host, guest)
+	if n := atomic.LoadInt32(&guest.lockstep.resyncs); n != 0 {
+		t.Errorf("%d resyncs, want none", n)
+	}
+}
+
+func TestLockstepResync(t *testing.T) {
+	host, guest := newLoopbackMatch(t, &lockstepSettings{Delay: 2, Garbage: GARBAGE_CHEESE})
+	waitFor(t, "guest to start", func() bool { return stateOf(guest.local).active() })
+
+	// desync the host's game on the guest
+	g := guest.remote
+	g.m.Lock()
+	g.model[ROW-1] = garbageRow(0)
+	g.m.Unlock()
+	waitFor(t, "resync", func() bool { return atomic.LoadInt32(&guest.lockstep.resyncs) > 0 })
+
+	topOut(t, guest.local)
+	waitDone(t, host)
+	waitDone(t, guest)
+	checkSynced(t, host, guest)
+}
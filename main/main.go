@@ -1,7 +1,43 @@
 package main
 
-import "github.com/cloudecho/tetris"
+import (
+	"fmt"
+	"log"
+	"os"
 
-func main(){
+	"github.com/cloudecho/tetris"
+)
+
+// tetris                    the game
+// tetris spectate [addr]    watch a game in the terminal
+// tetris ai [flags]         headless games played by the AI
+// tetris bot [flags] [cmd]  headless games played by a bot program
+// tetris tune [flags]       evolve the weights of the AI
+// tetris stats [flags]      print the lifetime stats, or export them
+var commands = map[string]func(args []string) error{
+	"spectate": spectate,
+	"ai":       tetris.RunAI,
+	"bot":      tetris.RunBot,
+	"tune":     tetris.RunTune,
+	"stats":    tetris.RunStats,
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		if run, ok := commands[os.Args[1]]; ok {
+			if err := run(os.Args[2:]); err != nil {
+				log.Fatalln(os.Args[1]+":", err)
+			}
+			return
+		}
+	}
 	tetris.GUI()
-}
\ No newline at end of file
+}
+
+func spectate(args []string) error {
+	addr := fmt.Sprintf("localhost:%d", tetris.DEFAULT_SPECTATOR_PORT)
+	if len(args) > 0 {
+		addr = args[0]
+	}
+	return tetris.SpectateTerminal(addr)
+}
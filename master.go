@@ -0,0 +1,102 @@
+package tetris
+
+const (
+	MASTER_LEVEL_LINES = 10                          // lines of each level
+	MASTER_LINES       = LEVELS * MASTER_LEVEL_LINES // to finish the mode
+	MASTER_GM_FRAMES   = 12 * 60 * FPS               // to finish in for the grade GM
+)
+
+// Delays of a level of master mode, in frames
+type masterTiming struct {
+	are       int // before the next shape moves
+	lineClear int // added to the ARE if rows cleared
+	lock      int // on the stack before the shape locks
+}
+
+var masterTimings = [LEVELS]masterTiming{
+	{27, 40, 30}, {27, 40, 30}, {27, 36, 30}, {27, 32, 30}, {27, 28, 30},
+	{25, 25, 30}, {25, 20, 29}, {25, 16, 28}, {16, 12, 27}, {12, 6, 26},
+	{12, 6, 25}, {12, 6, 24}, {10, 6, 23}, {10, 6, 22}, {8, 6, 21},
+	{8, 6, 20}, {6, 6, 19}, {6, 6, 18}, {6, 6, 17}, {6, 6, 15},
+}
+
+// 20G from the start, a level every 10 lines
+var masterLevels = LevelCurve{
+	Rule:    LEVEL_FIXED,
+	Lines:   MASTER_LEVEL_LINES,
+	Gravity: []Gravity{MAX_GRAVITY},
+}
+
+var (
+	gradeNames = []string{
+		"9", "8", "7", "6", "5", "4", "3", "2", "1",
+		"S1", "S2", "S3", "S4", "S5", "S6", "S7", "S8", "S9", "GM",
+	}
+
+	// grade points to reach each grade but GM
+	gradeGoals = []int{
+		0, 10, 25, 45, 70, 100, 140, 190, 250,
+		320, 400, 480, 560, 640, 720, 800, 880, 960,
+	}
+
+	// grade points of clearing 1~4 rows at once, by levels of 5
+	clearGradePoints = [SHAPE_SIZE]int{1, 3, 6, 10}
+)
+
+// Levels of the mode, the caller should hold g.m
+func (g *Game) levelCurve() *LevelCurve {
+	if g.mode == MODE_MASTER {
+		return &masterLevels
+	}
+	return &g.levels
+}
+
+// Level the game starts from, the caller should hold g.m
+func (g *Game) firstLevel() uint8 {
+	if g.mode == MODE_MASTER {
+		return 0
+	}
+	return g.startLevel
+}
+
+// Frames before the next shape moves, longer if rows cleared;
+// the caller should hold g.m
+func (g *Game) entryDelay(cleared int) int {
+	if g.mode != MODE_MASTER {
+		return g.handling.EntryDelay
+	}
+	t := masterTimings[g.level]
+	if cleared > 0 {
+		return t.are + t.lineClear
+	}
+	return t.are
+}
+
+// Frames on the stack before the shape locks, 0 to lock on the next
+// fall; the caller should hold g.m
+func (g *Game) lockDelay() int {
+	if g.mode != MODE_MASTER {
+		return 0
+	}
+	return masterTimings[g.level].lock
+}
+
+// Add the grade points of the rows cleared, the caller should hold g.m
+func (g *Game) earnGrade(rows int) {
+	if g.mode == MODE_MASTER {
+		g.gradePoints += clearGradePoints[rows-1] * (int(g.level)/5 + 1)
+	}
+}
+
+// Grade by the points earned, GM if finished in time with the points of
+// S9. The caller should hold g.m
+func (g *Game) grade() string {
+	i := 0
+	for i+1 < len(gradeGoals) && g.gradePoints >= gradeGoals[i+1] {
+		i++
+	}
+	if i == len(gradeGoals)-1 && g.rows >= MASTER_LINES && g.stats.Frames <= MASTER_GM_FRAMES {
+		i++
+	}
+	return gradeNames[i]
+}
@@ -0,0 +1,126 @@
+package tetris
+
+import "testing"
+
+// A shape falls to the stack at once, and locks after the lock delay
+func TestMasterLockDelay(t *testing.T) {
+	g := newHeadlessGame()
+	g.setMode(MODE_MASTER)
+	g.stepped = true
+	g.start()
+
+	g.step(nil)
+	g.m.Lock()
+	id := g.currShape.id
+	landed := g.grounded()
+	g.m.Unlock()
+	if !landed {
+		t.Fatal("not on the stack after a frame at 20G")
+	}
+
+	delay := masterTimings[0].lock
+	for i := 2; i < delay; i++ { // the frame landed counted
+		g.step(nil)
+	}
+	g.m.Lock()
+	pieces := g.stats.placed()
+	g.m.Unlock()
+	if pieces != 0 {
+		t.Fatalf("locked before the lock delay of %d frames", delay)
+	}
+
+	g.step(nil)
+	g.m.Lock()
+	defer g.m.Unlock()
+	if g.stats.placed() != 1 || g.stats.Pieces[id] != 1 {
+		t.Errorf("not locked after the lock delay: %v", g.stats.Pieces)
+	}
+	if g.entry != masterTimings[0].are {
+		t.Errorf("entry delay %d, want %d", g.entry, masterTimings[0].are)
+	}
+}
+
+// Locked at once by soft drop, with a longer delay after a clear
+func TestMasterSoftDrop(t *testing.T) {
+	n, err := parseNotation("current: 16\npos: 9 0\nboard:\nXXXXXXXXXX.\nXXXXXXXXXX.\nXXXXXXXXXX.\nXXXXXXXXXX.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := newHeadlessGame()
+	g.setMode(MODE_MASTER)
+	g.stepped = true
+	g.start()
+	if err := g.loadNotation(n); err != nil {
+		t.Fatal(err)
+	}
+	g.step([]inputEvent{{CTRL_SOFT_DROP, true}})
+
+	g.m.Lock()
+	defer g.m.Unlock()
+	if g.rows != 4 || g.state != STATE_LINE_CLEAR {
+		t.Fatalf("rows %d, state %s", g.rows, g.state)
+	}
+	if want := masterTimings[0].are + masterTimings[0].lineClear; g.entry != want {
+		t.Errorf("entry delay %d, want %d", g.entry, want)
+	}
+	if g.gradePoints != clearGradePoints[3] {
+		t.Errorf("grade points %d", g.gradePoints)
+	}
+}
+
+func TestMasterGrade(t *testing.T) {
+	tests := []struct {
+		points int
+		rows   uint
+		frames int
+		want   string
+	}{
+		{0, 0, 0, "9"},
+		{9, 10, 0, "9"},
+		{10, 10, 0, "8"},
+		{250, 100, 0, "1"},
+		{320, 100, 0, "S1"},
+		{2000, 150, 0, "S9"},
+		{2000, MASTER_LINES, MASTER_GM_FRAMES + 1, "S9"},
+		{2000, MASTER_LINES, MASTER_GM_FRAMES, "GM"},
+	}
+	for _, test := range tests {
+		g := newHeadlessGame()
+		g.gradePoints, g.rows, g.stats.Frames = test.points, test.rows, test.frames
+		if grade := g.grade(); grade != test.want {
+			t.Errorf("%d points, %d rows in %d frames: grade %s, want %s",
+				test.points, test.rows, test.frames, grade, test.want)
+		}
+	}
+
+	g := newHeadlessGame()
+	g.mode, g.level = MODE_MASTER, 12
+	g.earnGrade(2)
+	if g.gradePoints != 3*clearGradePoints[1] {
+		t.Errorf("grade points %d of a double at level 12", g.gradePoints)
+	}
+}
+
+// An instant shift at 20G falls into the well on the way
+func TestMasterInstantShift(t *testing.T) {
+	n, err := parseNotation("current: 53\npos: 4 0\nboard:\nXX..XXXXXXX\nXX..XXXXXXX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := newHeadlessGame()
+	g.setMode(MODE_MASTER)
+	g.setHandling(Handling{SoftDropFactor: 20})
+	g.stepped = true
+	g.start()
+	if err := g.loadNotation(n); err != nil {
+		t.Fatal(err)
+	}
+	g.step([]inputEvent{{CTRL_LEFT, true}})
+	g.step(nil)
+
+	g.m.Lock()
+	defer g.m.Unlock()
+	if bottom := g.pos.top + g.currShape.bounds().y2; g.pos.left != 1 || bottom != ROW-1 {
+		t.Errorf("at %+v, bottom at row %d; not in the well", g.pos, bottom)
+	}
+}
@@ -0,0 +1,91 @@
+package tetris
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// Game mode, selected before starting
+type Mode int
+
+const (
+	MODE_MARATHON  Mode = iota // play until topped out
+	MODE_DIG                   // start with garbage rows, finish when they are cleared
+	MODE_FINESSE               // marathon judging the keys pressed for each shape
+	MODE_PUZZLE                // a board & queue of g.puzzle, finish when the pieces run out
+	MODE_MASTER                // 20G with lock delay & grades, finish at MASTER_LINES
+	MODE_FADING                // marathon with the blocks locked fading out
+	MODE_INVISIBLE             // marathon with the blocks locked hidden at once
+	MODE_CASCADE               // marathon with the blocks falling apart after clears, in chains
+
+	MODES // number of modes
+)
+
+var modeNames = [MODES]string{"marathon", "dig", "finesse", "puzzle", "master", "fading", "invisible", "cascade"}
+
+func (m Mode) String() string {
+	return modeNames[m]
+}
+
+// Text form of the mode, by name
+func (m Mode) MarshalText() ([]byte, error) {
+	if m < 0 || m >= MODES {
+		return nil, fmt.Errorf("bad mode %d", m)
+	}
+	return []byte(m.String()), nil
+}
+
+func (m *Mode) UnmarshalText(text []byte) error {
+	for i, name := range modeNames {
+		if name == string(text) {
+			*m = Mode(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown mode %q", text)
+}
+
+func (g *Game) setMode(mode Mode) {
+	g.m.Lock()
+	defer g.m.Unlock()
+	g.mode = mode
+}
+
+// Garbage pattern of both dig mode and attacks
+func (g *Game) setGarbage(pattern GarbagePattern, digRows int) {
+	g.m.Lock()
+	defer g.m.Unlock()
+	g.garbage = pattern
+	g.digRows = digRows
+}
+
+// Set up the board for g.mode, the caller should hold g.m
+func (g *Game) initMode() {
+	log.Println("game mode:", g.mode)
+
+	g.well = g.rand.Intn(COL)
+	if g.mode == MODE_DIG {
+		g.addGarbage(g.digRows, g.garbage)
+	}
+	if g.mode == MODE_PUZZLE {
+		g.initPuzzle()
+	} else if _, ok := g.rnd.(*puzzleRandomizer); ok {
+		g.useRandomizer(newRandomizer(time.Now().UnixNano()))
+	}
+	g.finesse = finesse{}
+	if g.mode == MODE_FINESSE {
+		g.chanFinesse <- g.finesse
+	}
+}
+
+// Returns true if the goal of g.mode is reached, the caller should hold g.m
+func (g *Game) finished() bool {
+	switch g.mode {
+	case MODE_DIG:
+		return !g.hasGarbage()
+	case MODE_MASTER:
+		return g.rows >= MASTER_LINES
+	}
+	return false
+}
@@ -0,0 +1,560 @@
+package tetris
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	PROTOCOL_VERSION = 4
+
+	DEFAULT_NET_ADDRESS = "localhost:7170"
+
+	COUNTDOWN = 3 // seconds before each round
+
+	NET_TIMEOUT    = 5 * time.Second // the peer is gone if nothing received
+	PING_INTERVAL  = time.Second     // keep alive if the state not changed
+	STATE_INTERVAL = 2 * FRAME       // how often the state diffs are sent
+)
+
+// Message types of the wire protocol
+const (
+	MSG_HELLO     = "hello"     // protocol version, and rounds from the host
+	MSG_COUNTDOWN = "countdown" // seconds to the next round, by the host
+	MSG_START     = "start"     // start a round, by the host
+	MSG_STATE     = "state"     // state diff of the sender's game
+	MSG_ATTACK    = "attack"    // garbage rows to the receiver
+	MSG_OVER      = "over"      // the sender topped out in the round
+	MSG_RESULT    = "result"    // wins after a round, by the host
+	MSG_PING      = "ping"
+	MSG_BYE       = "bye" // the sender left the match
+
+	// lockstep only
+	MSG_INPUT    = "input"    // inputs of the sender in a frame
+	MSG_HASH     = "hash"     // hash of the games after a frame, by the host
+	MSG_RESYNC   = "resync"   // desync detected, by the guest
+	MSG_SNAPSHOT = "snapshot" // full state of the games, by the host
+)
+
+var (
+	ErrorVersion      = errors.New("protocol version mismatch")
+	ErrorDisconnected = errors.New("opponent disconnected")
+
+	errAborted = errors.New("match aborted")
+)
+
+// A message of the wire protocol, one JSON object per line
+type message struct {
+	Type    string     `json:"type"`
+	Version int        `json:"version,omitempty"`
+	Rounds  int        `json:"rounds,omitempty"`
+	Round   int        `json:"round,omitempty"`
+	Count   int        `json:"count,omitempty"`
+	Rows    int        `json:"rows,omitempty"`
+	Wins    []int      `json:"wins,omitempty"` // wins of the sender first
+	State   *stateDiff `json:"state,omitempty"`
+	Error   string     `json:"error,omitempty"`
+
+	Settings *gameSettings     `json:"settings,omitempty"` // hello
+	Lockstep *lockstepSettings `json:"lockstep,omitempty"` // hello from the host
+	Seed     int64             `json:"seed,omitempty"`     // start
+	Frame    int               `json:"frame,omitempty"`
+	Events   []inputEvent      `json:"events,omitempty"`
+	Hash     uint64            `json:"hash,omitempty"`
+	Epoch    int               `json:"epoch,omitempty"`
+	Games    []*gameState      `json:"games,omitempty"` // in player order
+}
+
+// Settings of the sender's game, for the peer to step a copy of it
+type gameSettings struct {
+	Handling   Handling   `json:"handling"`
+	Previews   int        `json:"previews"`
+	Levels     LevelCurve `json:"levels"`
+	StartLevel int        `json:"start_level"`
+}
+
+func (g *Game) settings() *gameSettings {
+	g.m.Lock()
+	defer g.m.Unlock()
+	return &gameSettings{g.handling, g.previews, g.levels, int(g.startLevel)}
+}
+
+// Match with a remote opponent over TCP. The host runs the rounds,
+// each peer runs its own game and sends the state diffs to the other,
+// which applies them to the mirror of the remote game. Or in lockstep,
+// both peers step both games from the inputs of each other
+type NetMatch struct {
+	local     *Game
+	remote    *Game // mirror of the opponent's game, or a copy in lockstep
+	lockstep  *lockstep
+	host      bool
+	rounds    int    // best of
+	round     int    // current round, starts from 1
+	wins      [2]int // local, remote
+	countdown int    // seconds before each round
+
+	conn net.Conn
+	enc  *json.Encoder
+	dec  *json.Decoder
+	wm   sync.Mutex // for writing to conn
+
+	chanRecv      chan *message // messages for the match loop, closed on disconnect
+	chanOver      chan int      // topped out in the round, 0 for local, 1 for remote
+	chanCountdown chan int      // notify ui the countdown, 0 to go
+	chanWins      chan [2]int   // notify ui the wins after each round
+	chanAbort     chan bool
+	chanAttack    chan bool // notify the sender of the rows queued
+	chanDone      chan bool // closed when the match ends
+	err           error     // why the match ended early, set before chanDone closed
+
+	attacks int32 // rows queued to send, accessed atomically
+}
+
+func newNetMatch(conn net.Conn, host bool, local, remote *Game) *NetMatch {
+	return &NetMatch{
+		local:         local,
+		remote:        remote,
+		host:          host,
+		countdown:     COUNTDOWN,
+		conn:          conn,
+		enc:           json.NewEncoder(conn),
+		dec:           json.NewDecoder(conn),
+		chanRecv:      make(chan *message),
+		chanOver:      make(chan int, 1),
+		chanCountdown: make(chan int),
+		chanWins:      make(chan [2]int),
+		chanAbort:     make(chan bool, 1),
+		chanAttack:    make(chan bool, 1),
+		chanDone:      make(chan bool),
+	}
+}
+
+// Wait for an opponent to join on l, rounds are decided by the host,
+// and lockstep if not nil
+func acceptMatch(l net.Listener, local, remote *Game, rounds int, lockstep *lockstepSettings) (*NetMatch, error) {
+	conn, err := l.Accept()
+	if err != nil {
+		return nil, err
+	}
+	log.Println("[net] opponent from", conn.RemoteAddr())
+
+	n := newNetMatch(conn, true, local, remote)
+	n.rounds = rounds
+	conn.SetDeadline(time.Now().Add(NET_TIMEOUT))
+
+	hello, err := n.recv()
+	if err == nil && hello.Type != MSG_HELLO {
+		err = fmt.Errorf("unexpected message %q", hello.Type)
+	}
+	if err == nil && hello.Version != PROTOCOL_VERSION {
+		n.send(&message{Type: MSG_HELLO, Version: PROTOCOL_VERSION, Error: ErrorVersion.Error()})
+		err = ErrorVersion
+	}
+	if err == nil {
+		err = n.send(&message{
+			Type:     MSG_HELLO,
+			Version:  PROTOCOL_VERSION,
+			Rounds:   rounds,
+			Settings: local.settings(),
+			Lockstep: lockstep,
+		})
+	}
+	if err == nil && lockstep != nil {
+		err = n.setupLockstep(lockstep, hello.Settings)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Time{})
+	return n, nil
+}
+
+// Join the match hosted on addr
+func joinMatch(addr string, local, remote *Game) (*NetMatch, error) {
+	conn, err := net.DialTimeout("tcp", addr, NET_TIMEOUT)
+	if err != nil {
+		return nil, err
+	}
+
+	n := newNetMatch(conn, false, local, remote)
+	conn.SetDeadline(time.Now().Add(NET_TIMEOUT))
+
+	err = n.send(&message{Type: MSG_HELLO, Version: PROTOCOL_VERSION, Settings: local.settings()})
+	var hello *message
+	if err == nil {
+		hello, err = n.recv()
+	}
+	switch {
+	case err != nil:
+	case hello.Type != MSG_HELLO:
+		err = fmt.Errorf("unexpected message %q", hello.Type)
+	case hello.Error != "":
+		err = errors.New(hello.Error)
+	case hello.Version != PROTOCOL_VERSION:
+		err = ErrorVersion
+	case hello.Rounds <= 0:
+		err = fmt.Errorf("bad rounds %d", hello.Rounds)
+	case hello.Lockstep != nil:
+		err = n.setupLockstep(hello.Lockstep, hello.Settings)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	n.rounds = hello.Rounds
+	conn.SetDeadline(time.Time{})
+	return n, nil
+}
+
+// Step the remote game with the settings of the peer
+func (n *NetMatch) setupLockstep(ls *lockstepSettings, peer *gameSettings) error {
+	if ls.Delay < 0 || ls.Delay > MAX_INPUT_DELAY {
+		return fmt.Errorf("bad input delay %d", ls.Delay)
+	}
+	if ls.Garbage < GARBAGE_WELL || ls.Garbage >= GARBAGE_PATTERNS {
+		return fmt.Errorf("bad garbage pattern %d", ls.Garbage)
+	}
+	if peer == nil || peer.Previews < 0 || peer.Previews > MAX_PREVIEWS {
+		return errors.New("bad settings of the peer")
+	}
+
+	if err := n.remote.setLevels(peer.Levels, peer.StartLevel); err != nil {
+		return err
+	}
+	n.remote.setHandling(peer.Handling)
+	n.remote.setPreviews(peer.Previews)
+	for _, g := range []*Game{n.local, n.remote} {
+		g.setMode(MODE_MARATHON)
+		g.setGarbage(ls.Garbage, 0)
+	}
+	n.lockstep = newLockstep(n, ls.Delay)
+	return nil
+}
+
+func (n *NetMatch) recv() (*message, error) {
+	var msg message
+	if err := n.dec.Decode(&msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// Write msg to the peer, the connection is closed on error.
+// It's safe to call from other goroutines
+func (n *NetMatch) send(msg *message) error {
+	n.wm.Lock()
+	defer n.wm.Unlock()
+
+	n.conn.SetWriteDeadline(time.Now().Add(NET_TIMEOUT))
+	err := n.enc.Encode(msg)
+	if err != nil {
+		log.Println("[net] write:", err)
+		n.conn.Close()
+	}
+	return err
+}
+
+// Returns the index of the match winner (0 for local), -1 if not decided yet
+func (n *NetMatch) winner(wins [2]int) int {
+	return matchWinner(wins, n.rounds)
+}
+
+func (n *NetMatch) start() {
+	if n.lockstep != nil {
+		go n.lockstep.run()
+	} else {
+		n.local.attack = n.queueAttack
+		n.local.toppedOut = func() {
+			select {
+			case n.chanOver <- 0:
+			default:
+			}
+		}
+		go n.stream()
+		go n.sendAttacks()
+	}
+
+	go n.read()
+	go n.run()
+}
+
+func (n *NetMatch) run() {
+	defer n.close()
+
+	log.Printf("[net] start a match of best of %d, host: %v", n.rounds, n.host)
+	n.chanWins <- n.wins
+
+	if n.host {
+		n.err = n.runHost()
+	} else {
+		n.err = n.runGuest()
+	}
+
+	switch n.err {
+	case nil:
+		log.Printf("[net] match over, wins %v", n.wins)
+	case errAborted:
+		log.Println("[net] match aborted")
+		n.err = nil
+	default:
+		log.Println("[net] match ended:", n.err)
+	}
+}
+
+// The host counts down, starts the rounds and decides the winners
+func (n *NetMatch) runHost() error {
+	for n.winner(n.wins) < 0 {
+		n.round++
+		for i := n.countdown; i > 0; i-- {
+			n.send(&message{Type: MSG_COUNTDOWN, Count: i})
+			n.chanCountdown <- i
+			if err := n.wait(time.Second); err != nil {
+				return err
+			}
+		}
+		n.startRound(&message{Type: MSG_START, Round: n.round, Seed: time.Now().UnixNano()})
+
+		loser := -1
+		for loser < 0 {
+			select {
+			case loser = <-n.chanOver:
+			case msg, ok := <-n.chanRecv:
+				if !ok || msg.Type == MSG_BYE {
+					return ErrorDisconnected
+				}
+				// in lockstep the host knows the loser by itself
+				if msg.Type == MSG_OVER && msg.Round == n.round && n.lockstep == nil {
+					loser = 1
+				}
+			case <-n.chanAbort:
+				return errAborted
+			}
+		}
+
+		// the winner may top out in the meantime, it's a loss anyway
+		winner := 1 - loser
+		n.stopGames()
+		select {
+		case <-n.chanOver:
+		default:
+		}
+
+		n.wins[winner]++
+		log.Printf("[net] round %d won by %d, wins %v", n.round, winner, n.wins)
+		n.send(&message{Type: MSG_RESULT, Round: n.round, Wins: n.wins[:]})
+		n.chanWins <- n.wins
+
+		if n.winner(n.wins) < 0 {
+			if err := n.wait(ROUND_DELAY); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// The host starts a round, the lockstep gets it before the guest
+func (n *NetMatch) startRound(msg *message) {
+	if n.lockstep != nil {
+		n.lockstep.chanMsg <- msg
+	}
+	n.send(msg)
+	n.chanCountdown <- 0
+	if n.lockstep == nil {
+		n.local.start()
+	}
+}
+
+func (n *NetMatch) stopGames() {
+	n.local.stop()
+	if n.lockstep != nil {
+		n.remote.stop()
+	}
+}
+
+// Wait for d, stale messages of the last round are dropped
+func (n *NetMatch) wait(d time.Duration) error {
+	timeout := time.After(d)
+	for {
+		select {
+		case <-timeout:
+			return nil
+		case msg, ok := <-n.chanRecv:
+			if !ok || msg.Type == MSG_BYE {
+				return ErrorDisconnected
+			}
+		case <-n.chanAbort:
+			return errAborted
+		}
+	}
+}
+
+// The guest follows the host, and tells it when topped out
+func (n *NetMatch) runGuest() error {
+	for n.winner(n.wins) < 0 {
+		select {
+		case msg, ok := <-n.chanRecv:
+			if !ok || msg.Type == MSG_BYE {
+				return ErrorDisconnected
+			}
+			switch msg.Type {
+			case MSG_COUNTDOWN:
+				n.chanCountdown <- msg.Count
+			case MSG_START:
+				n.round = msg.Round
+				n.chanCountdown <- 0
+				if n.lockstep == nil {
+					n.local.start()
+				}
+			case MSG_RESULT:
+				if len(msg.Wins) != 2 {
+					return fmt.Errorf("bad wins %v", msg.Wins)
+				}
+				n.stopGames()
+				select {
+				case <-n.chanOver:
+				default:
+				}
+				n.wins = [2]int{msg.Wins[1], msg.Wins[0]}
+				n.chanWins <- n.wins
+			}
+		case loser := <-n.chanOver:
+			if loser == 0 && n.lockstep == nil {
+				n.send(&message{Type: MSG_OVER, Round: n.round})
+			}
+		case <-n.chanAbort:
+			return errAborted
+		}
+	}
+	return nil
+}
+
+// Handle messages from the peer, the match loop gets the control ones
+func (n *NetMatch) read() {
+	defer close(n.chanRecv)
+
+	for {
+		n.conn.SetReadDeadline(time.Now().Add(NET_TIMEOUT))
+		msg, err := n.recv()
+		if err != nil {
+			log.Println("[net] read:", err)
+			return
+		}
+
+		switch msg.Type {
+		case MSG_PING:
+		case MSG_STATE:
+			if msg.State == nil {
+				log.Println("[net] state missing")
+				return
+			}
+			if err := n.remote.applyDiff(msg.State); err != nil {
+				log.Println("[net] apply state:", err)
+				return
+			}
+		case MSG_ATTACK:
+			if msg.Rows > 0 && msg.Rows <= ROW {
+				n.local.sendGarbage(msg.Rows)
+			}
+		case MSG_INPUT, MSG_HASH, MSG_RESYNC, MSG_SNAPSHOT:
+			if n.lockstep != nil && !n.forward(n.lockstep.chanMsg, msg) {
+				return
+			}
+		default:
+			// the lockstep starts the round before any input of it
+			if msg.Type == MSG_START && n.lockstep != nil && !n.forward(n.lockstep.chanMsg, msg) {
+				return
+			}
+			select {
+			case n.chanRecv <- msg:
+			case <-n.chanDone:
+				return
+			}
+		}
+	}
+}
+
+// Returns false if the match is done
+func (n *NetMatch) forward(ch chan *message, msg *message) bool {
+	select {
+	case ch <- msg:
+		return true
+	case <-n.chanDone:
+		return false
+	}
+}
+
+// Send the state diffs of the local game, or pings if nothing changed
+func (n *NetMatch) stream() {
+	ticker := time.NewTicker(STATE_INTERVAL)
+	defer ticker.Stop()
+
+	var last *snapshot
+	sent := time.Now()
+	for {
+		select {
+		case <-ticker.C:
+		case <-n.chanDone:
+			return
+		}
+
+		s := n.local.snapshot()
+		if d := s.diff(last); d != nil {
+			n.send(&message{Type: MSG_STATE, State: d})
+			last = s
+			sent = time.Now()
+		} else if time.Since(sent) >= PING_INTERVAL {
+			n.send(&message{Type: MSG_PING})
+			sent = time.Now()
+		}
+	}
+}
+
+// Queue the garbage rows to send, called with g.m held so it never
+// waits for the network
+func (n *NetMatch) queueAttack(rows int) {
+	atomic.AddInt32(&n.attacks, int32(rows))
+	select {
+	case n.chanAttack <- true:
+	default:
+	}
+}
+
+// Send the rows queued, together if queued while sending
+func (n *NetMatch) sendAttacks() {
+	for {
+		select {
+		case <-n.chanAttack:
+		case <-n.chanDone:
+			return
+		}
+		if rows := atomic.SwapInt32(&n.attacks, 0); rows > 0 {
+			n.send(&message{Type: MSG_ATTACK, Rows: int(rows)})
+		}
+	}
+}
+
+// Say bye to the peer and stop the local game
+func (n *NetMatch) close() {
+	n.send(&message{Type: MSG_BYE})
+	n.conn.Close()
+	n.stopGames()
+	close(n.chanDone)
+}
+
+// Leave the match
+func (n *NetMatch) abort() {
+	select {
+	case n.chanAbort <- true:
+	default:
+	}
+}
@@ -0,0 +1,208 @@
+package tetris
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+const (
+	RESPONSE_HOST gtk.ResponseType = 1
+	RESPONSE_JOIN gtk.ResponseType = 2
+)
+
+// Ask for the address to host or join an online match
+func showOnlineDialog(parent *gtk.ApplicationWindow) {
+	dialog, err := gtk.DialogNew()
+	if err != nil {
+		log.Println("Could not create dialog:", err)
+		return
+	}
+	dialog.SetTitle(LABEL_ONLINE)
+	dialog.SetTransientFor(parent)
+	dialog.SetModal(true)
+	dialog.AddButton("Cancel", gtk.RESPONSE_CANCEL)
+	dialog.AddButton("Join", RESPONSE_JOIN)
+	dialog.AddButton("Host", RESPONSE_HOST)
+
+	label, _ := gtk.LabelNew("Address (host:port), the host listens on the port")
+	label.SetXAlign(0)
+	entry, _ := gtk.EntryNew()
+	entry.SetText(config.NetAddress)
+
+	content, _ := dialog.GetContentArea()
+	content.SetSpacing(6)
+	content.PackStart(label, false, false, 0)
+	content.PackStart(entry, false, false, 0)
+	dialog.ShowAll()
+
+	resp := dialog.Run()
+	addr, _ := entry.GetText()
+	dialog.Destroy()
+
+	if resp != RESPONSE_HOST && resp != RESPONSE_JOIN {
+		return
+	}
+	config.NetAddress = addr
+	if err := config.Save(); err != nil {
+		log.Println("Could not save config:", err)
+	}
+	showOnlineWindow(parent, resp == RESPONSE_HOST, addr)
+}
+
+// Show the local game and the mirror of the remote one,
+// the match starts once connected
+func showOnlineWindow(parent *gtk.ApplicationWindow, host bool, addr string) {
+	win, err := gtk.WindowNew(gtk.WINDOW_TOPLEVEL)
+	if err != nil {
+		log.Println("Could not create window:", err)
+		return
+	}
+	win.SetTransientFor(parent)
+	win.SetTitle("TETRIS " + LABEL_ONLINE)
+
+	local, remote := newConfiguredGame(), NewGame()
+	box, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 10)
+	for i, g := range []*Game{local, remote} {
+		v := newVersusView()
+		box.PackStart(initPlayerPanel([]string{"YOU", "OPPONENT"}[i], v), true, true, 10)
+		go v.show(g)
+	}
+
+	status, _ := gtk.LabelNew("")
+	header, _ := gtk.HeaderBarNew()
+	header.SetShowCloseButton(true)
+	header.SetCustomTitle(status)
+	win.SetTitlebar(header)
+
+	// no pause nor restart online
+	connectKeys(win, func(key uint, pressed bool) bool {
+		c, found := config.Keys.lookup(key)
+		switch {
+		case !found || c == CTRL_PAUSE || c == CTRL_RESTART:
+		case pressed:
+			local.press(c)
+		default:
+			local.release(c)
+		}
+		return found
+	}, local.releaseAll)
+
+	closed := make(chan bool)
+	win.Connect(SIGNAL_DESTROY, func() {
+		close(closed)
+	})
+
+	win.Add(box)
+	win.ShowAll()
+	local.setPreviews(config.Previews)
+
+	go func() {
+		n, err := connectMatch(host, addr, local, remote, status, closed)
+		if err != nil {
+			log.Println("[net] could not connect:", err)
+			showStatus(status, err.Error())
+			return
+		}
+
+		select {
+		case <-closed:
+			n.conn.Close()
+			return
+		default:
+		}
+		n.start()
+		showNetMatch(n, win, status, closed)
+	}()
+}
+
+// Host on the port of addr or join addr, cancelled if closed
+func connectMatch(host bool, addr string, local, remote *Game,
+	status *gtk.Label, closed chan bool) (*NetMatch, error) {
+	if !host {
+		showStatus(status, "Connecting to "+addr+"...")
+		return joinMatch(addr, local, remote)
+	}
+
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	l, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return nil, err
+	}
+	defer l.Close()
+
+	go func() {
+		<-closed
+		l.Close()
+	}()
+	var lockstep *lockstepSettings
+	if config.Lockstep {
+		lockstep = &lockstepSettings{Delay: config.InputDelay, Garbage: config.Garbage}
+	}
+	showStatus(status, "Waiting for an opponent on port "+port+"...")
+	return acceptMatch(l, local, remote, config.VersusRounds, lockstep)
+}
+
+// Show the countdown and wins, and the result once the match ends
+func showNetMatch(n *NetMatch, win *gtk.Window, status *gtk.Label, closed chan bool) {
+	var wins [2]int
+	for {
+		select {
+		case i := <-n.chanCountdown:
+			text := strconv.Itoa(i)
+			if i == 0 {
+				text = "GO"
+			}
+			showStatus(status, text)
+		case wins = <-n.chanWins:
+			showStatus(status, fmt.Sprintf("YOU %d : %d OPPONENT (best of %d)", wins[0], wins[1], n.rounds))
+		case <-closed:
+			n.abort()
+			closed = nil
+		case <-n.chanDone:
+			if closed == nil {
+				return
+			}
+
+			var text string
+			switch {
+			case n.err == ErrorDisconnected:
+				text = "Opponent left, YOU WIN"
+			case n.err != nil:
+				text = n.err.Error()
+			case n.winner(wins) == 0:
+				text = fmt.Sprintf("YOU WIN %d : %d", wins[0], wins[1])
+			default:
+				text = fmt.Sprintf("YOU LOSE %d : %d", wins[0], wins[1])
+			}
+			showStatus(status, text)
+			glib.IdleAdd(func() {
+				select {
+				case <-closed:
+				default:
+					showMatchResult(win, text)
+				}
+			})
+			return
+		}
+	}
+}
+
+func showStatus(status *gtk.Label, text string) {
+	status.SetMarkup(markup("#000", UNIT_SIZE/2, text))
+}
+
+func showMatchResult(win *gtk.Window, text string) {
+	msg := gtk.MessageDialogNew(win, gtk.DIALOG_MODAL,
+		gtk.MESSAGE_INFO, gtk.BUTTONS_OK, "%s", text)
+	msg.SetTitle("Match Result")
+	defer msg.Destroy()
+	msg.Run()
+}
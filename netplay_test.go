@@ -0,0 +1,213 @@
+package tetris
+
+import (
+	"encoding/json"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Host & join a match of best of 1 over loopback, with headless games
+func newLoopbackMatch(t *testing.T, lockstep *lockstepSettings) (host, guest *NetMatch) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	chanHost := make(chan *NetMatch)
+	go func() {
+		n, err := acceptMatch(l, newHeadlessGame(), newHeadlessGame(), 1, lockstep)
+		if err != nil {
+			t.Error("accept:", err)
+		}
+		chanHost <- n
+	}()
+
+	guest, err = joinMatch(l.Addr().String(), newHeadlessGame(), newHeadlessGame())
+	if err != nil {
+		t.Fatal("join:", err)
+	}
+	host = <-chanHost
+	if host == nil {
+		t.FailNow()
+	}
+	if guest.rounds != 1 {
+		t.Fatalf("guest got rounds %d, want 1", guest.rounds)
+	}
+
+	host.countdown = 0
+	for _, n := range []*NetMatch{host, guest} {
+		go drainMatch(n)
+		n.start()
+	}
+	return host, guest
+}
+
+func drainMatch(n *NetMatch) {
+	for {
+		select {
+		case <-n.chanCountdown:
+		case <-n.chanWins:
+		case <-n.chanDone:
+			return
+		}
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func waitDone(t *testing.T, n *NetMatch) {
+	select {
+	case <-n.chanDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the match to end")
+	}
+}
+
+func stateOf(g *Game) State {
+	g.m.Lock()
+	defer g.m.Unlock()
+	return g.state
+}
+
+func modelOf(g *Game) [ROW][COL]uint8 {
+	g.m.Lock()
+	defer g.m.Unlock()
+	return g.model
+}
+
+func TestNetMatchLoopback(t *testing.T) {
+	host, guest := newLoopbackMatch(t, nil)
+	g := guest.local
+
+	waitFor(t, "guest to start", func() bool { return stateOf(g).active() })
+	waitFor(t, "host to start", func() bool { return stateOf(host.local).active() })
+
+	// attack the host
+	g.m.Lock()
+	g.attack(2)
+	g.m.Unlock()
+	waitFor(t, "garbage to arrive", func() bool {
+		return atomic.LoadInt32(&host.local.pendingGarbage) == 2
+	})
+
+	// the host mirrors the board of the guest
+	for i := 0; i < 3; i++ {
+		g.hardDrop()
+	}
+	waitFor(t, "the mirror to catch up", func() bool {
+		return modelOf(host.remote) == modelOf(g)
+	})
+	waitFor(t, "the mirror state", func() bool {
+		s := host.remote.snapshot()
+		return s.diff(g.snapshot()) == nil
+	})
+
+	// top out the guest
+	for i := 0; i < 100 && stateOf(g).active(); i++ {
+		g.hardDrop()
+	}
+	if s := stateOf(g); s != STATE_GAMEOVER {
+		t.Fatalf("guest state %s, want game over", s)
+	}
+
+	waitDone(t, host)
+	waitDone(t, guest)
+	if host.err != nil || guest.err != nil {
+		t.Fatalf("match errors: host %v, guest %v", host.err, guest.err)
+	}
+	if host.wins != [2]int{1, 0} || guest.wins != [2]int{0, 1} {
+		t.Errorf("wins: host %v, guest %v", host.wins, guest.wins)
+	}
+	if s := stateOf(host.local); s != STATE_FINISHED {
+		t.Errorf("host state %s, want finished", s)
+	}
+}
+
+// Attacks are queued at once while the peer reads nothing, and sent
+// together when it does
+func TestNetMatchAttackQueued(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	n := newNetMatch(c1, true, newHeadlessGame(), newHeadlessGame())
+	defer close(n.chanDone)
+
+	done := make(chan bool)
+	go func() {
+		n.queueAttack(2)
+		n.queueAttack(4)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("attack blocked on the network")
+	}
+
+	go n.sendAttacks()
+	var msg message
+	if err := json.NewDecoder(c2).Decode(&msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != MSG_ATTACK || msg.Rows != 6 {
+		t.Errorf("received %+v", msg)
+	}
+}
+
+func TestNetMatchDisconnect(t *testing.T) {
+	host, guest := newLoopbackMatch(t, nil)
+
+	waitFor(t, "host to start", func() bool { return stateOf(host.local).active() })
+	guest.conn.Close()
+
+	waitDone(t, host)
+	if host.err != ErrorDisconnected {
+		t.Errorf("host error %v, want %v", host.err, ErrorDisconnected)
+	}
+	if s := stateOf(host.local); s != STATE_FINISHED {
+		t.Errorf("host state %s, want finished", s)
+	}
+	waitDone(t, guest)
+}
+
+func TestNetMatchVersion(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	chanErr := make(chan error)
+	go func() {
+		_, err := acceptMatch(l, newHeadlessGame(), newHeadlessGame(), 1, nil)
+		chanErr <- err
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	json.NewEncoder(conn).Encode(&message{Type: MSG_HELLO, Version: PROTOCOL_VERSION + 1})
+	var reply message
+	if err := json.NewDecoder(conn).Decode(&reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Error != ErrorVersion.Error() {
+		t.Errorf("reply error %q, want %q", reply.Error, ErrorVersion)
+	}
+	if err := <-chanErr; err != ErrorVersion {
+		t.Errorf("accept error %v, want %v", err, ErrorVersion)
+	}
+}
@@ -0,0 +1,93 @@
+package tetris
+
+import (
+	"log"
+
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// Modes started by the new game dialog, puzzles have their own
+var newGameModes = []Mode{
+	MODE_MARATHON, MODE_DIG, MODE_FINESSE, MODE_MASTER, MODE_FADING, MODE_INVISIBLE, MODE_CASCADE,
+}
+
+// Choose the mode, the starting level and the level up rule of a new game
+func showNewGameDialog(parent *gtk.ApplicationWindow, g *Game) {
+	dialog, err := gtk.DialogNew()
+	if err != nil {
+		log.Println("Could not create dialog:", err)
+		return
+	}
+	dialog.SetTitle("New Game")
+	dialog.SetTransientFor(parent)
+	dialog.SetModal(true)
+	dialog.AddButton("Cancel", gtk.RESPONSE_CANCEL)
+	dialog.AddButton("Start", gtk.RESPONSE_OK)
+	defer dialog.Destroy()
+
+	grid, _ := gtk.GridNew()
+	grid.SetRowSpacing(4)
+	grid.SetColumnSpacing(10)
+	addRow := func(row int, text string, w gtk.IWidget) {
+		label, _ := gtk.LabelNew(text)
+		label.SetXAlign(0)
+		grid.Attach(label, 0, row, 1, 1)
+		grid.Attach(w, 1, row, 1, 1)
+	}
+
+	mode, _ := gtk.ComboBoxTextNew()
+	for _, m := range newGameModes {
+		mode.AppendText(m.String())
+	}
+	mode.SetActive(0)
+	addRow(0, "Mode", mode)
+
+	start, _ := gtk.SpinButtonNewWithRange(0, LEVELS-1, 1)
+	start.SetValue(float64(config.StartLevel))
+	addRow(1, "Starting Level", start)
+
+	rule, _ := gtk.ComboBoxTextNew()
+	for r := LEVEL_FIXED; r < LEVEL_RULES; r++ {
+		rule.AppendText(r.String())
+	}
+	rule.SetActive(int(config.Levels.Rule))
+	rule.SetTooltipText("Level up every number of lines, 5 lines more each level, or by the goals of the config file")
+	addRow(2, "Level Up", rule)
+
+	lines, _ := gtk.SpinButtonNewWithRange(1, 100, 1)
+	lines.SetValue(float64(config.Levels.Lines))
+	addRow(3, "Lines per Level", lines)
+	lines.SetSensitive(config.Levels.Rule == LEVEL_FIXED)
+	rule.Connect(SIGNAL_CHANGED, func() {
+		lines.SetSensitive(LevelRule(rule.GetActive()) == LEVEL_FIXED)
+	})
+
+	content, _ := dialog.GetContentArea()
+	content.PackStart(grid, true, true, 10)
+	dialog.ShowAll()
+
+	if dialog.Run() != gtk.RESPONSE_OK {
+		return
+	}
+	levels := config.Levels
+	levels.Rule = LevelRule(rule.GetActive())
+	levels.Lines = lines.GetValueAsInt()
+	if err := g.setLevels(levels, start.GetValueAsInt()); err != nil {
+		log.Println("Could not set levels:", err)
+		msg := gtk.MessageDialogNew(parent, gtk.DIALOG_MODAL,
+			gtk.MESSAGE_ERROR, gtk.BUTTONS_OK, "%s", err.Error())
+		defer msg.Destroy()
+		msg.Run()
+		return
+	}
+	config.Levels = levels
+	config.StartLevel = start.GetValueAsInt()
+	if err := config.Save(); err != nil {
+		log.Println("Could not save config:", err)
+	}
+
+	if i := mode.GetActive(); i >= 0 {
+		g.setMode(newGameModes[i])
+	}
+	go g.restart()
+}
@@ -0,0 +1,260 @@
+package tetris
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Cells of a board as text
+const (
+	CHAR_EMPTY   = '.'
+	CHAR_BLOCK   = 'X'
+	CHAR_GARBAGE = 'G'
+
+	TEXT_SEPARATOR = "---" // between the boards or puzzles of a file
+)
+
+var ErrorBadBoard = errors.New("bad board")
+
+// Board, shapes & position of a game as text, e.g. to copy & paste, and
+// for test fixtures:
+//
+//	current: 15
+//	pos: 4 -1
+//	next: 53 25
+//	hold: 16
+//	board:
+//	....X......
+//	XXXXX.XXXXX
+//
+// The position is of the box of the current shape. All but the board are
+// optional, the rows are the bottom of the board
+type notation struct {
+	board [ROW][COL]uint8
+	shape int // current, -1 if none
+	pos   Point
+	nexts []int
+	hold  int // -1 if none
+}
+
+// The notation of g, the caller should hold g.m
+func (g *Game) notation() *notation {
+	n := &notation{
+		board: g.model,
+		shape: g.currShape.id,
+		pos:   g.pos,
+		nexts: shapeIds(g.queue),
+		hold:  -1,
+	}
+	if g.holdShape != nil {
+		n.hold = g.holdShape.id
+	}
+	return n
+}
+
+func (n *notation) String() string {
+	var b strings.Builder
+	if n.shape >= 0 {
+		fmt.Fprintf(&b, "current: %d\npos: %d %d\n", n.shape, n.pos.left, n.pos.top)
+	}
+	if len(n.nexts) > 0 {
+		fmt.Fprintf(&b, "next: %s\n", strings.Trim(fmt.Sprint(n.nexts), "[]"))
+	}
+	if n.hold >= 0 {
+		fmt.Fprintf(&b, "hold: %d\n", n.hold)
+	}
+	b.WriteString("board:\n")
+	b.WriteString(formatBoard(&n.board))
+	return b.String()
+}
+
+// Parse the text of notation.String, blank & comment lines are skipped
+func parseNotation(text string) (*notation, error) {
+	n := &notation{shape: -1, hold: -1}
+	var rows []string
+	inBoard, hasPos := false, false
+
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if inBoard {
+			rows = append(rows, line)
+			continue
+		}
+
+		err := n.parseField(line, &hasPos)
+		inBoard = line == "board:"
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+	}
+
+	if !inBoard || n.shape >= 0 && !hasPos {
+		return nil, fmt.Errorf("%w: the board and the position of the shape are needed", ErrorBadBoard)
+	}
+	var err error
+	if n.board, err = parseBoard(rows); err != nil {
+		return nil, err
+	}
+	if b := boardOf(&n.board); n.shape >= 0 && !b.fits(shapes[n.shape], n.pos) {
+		return nil, fmt.Errorf("%w: shape %d does not fit at %v", ErrorBadBoard, n.shape, n.pos)
+	}
+	return n, nil
+}
+
+func (n *notation) parseField(line string, hasPos *bool) error {
+	key, value, err := splitField(line)
+	if err != nil {
+		return err
+	}
+
+	switch key {
+	case "current":
+		n.shape, err = parseShape(value)
+	case "pos":
+		_, err = fmt.Sscanf(value, "%d %d", &n.pos.left, &n.pos.top)
+		if err != nil {
+			err = fmt.Errorf("%w: bad position %q", ErrorBadBoard, value)
+		}
+		*hasPos = true
+	case "next":
+		for _, s := range strings.Fields(value) {
+			id, err := parseShape(s)
+			if err != nil {
+				return err
+			}
+			n.nexts = append(n.nexts, id)
+		}
+	case "hold":
+		n.hold, err = parseShape(value)
+	case "board":
+	default:
+		err = fmt.Errorf("%w: unknown field %q", ErrorBadBoard, key)
+	}
+	return err
+}
+
+func (g *Game) loadNotation(n *notation) error {
+	g.m.Lock()
+	defer g.m.Unlock()
+	return g.setNotation(n)
+}
+
+// Set the board, shapes & position of a running game to n, to go on from
+// there. The caller should hold g.m
+func (g *Game) setNotation(n *notation) error {
+	if !g.running() {
+		return fmt.Errorf("%w: no game running", ErrorBadState)
+	}
+	if n.shape < 0 {
+		return fmt.Errorf("%w: no current shape", ErrorBadBoard)
+	}
+
+	g.oldShape = g.currShape
+	g.chanMoving <- &Moving{g.pos, InvalidPoint}
+
+	g.model = n.board
+	g.waterLevel = stackTop(&g.model)
+	g.currShape = shapes[n.shape]
+	g.pos = n.pos
+	g.queue = g.queue[:0]
+	for _, id := range n.nexts {
+		g.queue = append(g.queue, shapes[id])
+	}
+	g.fillQueue()
+	g.holdShape = nil
+	if n.hold >= 0 {
+		g.holdShape = shapes[n.hold]
+	}
+	g.held = false
+	g.entry = 0
+	g.falling = 0
+	g.spun = false
+	g.stats.landed = g.currShape.id
+
+	g.chanRedraw <- &Area{y: 0, y2: ROW - 1}
+	g.chanMoving <- &Moving{InvalidPoint, g.pos}
+	g.chanHold <- true
+	g.showNexts()
+	g.emit(EVENT_MOVE)
+	return nil
+}
+
+// Parse the rows of a board, the last row is the bottom of the board
+func parseBoard(rows []string) ([ROW][COL]uint8, error) {
+	var board [ROW][COL]uint8
+	if len(rows) > ROW {
+		return board, fmt.Errorf("%w: %d rows, at most %d", ErrorBadBoard, len(rows), ROW)
+	}
+
+	top := ROW - len(rows)
+	for i, row := range rows {
+		if len(row) != COL {
+			return board, fmt.Errorf("%w: row %q is not %d cells", ErrorBadBoard, row, COL)
+		}
+		for j, c := range row {
+			switch c {
+			case CHAR_EMPTY:
+			case CHAR_BLOCK:
+				board[top+i][j] = CELL_BLOCK
+			case CHAR_GARBAGE:
+				board[top+i][j] = CELL_GARBAGE
+			default:
+				return board, fmt.Errorf("%w: unknown cell %q", ErrorBadBoard, c)
+			}
+		}
+	}
+	return board, nil
+}
+
+// Rows of the board from the highest with blocks, as parsed by parseBoard
+func formatBoard(board *[ROW][COL]uint8) string {
+	var b strings.Builder
+	for i := stackTop(board); i < ROW; i++ {
+		for _, c := range board[i] {
+			switch c {
+			case CELL_EMPTY:
+				b.WriteByte(CHAR_EMPTY)
+			case CELL_GARBAGE:
+				b.WriteByte(CHAR_GARBAGE)
+			default:
+				b.WriteByte(CHAR_BLOCK)
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// The highest row with blocks, ROW if none
+func stackTop(board *[ROW][COL]uint8) int {
+	for i := range board {
+		for _, c := range board[i] {
+			if c > 0 {
+				return i
+			}
+		}
+	}
+	return ROW
+}
+
+// Split a "key: value" line
+func splitField(line string) (key, value string, err error) {
+	i := strings.Index(line, ":")
+	if i < 0 {
+		return "", "", fmt.Errorf("%w: %q is not a field", ErrorBadBoard, line)
+	}
+	return line[:i], strings.TrimSpace(line[i+1:]), nil
+}
+
+func parseShape(s string) (int, error) {
+	id, err := strconv.Atoi(s)
+	if err != nil || id < 0 || id >= len(shapes) {
+		return 0, fmt.Errorf("%w: bad shape %q", ErrorBadBoard, s)
+	}
+	return id, nil
+}
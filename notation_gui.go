@@ -0,0 +1,75 @@
+package tetris
+
+import (
+	"log"
+
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// Copy the notation of the game to the clipboard
+func copyBoard(g *Game) {
+	clipboard, err := gtk.ClipboardGet(gdk.SELECTION_CLIPBOARD)
+	if err != nil {
+		log.Println("Could not get clipboard:", err)
+		return
+	}
+
+	g.m.Lock()
+	text := g.notation().String()
+	g.m.Unlock()
+	clipboard.SetText(text)
+}
+
+// Copy the board of the game to the clipboard as a fumen
+func copyFumen(g *Game) {
+	clipboard, err := gtk.ClipboardGet(gdk.SELECTION_CLIPBOARD)
+	if err != nil {
+		log.Println("Could not get clipboard:", err)
+		return
+	}
+
+	g.m.Lock()
+	text, err := notationFumen(g.notation())
+	g.m.Unlock()
+	if err != nil {
+		log.Println("Could not encode fumen:", err)
+		return
+	}
+	clipboard.SetText(text)
+}
+
+// Pause the game and go on from the notation or fumen in the clipboard
+func pasteBoard(parent *gtk.ApplicationWindow, g *Game) {
+	clipboard, err := gtk.ClipboardGet(gdk.SELECTION_CLIPBOARD)
+	if err != nil {
+		log.Println("Could not get clipboard:", err)
+		return
+	}
+	text, err := clipboard.WaitForText()
+	if err != nil {
+		log.Println("Could not read clipboard:", err)
+		return
+	}
+
+	var n *notation
+	if isFumen(text) {
+		var pages []fumenPage
+		if pages, err = decodeFumen(text); err == nil {
+			n, err = fumenNotation(pages)
+		}
+	} else {
+		n, err = parseNotation(text)
+	}
+	if err == nil {
+		g.pause()
+		err = g.loadNotation(n)
+	}
+	if err != nil {
+		log.Println("Could not paste board:", err)
+		msg := gtk.MessageDialogNew(parent, gtk.DIALOG_MODAL,
+			gtk.MESSAGE_ERROR, gtk.BUTTONS_OK, "%s", err.Error())
+		defer msg.Destroy()
+		msg.Run()
+	}
+}
@@ -0,0 +1,97 @@
+package tetris
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNotation(t *testing.T) {
+	g := newHeadlessGame()
+	g.setPreviews(3)
+	g.seed(1)
+	g.setMode(MODE_DIG)
+	g.stepped = true
+	g.start()
+	g.hold()
+
+	g.m.Lock()
+	n := g.notation()
+	g.m.Unlock()
+
+	parsed, err := parseNotation(n.String())
+	if err != nil {
+		t.Fatalf("parse %q: %v", n, err)
+	}
+	if !reflect.DeepEqual(parsed, n) {
+		t.Errorf("parsed %+v, want %+v", parsed, n)
+	}
+
+	bad := []string{
+		"current: 53\nboard:\n",                       // no position
+		"current: 53\npos: 0 x\nboard:\n",             // bad position
+		"current: 53\npos: 0 0\n",                     // no board
+		"current: 53\npos: 0 17\nboard:\nXXXXXXXXXX.", // on a block
+		"current: 53\npos: 9 0\nboard:\n",             // out of the board
+		"next: 53 -1\nboard:\n",                       // bad shape
+		"level: 1\nboard:\n",                          // unknown field
+	}
+	for _, text := range bad {
+		if _, err := parseNotation(text); !errors.Is(err, ErrorBadBoard) {
+			t.Errorf("parsed %q: %v, want %v", text, err, ErrorBadBoard)
+		}
+	}
+}
+
+// Each fixture of testdata/drops is the notation before a hard drop,
+// and after it
+func TestDropFixtures(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "drops", "*.txt"))
+	if err != nil || len(paths) == 0 {
+		t.Fatal("no fixtures", err)
+	}
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts := strings.Split(string(data), "\n"+TEXT_SEPARATOR+"\n")
+		if len(parts) != 2 {
+			t.Fatalf("%s: want the notations before & after", path)
+		}
+		before, err := parseNotation(parts[0])
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		after, err := parseNotation(parts[1])
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+
+		g := newHeadlessGame()
+		g.stepped = true
+		g.start()
+		g.m.Lock()
+		if err := g.setNotation(before); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		g.m.Unlock()
+		g.hardDrop()
+
+		g.m.Lock()
+		got := g.notation()
+		g.m.Unlock()
+		if got.board != after.board {
+			t.Errorf("%s: board after the drop\n%s want\n%s", path,
+				formatBoard(&got.board), formatBoard(&after.board))
+		}
+		if after.shape >= 0 && (got.shape != after.shape || got.pos != after.pos) {
+			t.Errorf("%s: shape %d at %v after the drop, want %d at %v", path,
+				got.shape, got.pos, after.shape, after.pos)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package tetris
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+const (
+	SIGNAL_CLICKED       = "clicked"
+	SIGNAL_TOGGLED       = "toggled"
+	SIGNAL_VALUE_CHANGED = "value-changed"
+	SIGNAL_CHANGED       = "changed"
+
+	LABEL_PRESS_KEY = "Press a key..."
+)
+
+// Key bindings shown in a tab of the dialog
+type keyTab struct {
+	name string
+	keys **KeyBindings
+}
+
+// The control waiting for a key press
+type keyCapture struct {
+	keys    **KeyBindings
+	control Control
+	refresh func()
+}
+
+var capture *keyCapture // nil if not capturing
+
+func cancelCapture() {
+	if c := capture; c != nil {
+		capture = nil
+		c.refresh()
+	}
+}
+
+// Show the preferences dialog to rebind keys and tune handling, saved on close
+func showPrefsDialog(parent *gtk.ApplicationWindow, g *Game) {
+	dialog, err := gtk.DialogNew()
+	if err != nil {
+		log.Println("Could not create dialog:", err)
+		return
+	}
+	dialog.SetTitle(LABEL_PREFS)
+	dialog.SetTransientFor(parent)
+	dialog.SetModal(true)
+	dialog.AddButton("Reset", gtk.RESPONSE_REJECT)
+	dialog.AddButton("Close", gtk.RESPONSE_CLOSE)
+
+	// keys of the two versus players should not conflict
+	keys := keyTab{"Keys", &config.Keys}
+	versus := []keyTab{
+		{"Versus P1", &config.VersusKeys[0]},
+		{"Versus P2", &config.VersusKeys[1]},
+	}
+
+	notebook, _ := gtk.NotebookNew()
+	var refreshes []func()
+	addPage := func(name string, page *gtk.Grid, refresh func()) {
+		label, _ := gtk.LabelNew(name)
+		page.SetMarginTop(10)
+		page.SetMarginStart(10)
+		page.SetMarginEnd(10)
+		notebook.AppendPage(page, label)
+		refreshes = append(refreshes, refresh)
+	}
+
+	page, refresh := keysGrid(dialog, keys, nil)
+	addPage(keys.name, page, refresh)
+	for i, tab := range versus {
+		page, refresh := keysGrid(dialog, tab, versus[1-i:2-i])
+		addPage(tab.name, page, refresh)
+	}
+	page, refresh = handlingGrid()
+	addPage("Game", page, refresh)
+
+	content, _ := dialog.GetContentArea()
+	content.PackStart(notebook, true, true, 10)
+	dialog.ShowAll()
+
+	for dialog.Run() == gtk.RESPONSE_REJECT {
+		cancelCapture()
+		defaults := DefaultConfig()
+		config.Keys = defaults.Keys
+		config.VersusKeys = defaults.VersusKeys
+		config.Handling = defaults.Handling
+		config.Previews = defaults.Previews
+		config.AutoPause = defaults.AutoPause
+		config.Garbage = defaults.Garbage
+		config.DigRows = defaults.DigRows
+		config.FadeFrames = defaults.FadeFrames
+		config.VersusRounds = defaults.VersusRounds
+		config.Lockstep = defaults.Lockstep
+		config.InputDelay = defaults.InputDelay
+		config.SpectatorPort = defaults.SpectatorPort
+		for _, refresh := range refreshes {
+			refresh()
+		}
+	}
+	capture = nil
+	dialog.Destroy()
+
+	go g.setHandling(config.Handling)
+	go g.setPreviews(config.Previews)
+	go g.setGarbage(config.Garbage, config.DigRows)
+	go g.setFadeFrames(config.FadeFrames)
+	updateSpectatorServer(g)
+	if err := config.Save(); err != nil {
+		log.Println("Could not save config:", err)
+	}
+}
+
+// Rows of controls and their keys, keys are captured by the dialog.
+// A key is bound once in tab and its rivals
+func keysGrid(dialog *gtk.Dialog, tab keyTab, rivals []keyTab) (*gtk.Grid, func()) {
+	grid, _ := gtk.GridNew()
+	grid.SetRowSpacing(4)
+	grid.SetColumnSpacing(10)
+
+	var keyLabels [CONTROLS]*gtk.Label
+	refresh := func() {
+		for c, l := range keyLabels {
+			l.SetLabel(keyNames((*tab.keys)[c]))
+		}
+	}
+
+	for i := CTRL_LEFT; i < CONTROLS; i++ {
+		c := i // for closures
+		name, _ := gtk.LabelNew(c.Label())
+		name.SetXAlign(0)
+		keyLabels[c], _ = gtk.LabelNew("")
+
+		btnAdd, _ := gtk.ButtonNewWithLabel("Add")
+		btnAdd.Connect(SIGNAL_CLICKED, func() {
+			cancelCapture()
+			capture = &keyCapture{tab.keys, c, refresh}
+			keyLabels[c].SetLabel(LABEL_PRESS_KEY)
+		})
+
+		btnClear, _ := gtk.ButtonNewWithLabel("Clear")
+		btnClear.Connect(SIGNAL_CLICKED, func() {
+			cancelCapture()
+			(*tab.keys).clear(c)
+			refresh()
+		})
+
+		grid.Attach(name, 0, int(c), 1, 1)
+		grid.Attach(keyLabels[c], 1, int(c), 1, 1)
+		grid.Attach(btnAdd, 2, int(c), 1, 1)
+		grid.Attach(btnClear, 3, int(c), 1, 1)
+	}
+	refresh()
+
+	dialog.Connect(SIGNAL_KEY_PRESS_EVENT, func(d *gtk.Dialog, ev *gdk.Event) bool {
+		if capture == nil || capture.keys != tab.keys {
+			return false
+		}
+		c := capture.control
+		capture = nil
+		defer refresh()
+
+		keyVal := gdk.KeyvalToLower((&gdk.EventKey{ev}).KeyVal())
+		if other, found := (*tab.keys).lookup(keyVal); found && other != c {
+			if !confirmRebind(d, keyVal, other.Label(), c) {
+				return true
+			}
+		}
+		for _, rival := range rivals {
+			if other, found := (*rival.keys).lookup(keyVal); found {
+				if !confirmRebind(d, keyVal, other.Label()+" of "+rival.name, c) {
+					return true
+				}
+				(*rival.keys).unbindKey(keyVal)
+			}
+		}
+		(*tab.keys).bind(c, keyVal)
+		return true
+	})
+
+	return grid, refresh
+}
+
+// Handling settings in frames, and other game settings
+func handlingGrid() (*gtk.Grid, func()) {
+	grid, _ := gtk.GridNew()
+	grid.SetRowSpacing(4)
+	grid.SetColumnSpacing(10)
+
+	h := &config.Handling
+	values := []struct {
+		label   string
+		tooltip string
+		value   *int
+		max     float64
+	}{
+		{"DAS (frames)", "Delayed auto shift", &h.DAS, 30},
+		{"ARR (frames)", "Auto repeat rate, 0 = instant", &h.ARR, 10},
+		{"Soft Drop Factor", "Gravity multiplier, 0 = instant", &h.SoftDropFactor, 40},
+		{"Entry Delay (frames)", "Frames before the next shape moves", &h.EntryDelay, 30},
+		{"Next Previews", "Number of next shapes shown", &config.Previews, MAX_PREVIEWS},
+		{"Dig Rows", "Garbage rows at start of dig mode", &config.DigRows, ROW - SHAPE_SIZE},
+		{"Fade Out (frames)", "Frames for the blocks locked to fade out in fading mode", &config.FadeFrames, 60 * FPS},
+		{"Versus Rounds", "Best of rounds in a versus match", &config.VersusRounds, 9},
+		{"Input Delay (frames)", "Frames before inputs apply in lockstep online matches", &config.InputDelay, MAX_INPUT_DELAY},
+		{"Spectator Port", "Serve the game to spectators on the port, 0 = off", &config.SpectatorPort, 65535},
+	}
+
+	var spins []*gtk.SpinButton
+	for i, v := range values {
+		value := v.value // for closures
+		label, _ := gtk.LabelNew(v.label)
+		label.SetXAlign(0)
+		label.SetTooltipText(v.tooltip)
+
+		spin, _ := gtk.SpinButtonNewWithRange(0, v.max, 1)
+		spin.SetValue(float64(*value))
+		spin.Connect(SIGNAL_VALUE_CHANGED, func(sb *gtk.SpinButton) {
+			*value = sb.GetValueAsInt()
+		})
+		spins = append(spins, spin)
+
+		grid.Attach(label, 0, i, 1, 1)
+		grid.Attach(spin, 1, i, 1, 1)
+	}
+
+	charge, _ := gtk.CheckButtonNewWithLabel("Charge DAS during entry delay")
+	charge.SetActive(h.ChargeDAS)
+	charge.Connect(SIGNAL_TOGGLED, func(cb *gtk.CheckButton) {
+		h.ChargeDAS = cb.GetActive()
+	})
+	grid.Attach(charge, 0, len(values), 2, 1)
+
+	lockstep, _ := gtk.CheckButtonNewWithLabel("Host online matches in lockstep")
+	lockstep.SetActive(config.Lockstep)
+	lockstep.Connect(SIGNAL_TOGGLED, func(cb *gtk.CheckButton) {
+		config.Lockstep = cb.GetActive()
+	})
+	grid.Attach(lockstep, 0, len(values)+2, 2, 1)
+
+	autoPause, _ := gtk.CheckButtonNewWithLabel("Pause when the window loses focus")
+	autoPause.SetActive(config.AutoPause)
+	autoPause.Connect(SIGNAL_TOGGLED, func(cb *gtk.CheckButton) {
+		config.AutoPause = cb.GetActive()
+	})
+	grid.Attach(autoPause, 0, len(values)+3, 2, 1)
+
+	garbageLabel, _ := gtk.LabelNew("Garbage Holes")
+	garbageLabel.SetXAlign(0)
+	garbage, _ := gtk.ComboBoxTextNew()
+	for p := GARBAGE_WELL; p < GARBAGE_PATTERNS; p++ {
+		garbage.AppendText(p.String())
+	}
+	garbage.SetActive(int(config.Garbage))
+	garbage.Connect(SIGNAL_CHANGED, func(cb *gtk.ComboBoxText) {
+		config.Garbage = GarbagePattern(cb.GetActive())
+	})
+	grid.Attach(garbageLabel, 0, len(values)+1, 1, 1)
+	grid.Attach(garbage, 1, len(values)+1, 1, 1)
+
+	refresh := func() {
+		for i, v := range values {
+			spins[i].SetValue(float64(*v.value))
+		}
+		charge.SetActive(h.ChargeDAS)
+		garbage.SetActive(int(config.Garbage))
+		lockstep.SetActive(config.Lockstep)
+		autoPause.SetActive(config.AutoPause)
+	}
+	return grid, refresh
+}
+
+// Ask whether to move key from one control to another
+func confirmRebind(parent *gtk.Dialog, key uint, from string, to Control) bool {
+	msg := gtk.MessageDialogNew(parent, gtk.DIALOG_MODAL,
+		gtk.MESSAGE_QUESTION, gtk.BUTTONS_YES_NO,
+		"%s", fmt.Sprintf("'%s' is already bound to '%s'. Rebind it to '%s'?",
+			gdk.KeyValName(key), from, to.Label()))
+	defer msg.Destroy()
+	return msg.Run() == gtk.RESPONSE_YES
+}
+
+func keyNames(keys []uint) string {
+	if len(keys) == 0 {
+		return "-"
+	}
+	names := make([]string, len(keys))
+	for i, k := range keys {
+		names[i] = gdk.KeyValName(k)
+	}
+	return strings.Join(names, ", ")
+}
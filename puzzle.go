@@ -0,0 +1,410 @@
+package tetris
+
+import (
+	"bufio"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+//go:embed puzzles/pack.txt
+var bundledPack string
+
+var ErrorBadPuzzle = errors.New("bad puzzle")
+
+// Goal of a puzzle, checked when the pieces run out
+type puzzleGoal int
+
+const (
+	GOAL_LINES        puzzleGoal = iota // clear n lines
+	GOAL_PERFECT                        // clear all the blocks
+	GOAL_TSPIN_DOUBLE                   // clear 2 lines by a T-spin
+
+	GOALS // number of goals
+)
+
+var goalNames = [GOALS]string{"lines", "perfect", "tspin_double"}
+
+func (goal puzzleGoal) String() string {
+	return goalNames[goal]
+}
+
+// A starting board, a fixed queue of shapes and a goal
+type puzzle struct {
+	name  string
+	goal  puzzleGoal
+	lines int // of GOAL_LINES
+	board [ROW][COL]uint8
+	queue []int // shape ids, the first is played first
+	hold  int   // shape id, -1 if none
+}
+
+// The goal in words
+func (p *puzzle) describe() string {
+	switch p.goal {
+	case GOAL_LINES:
+		return fmt.Sprintf("Clear %d lines", p.lines)
+	case GOAL_PERFECT:
+		return "Perfect clear"
+	default:
+		return "T-spin double"
+	}
+}
+
+// Parse puzzles of the text format, e.g.
+//
+//	# comment
+//	name: Tetris
+//	goal: lines 4        (or perfect, tspin_double)
+//	queue: 15 53
+//	hold: 25             (optional)
+//	fumen: v115@...      (optional, the board, queue, hold & goal if not given)
+//	board:
+//	XXXXXXXXXX.
+//	---                  (then the next puzzle)
+func parsePuzzles(r io.Reader) ([]*puzzle, error) {
+	var puzzles []*puzzle
+	var p *puzzle
+	var rows []string
+	inBoard := false
+
+	// add the puzzle parsed so far, if any
+	end := func() error {
+		if p == nil {
+			return nil
+		}
+		if inBoard {
+			var err error
+			if p.board, err = parseBoard(rows); err != nil {
+				return err
+			}
+		}
+		if p.name == "" || len(p.queue) == 0 {
+			return fmt.Errorf("%w: a name and a queue are needed", ErrorBadPuzzle)
+		}
+		if p.goal == GOAL_LINES && p.lines == 0 {
+			return fmt.Errorf("%w: no goal", ErrorBadPuzzle)
+		}
+		puzzles = append(puzzles, p)
+		p, rows, inBoard = nil, nil, false
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var err error
+		switch {
+		case line == TEXT_SEPARATOR:
+			err = end()
+		case inBoard:
+			rows = append(rows, line)
+		default:
+			if p == nil {
+				p = &puzzle{hold: -1}
+			}
+			err = p.parseField(line)
+			inBoard = line == "board:"
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := end(); err != nil {
+		return nil, err
+	}
+	return puzzles, nil
+}
+
+// Parse a field of the puzzle
+func (p *puzzle) parseField(line string) error {
+	key, value, err := splitField(line)
+	if err != nil {
+		return err
+	}
+
+	switch key {
+	case "name":
+		p.name = value
+	case "goal":
+		return p.parseGoal(strings.Fields(value))
+	case "queue":
+		p.queue = nil
+		for _, s := range strings.Fields(value) {
+			id, err := parseShape(s)
+			if err != nil {
+				return err
+			}
+			p.queue = append(p.queue, id)
+		}
+	case "hold":
+		id, err := parseShape(value)
+		if err != nil {
+			return err
+		}
+		p.hold = id
+	case "fumen":
+		return p.parseFumen(value)
+	case "board":
+	default:
+		return fmt.Errorf("%w: unknown field %q", ErrorBadPuzzle, key)
+	}
+	return nil
+}
+
+// Take the board of the fumen, and the queue, hold & goal if not given
+func (p *puzzle) parseFumen(text string) error {
+	pages, err := decodeFumen(text)
+	if err != nil {
+		return err
+	}
+	f, err := fumenPuzzle(pages)
+	if err != nil {
+		return err
+	}
+	p.board = f.board
+	if len(p.queue) == 0 {
+		p.queue = f.queue
+	}
+	if p.hold < 0 {
+		p.hold = f.hold
+	}
+	if p.goal == GOAL_LINES && p.lines == 0 {
+		p.goal, p.lines = f.goal, f.lines
+	}
+	return nil
+}
+
+func (p *puzzle) parseGoal(fields []string) error {
+	if len(fields) == 0 {
+		return fmt.Errorf("%w: no goal", ErrorBadPuzzle)
+	}
+	goal := GOALS
+	for i, name := range goalNames {
+		if name == fields[0] {
+			goal = puzzleGoal(i)
+		}
+	}
+
+	switch {
+	case goal == GOAL_LINES && len(fields) == 2:
+		n, err := strconv.Atoi(fields[1])
+		if err != nil || n < 1 {
+			return fmt.Errorf("%w: bad lines %q", ErrorBadPuzzle, fields[1])
+		}
+		p.lines = n
+	case goal == GOALS || goal == GOAL_LINES || len(fields) != 1:
+		return fmt.Errorf("%w: bad goal %q", ErrorBadPuzzle, strings.Join(fields, " "))
+	}
+	p.goal = goal
+	return nil
+}
+
+// Puzzles bundled with the game
+func bundledPuzzles() []*puzzle {
+	puzzles, err := parsePuzzles(strings.NewReader(bundledPack))
+	if err != nil {
+		log.Fatalln("bad bundled puzzles:", err)
+	}
+	return puzzles
+}
+
+func loadPuzzles(path string) ([]*puzzle, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parsePuzzles(f)
+}
+
+// Deals the queue of a puzzle, then nil
+type puzzleRandomizer struct {
+	queue []int
+	i     int
+}
+
+func (r *puzzleRandomizer) next() *Shape {
+	if r.i >= len(r.queue) {
+		return nil
+	}
+	r.i++
+	return shapes[r.queue[r.i-1]]
+}
+
+func (r *puzzleRandomizer) state() uint64 {
+	return uint64(r.i)
+}
+
+func (r *puzzleRandomizer) setState(s uint64) {
+	r.i = int(s)
+}
+
+// Play p in puzzle mode, from the next start
+func (g *Game) setPuzzle(p *puzzle) {
+	g.m.Lock()
+	defer g.m.Unlock()
+	g.mode = MODE_PUZZLE
+	g.puzzle = p
+}
+
+// Set up the board, queue & hold of the puzzle, the caller should hold g.m
+func (g *Game) initPuzzle() {
+	p := g.puzzle
+	log.Printf("[puzzle] %s: %s", p.name, p.describe())
+
+	g.model = p.board
+	g.waterLevel = stackTop(&g.model)
+	g.chanRedraw <- &Area{y: 0, y2: ROW - 1}
+
+	g.useRandomizer(&puzzleRandomizer{queue: p.queue})
+	g.holdShape = nil
+	if p.hold >= 0 {
+		g.holdShape = shapes[p.hold]
+	}
+}
+
+// Take the hold shape to play once out of pieces, nil if none.
+// The caller should hold g.m
+func (g *Game) takeHold() *Shape {
+	s := g.holdShape
+	if s != nil {
+		g.holdShape = nil
+		g.chanHold <- true
+		g.emit(EVENT_HOLD)
+	}
+	return s
+}
+
+// Finish the puzzle once out of pieces, the caller should hold g.m
+func (g *Game) checkPuzzle() {
+	p := g.puzzle
+	if !g.reached(p) {
+		log.Printf("[puzzle] %s failed", p.name)
+		g.changeState(STATE_GAMEOVER)
+		return
+	}
+
+	log.Printf("[puzzle] %s solved", p.name)
+	g.changeState(STATE_FINISHED)
+	if g.puzzleSolved != nil {
+		g.puzzleSolved(p)
+	}
+}
+
+// Returns true if the goal of p is reached, the caller should hold g.m
+func (g *Game) reached(p *puzzle) bool {
+	switch p.goal {
+	case GOAL_LINES:
+		return int(g.rows) >= p.lines
+	case GOAL_PERFECT:
+		return boardOf(&g.model) == bitboard{}
+	default:
+		return g.tspinDoubles > 0
+	}
+}
+
+// Returns true if the current shape is a T turned (not shifted) since
+// it landed, with 3 of the 4 corners of its center blocked by the walls,
+// the floor or blocks. The caller should hold g.m
+func (g *Game) tspin() bool {
+	x, y, ok := tCenter(g.currShape)
+	if !g.spun || !ok {
+		return false
+	}
+
+	blocked := 0
+	for _, d := range [][2]int{{-1, -1}, {1, -1}, {-1, 1}, {1, 1}} {
+		i, j := g.pos.left+x+d[0], g.pos.top+y+d[1]
+		if i < 0 || i >= COL || j >= ROW || j >= 0 && g.model[j][i] > 0 {
+			blocked++
+		}
+	}
+	return blocked >= 3
+}
+
+// Center of a T shape in its box, i.e. the cell of 3 neighbours of the
+// 4 cells; false if not a T
+func tCenter(s *Shape) (x, y int, ok bool) {
+	d := &s.data
+	at := func(i, j int) bool {
+		return i >= 0 && i < SHAPE_SIZE && j >= 0 && j < SHAPE_SIZE && d[j][i] > 0
+	}
+
+	cells := 0
+	for j := 0; j < SHAPE_SIZE; j++ {
+		for i := 0; i < SHAPE_SIZE; i++ {
+			if !at(i, j) {
+				continue
+			}
+			cells++
+			neighbours := 0
+			for _, n := range [][2]int{{i - 1, j}, {i + 1, j}, {i, j - 1}, {i, j + 1}} {
+				if at(n[0], n[1]) {
+					neighbours++
+				}
+			}
+			if neighbours == 3 {
+				x, y, ok = i, j, true
+			}
+		}
+	}
+	return x, y, ok && cells == 4
+}
+
+// Names of the solved puzzles, saved beside the config file
+type puzzleProgress map[string]bool
+
+func puzzleProgressPath() (string, error) {
+	path, err := configPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), "puzzles.json"), nil
+}
+
+// Load the progress, empty on any error
+func loadPuzzleProgress() puzzleProgress {
+	progress := make(puzzleProgress)
+	path, err := puzzleProgressPath()
+	if err != nil {
+		return progress
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Println("could not read puzzle progress:", err)
+		}
+		return progress
+	}
+	if err := json.Unmarshal(data, &progress); err != nil {
+		log.Printf("could not parse puzzle progress %s: %v", path, err)
+	}
+	return progress
+}
+
+func (progress puzzleProgress) save() error {
+	path, err := puzzleProgressPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeJSON(path, progress)
+}
@@ -0,0 +1,168 @@
+package tetris
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+const LABEL_SOLVED = "✓"
+
+// Name & goal of the puzzle played in puzzle mode, or the grade in master
+// mode. g.m is held by the sender of the state or score
+func (v *view) showModeInfo(g *Game) {
+	if v.modeLabel == nil {
+		return
+	}
+	text := ""
+	if p := g.puzzle; g.mode == MODE_PUZZLE && p != nil {
+		text = fmt.Sprintf("%s\n%s", p.name, p.describe())
+	} else if g.mode == MODE_MASTER {
+		text = "GRADE " + g.grade()
+	}
+	v.modeLabel.SetMarkup(markup("#000", UNIT_SIZE/2, text))
+}
+
+// Mark the puzzle solved in the progress file
+func savePuzzleSolved(p *puzzle) {
+	go func() {
+		progress := loadPuzzleProgress()
+		progress[p.name] = true
+		if err := progress.save(); err != nil {
+			log.Println("Could not save puzzle progress:", err)
+		}
+	}()
+}
+
+// Choose a puzzle of the bundled pack or of a file, and play it
+func showPuzzleDialog(parent *gtk.ApplicationWindow, g *Game) {
+	dialog, err := gtk.DialogNew()
+	if err != nil {
+		log.Println("Could not create dialog:", err)
+		return
+	}
+	dialog.SetTitle(LABEL_PUZZLE)
+	dialog.SetTransientFor(parent)
+	dialog.SetModal(true)
+	dialog.AddButton("Open File...", gtk.RESPONSE_APPLY)
+	dialog.AddButton("Paste Fumen", gtk.RESPONSE_YES)
+	dialog.AddButton("Cancel", gtk.RESPONSE_CANCEL)
+	dialog.AddButton("Play", gtk.RESPONSE_OK)
+	defer dialog.Destroy()
+
+	combo, _ := gtk.ComboBoxTextNew()
+	goal, _ := gtk.LabelNew("")
+	goal.SetXAlign(0)
+
+	puzzles := bundledPuzzles()
+	fill := func() {
+		progress := loadPuzzleProgress()
+		combo.RemoveAll()
+		first := -1 // the first unsolved
+		for i, p := range puzzles {
+			name := p.name
+			if progress[p.name] {
+				name += " " + LABEL_SOLVED
+			} else if first < 0 {
+				first = i
+			}
+			combo.AppendText(name)
+		}
+		if first < 0 {
+			first = 0
+		}
+		combo.SetActive(first)
+	}
+	combo.Connect(SIGNAL_CHANGED, func() {
+		if i := combo.GetActive(); i >= 0 && i < len(puzzles) {
+			goal.SetText(puzzles[i].describe())
+		}
+	})
+	fill()
+
+	content, _ := dialog.GetContentArea()
+	content.SetSpacing(6)
+	content.PackStart(combo, false, false, 0)
+	content.PackStart(goal, false, false, 0)
+	dialog.ShowAll()
+
+	for {
+		switch dialog.Run() {
+		case gtk.RESPONSE_APPLY:
+			if loaded := choosePuzzleFile(dialog); loaded != nil {
+				puzzles = loaded
+				fill()
+			}
+			continue
+		case gtk.RESPONSE_YES:
+			if p := pasteFumenPuzzle(dialog); p != nil {
+				puzzles = append(puzzles, p)
+				fill()
+				combo.SetActive(len(puzzles) - 1)
+			}
+			continue
+		case gtk.RESPONSE_OK:
+			if i := combo.GetActive(); i >= 0 && i < len(puzzles) {
+				g.setPuzzle(puzzles[i])
+				g.restart()
+			}
+		}
+		return
+	}
+}
+
+// Load the puzzles of a file chosen, nil if none
+func choosePuzzleFile(parent gtk.IWindow) []*puzzle {
+	chooser, err := gtk.FileChooserDialogNewWith2Buttons("Open Puzzles", parent,
+		gtk.FILE_CHOOSER_ACTION_OPEN, "Cancel", gtk.RESPONSE_CANCEL, "Open", gtk.RESPONSE_ACCEPT)
+	if err != nil {
+		log.Println("Could not create file chooser:", err)
+		return nil
+	}
+	defer chooser.Destroy()
+
+	if chooser.Run() != gtk.RESPONSE_ACCEPT {
+		return nil
+	}
+	path := chooser.GetFilename()
+	puzzles, err := loadPuzzles(path)
+	if err == nil && len(puzzles) == 0 {
+		err = fmt.Errorf("%w: no puzzles", ErrorBadPuzzle)
+	}
+	if err != nil {
+		log.Printf("Could not load puzzles %s: %v", path, err)
+		msg := gtk.MessageDialogNew(parent, gtk.DIALOG_MODAL,
+			gtk.MESSAGE_ERROR, gtk.BUTTONS_OK, "%s", err.Error())
+		defer msg.Destroy()
+		msg.Run()
+		return nil
+	}
+	return puzzles
+}
+
+// The puzzle of the fumen in the clipboard, nil if none
+func pasteFumenPuzzle(parent gtk.IWindow) *puzzle {
+	clipboard, err := gtk.ClipboardGet(gdk.SELECTION_CLIPBOARD)
+	if err != nil {
+		log.Println("Could not get clipboard:", err)
+		return nil
+	}
+	text, err := clipboard.WaitForText()
+	if err != nil {
+		log.Println("Could not read clipboard:", err)
+		return nil
+	}
+
+	p, err := importFumen(text)
+	if err != nil {
+		log.Println("Could not import fumen:", err)
+		msg := gtk.MessageDialogNew(parent, gtk.DIALOG_MODAL,
+			gtk.MESSAGE_ERROR, gtk.BUTTONS_OK, "%s", err.Error())
+		defer msg.Destroy()
+		msg.Run()
+		return nil
+	}
+	return p
+}
@@ -0,0 +1,170 @@
+package tetris
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParsePuzzles(t *testing.T) {
+	puzzles := bundledPuzzles()
+	if len(puzzles) == 0 {
+		t.Fatal("no bundled puzzles")
+	}
+	names := make(map[string]bool)
+	for _, p := range puzzles {
+		if names[p.name] {
+			t.Errorf("puzzle %q twice, the progress is saved by name", p.name)
+		}
+		names[p.name] = true
+	}
+
+	bad := []string{
+		"name: a\ngoal: lines\nqueue: 15\nboard:\nXXXXXXXXXX.",
+		"name: a\ngoal: perfect 2\nqueue: 15\nboard:\nXXXXXXXXXX.",
+		"name: a\ngoal: tetris\nqueue: 15\nboard:\nXXXXXXXXXX.",
+		"name: a\ngoal: perfect\nqueue: 99\nboard:\nXXXXXXXXXX.",
+		"name: a\ngoal: perfect\nboard:\nXXXXXXXXXX.",
+		"name: a\ngoal: perfect\nqueue: 15\nboard:\nXXXX.",
+		"name: a\ngoal: perfect\nqueue: 15\nboard:\nXXXXXXXXXX?",
+		"name: a\ncolor: red\nqueue: 15",
+	}
+	for _, text := range bad {
+		_, err := parsePuzzles(strings.NewReader(text))
+		if !errors.Is(err, ErrorBadPuzzle) && !errors.Is(err, ErrorBadBoard) {
+			t.Errorf("parsed %q: %v, want a bad puzzle", text, err)
+		}
+	}
+}
+
+func TestFormatBoard(t *testing.T) {
+	text := "....X......\nGGGGG.GGGGG\n"
+	board, err := parseBoard(strings.Split(strings.TrimSpace(text), "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if board[ROW-2][4] != CELL_BLOCK || board[ROW-1][5] != CELL_EMPTY || board[ROW-1][0] != CELL_GARBAGE {
+		t.Fatalf("bottom rows %v", board[ROW-2:])
+	}
+	if got := formatBoard(&board); got != text {
+		t.Errorf("formatted %q, want %q", got, text)
+	}
+}
+
+// Every bundled puzzle could be solved by dropping the shapes straight down
+func TestPuzzlesSolvable(t *testing.T) {
+	for _, p := range bundledPuzzles() {
+		if p.goal == GOAL_TSPIN_DOUBLE {
+			continue // played by TestTSpinDouble
+		}
+		if !canSolve(p, boardOf(&p.board), p.queue, p.hold, 0) {
+			t.Errorf("puzzle %q could not be solved", p.name)
+		}
+	}
+}
+
+func canSolve(p *puzzle, board bitboard, queue []int, hold, lines int) bool {
+	if len(queue) == 0 {
+		if hold < 0 {
+			return p.goal == GOAL_LINES && lines >= p.lines ||
+				p.goal == GOAL_PERFECT && board == bitboard{}
+		}
+		queue, hold = []int{hold}, -1
+	}
+
+	try := func(id int, rest []int, hold int) bool {
+		for i, r := 0, id; i < SHAPE_SIZE; i, r = i+1, shapes[r].next {
+			s := shapes[r]
+			for left := -SHAPE_SIZE; left < COL; left++ {
+				n := drop(&board, aiNode{r, left, -s.bounds().y})
+				if !board.fits(s, n.pos()) {
+					continue
+				}
+				b := board
+				b.place(s, n.pos())
+				if canSolve(p, b, rest, hold, lines+b.clear()) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	switch {
+	case try(queue[0], queue[1:], hold):
+		return true
+	case hold >= 0:
+		return try(hold, queue[1:], queue[0])
+	case len(queue) > 1:
+		return try(queue[1], queue[2:], queue[0])
+	}
+	return false
+}
+
+// Play the puzzle named by tapping the controls, returns the state after
+// and whether the solved hook was called
+func playPuzzle(t *testing.T, name string, controls ...Control) (State, bool) {
+	var p *puzzle
+	for _, q := range bundledPuzzles() {
+		if q.name == name {
+			p = q
+		}
+	}
+	if p == nil {
+		t.Fatalf("no puzzle %q", name)
+	}
+
+	g := newHeadlessGame()
+	g.stepped = true
+	solved := false
+	g.puzzleSolved = func(*puzzle) { solved = true }
+	g.setPuzzle(p)
+	g.start()
+	for _, c := range controls {
+		g.step([]inputEvent{{c, true}})
+		g.step([]inputEvent{{c, false}})
+		for i := 0; c == CTRL_HARD_DROP && i < g.handling.EntryDelay; i++ {
+			g.step(nil) // presses are kept until the next shape enters
+		}
+	}
+
+	g.m.Lock()
+	defer g.m.Unlock()
+	return g.state, solved
+}
+
+func TestPuzzleGoal(t *testing.T) {
+	state, solved := playPuzzle(t, "Tetris",
+		CTRL_RIGHT, CTRL_RIGHT, CTRL_RIGHT, CTRL_RIGHT, CTRL_RIGHT, CTRL_HARD_DROP)
+	if state != STATE_FINISHED || !solved {
+		t.Errorf("state %s, solved %v after a tetris", state, solved)
+	}
+
+	state, solved = playPuzzle(t, "Tetris", CTRL_HARD_DROP)
+	if state != STATE_GAMEOVER || solved {
+		t.Errorf("state %s, solved %v after no lines", state, solved)
+	}
+}
+
+func TestPuzzleHold(t *testing.T) {
+	// the I at the left, then the held square at the right
+	state, _ := playPuzzle(t, "Hold on",
+		CTRL_LEFT, CTRL_LEFT, CTRL_LEFT, CTRL_LEFT, CTRL_LEFT, CTRL_HARD_DROP,
+		CTRL_RIGHT, CTRL_RIGHT, CTRL_RIGHT, CTRL_RIGHT, CTRL_RIGHT, CTRL_HARD_DROP)
+	if state != STATE_FINISHED {
+		t.Errorf("state %s, want a perfect clear", state)
+	}
+}
+
+func TestTSpinDouble(t *testing.T) {
+	state, _ := playPuzzle(t, "T-spin double", CTRL_ROTATE_CCW, CTRL_HARD_DROP)
+	if state != STATE_FINISHED {
+		t.Errorf("state %s after a T-spin double", state)
+	}
+
+	// the same slot, without turning since landed
+	state, _ = playPuzzle(t, "T-spin double", CTRL_ROTATE_CCW, CTRL_LEFT, CTRL_RIGHT, CTRL_HARD_DROP)
+	if state != STATE_GAMEOVER {
+		t.Errorf("state %s after shifting the T into the slot", state)
+	}
+}
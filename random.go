@@ -0,0 +1,64 @@
+package tetris
+
+import "math/rand"
+
+// Randomizer generates the sequence of shapes,
+// its state is saved & restored by lockstep snapshots
+type randomizer interface {
+	next() *Shape
+	state() uint64
+	setState(uint64)
+}
+
+// Picks every shape with the same probability
+type uniformRandomizer struct {
+	rnd *seededRand
+}
+
+func newRandomizer(seed int64) randomizer {
+	return &uniformRandomizer{newSeededRand(seed)}
+}
+
+func (r *uniformRandomizer) next() *Shape {
+	return shapes[r.rnd.Intn(len(shapes))]
+}
+
+func (r *uniformRandomizer) state() uint64 {
+	return r.rnd.src.state
+}
+
+func (r *uniformRandomizer) setState(s uint64) {
+	r.rnd.src.state = s
+}
+
+// Random numbers with a state of one word, which could be saved
+type seededRand struct {
+	*rand.Rand
+	src *splitMix64
+}
+
+func newSeededRand(seed int64) *seededRand {
+	src := &splitMix64{uint64(seed)}
+	return &seededRand{rand.New(src), src}
+}
+
+// The SplitMix64 generator, as a rand.Source64
+type splitMix64 struct {
+	state uint64
+}
+
+func (s *splitMix64) Seed(seed int64) {
+	s.state = uint64(seed)
+}
+
+func (s *splitMix64) Uint64() uint64 {
+	s.state += 0x9e3779b97f4a7c15
+	z := s.state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+func (s *splitMix64) Int63() int64 {
+	return int64(s.Uint64() >> 1)
+}
@@ -0,0 +1,47 @@
+package tetris
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+var ErrorBadReplay = errors.New("bad replay")
+
+// Inputs of a headless game by frame, to play it again the same, e.g. a
+// failing input of the fuzz tests
+type replay struct {
+	Seed   int64          `json:"seed"`
+	Mode   Mode           `json:"mode"`
+	Frames [][]inputEvent `json:"frames"` // events of each frame, e.g. ["+left"]
+}
+
+func loadReplay(path string) (*replay, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &replay{}
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrorBadReplay, err)
+	}
+	if r.Mode == MODE_PUZZLE {
+		return nil, fmt.Errorf("%w: mode %s", ErrorBadReplay, r.Mode)
+	}
+	return r, nil
+}
+
+func (r *replay) save(path string) error {
+	return writeJSON(path, r)
+}
+
+// A stepped headless game of the replay, started
+func (r *replay) start() *Game {
+	g := newHeadlessGame()
+	g.seed(r.Seed)
+	g.setMode(r.Mode)
+	g.stepped = true
+	g.start()
+	return g
+}
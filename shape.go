@@ -3,8 +3,6 @@ package tetris
 import (
 	"errors"
 	"log"
-	"math/rand"
-	"time"
 )
 
 const SHAPE_SIZE = 4
@@ -357,7 +355,8 @@ var shapes = []*Shape{
 type (
 	Shape struct {
 		id   int
-		next int
+		next int // turned counterclockwise on the screen
+		prev int // turned clockwise, computed by init()
 		data shapeData
 	}
 
@@ -368,11 +367,6 @@ type (
 
 var shapeBoundsMap = make(map[int]shapeBounds)
 
-func randShape() *Shape {
-	k := rand.Intn(len(shapes))
-	return shapes[k]
-}
-
 func (s *Shape) bounds() shapeBounds {
 	if len(shapeBoundsMap) == 0 {
 		log.Fatalln("should init first")
@@ -392,8 +386,20 @@ func (s *Shape) area(o Point) *Area {
 
 var ErrorMoving = errors.New("error moving")
 
+// Rotate clockwise
 func (s *Shape) rotate(o Point) (*Shape, *Moving, error) {
-	newShape := shapes[s.next]
+	return rotateTo(shapes[s.prev], o)
+}
+
+func (s *Shape) rotateCCW(o Point) (*Shape, *Moving, error) {
+	return rotateTo(shapes[s.next], o)
+}
+
+func (s *Shape) rotate180(o Point) (*Shape, *Moving, error) {
+	return rotateTo(shapes[shapes[s.next].next], o)
+}
+
+func rotateTo(newShape *Shape, o Point) (*Shape, *Moving, error) {
 	mv, err := checkMoving(newShape.area(o), o, o)
 	return newShape, mv, err
 }
@@ -424,10 +430,9 @@ func checkMoving(a *Area, from, to Point) (*Moving, error) {
 }
 
 func init() {
-	rand.Seed(time.Now().UnixNano())
-
 	for id, shape := range shapes {
 		shapeBoundsMap[id] = computeBounds(shape)
+		shapes[shape.next].prev = id
 	}
 }
 
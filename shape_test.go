@@ -0,0 +1,152 @@
+package tetris
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestComputeBounds(t *testing.T) {
+	tests := []struct {
+		name string
+		data shapeData
+		want shapeBounds
+	}{
+		{"corner", shapeData{3: {3: 1}}, shapeBounds{3, 3, 3, 3}},
+		{"origin", shapeData{0: {0: 1}}, shapeBounds{0, 0, 0, 0}},
+		{"column", shapeData{{0, 1}, {0, 1}, {0, 1}, {0, 1}}, shapeBounds{1, 0, 1, 3}},
+		{"row", shapeData{2: {1, 1, 1, 1}}, shapeBounds{0, 2, 3, 2}},
+		{"diagonal", shapeData{1: {0, 0, 1}, 2: {0, 1}}, shapeBounds{1, 1, 2, 2}},
+		{"full", shapeData{{1, 1, 1, 1}, {1, 1, 1, 1}, {1, 1, 1, 1}, {1, 1, 1, 1}}, shapeBounds{0, 0, 3, 3}},
+	}
+	for _, test := range tests {
+		if got := computeBounds(&Shape{data: test.data}); got != test.want {
+			t.Errorf("%s: bounds %+v, want %+v", test.name, got, test.want)
+		}
+	}
+
+	// the bounds kept of every shape are of its cells
+	for _, s := range shapes {
+		b := s.bounds()
+		for _, c := range shapeCells(s) {
+			if c[0] < b.x || c[0] > b.x2 || c[1] < b.y || c[1] > b.y2 {
+				t.Errorf("shape %d: cell %v out of bounds %+v", s.id, c, b)
+			}
+		}
+	}
+}
+
+// Cells moved to the top left of their bounds
+func normalCells(cells [][2]int) map[[2]int]bool {
+	x, y := SHAPE_SIZE, SHAPE_SIZE
+	for _, c := range cells {
+		if c[0] < x {
+			x = c[0]
+		}
+		if c[1] < y {
+			y = c[1]
+		}
+	}
+	m := make(map[[2]int]bool)
+	for _, c := range cells {
+		m[[2]int{c[0] - x, c[1] - y}] = true
+	}
+	return m
+}
+
+// Each rotation chain comes back to its shape in 1, 2 or 4 steps; prev
+// undoes next
+func TestRotateChains(t *testing.T) {
+	for id, s := range shapes {
+		if s.id != id {
+			t.Fatalf("shape at %d has id %d", id, s.id)
+		}
+		if shapes[s.next].prev != id || shapes[s.prev].next != id {
+			t.Errorf("shape %d: next %d & prev %d do not undo each other", id, s.next, s.prev)
+		}
+
+		n, r := 1, shapes[s.next]
+		for ; r.id != id && n <= SHAPE_SIZE; n++ {
+			r = shapes[r.next]
+		}
+		if n != 1 && n != 2 && n != 4 {
+			t.Errorf("shape %d: chain of %d steps", id, n)
+		}
+	}
+}
+
+// The cells turned a quarter on the screen, where y goes down
+func turnCells(cells [][2]int, clockwise bool) map[[2]int]bool {
+	var turned [][2]int
+	for _, c := range cells {
+		if clockwise {
+			turned = append(turned, [2]int{-c[1], c[0]})
+		} else {
+			turned = append(turned, [2]int{c[1], -c[0]})
+		}
+	}
+	return normalCells(turned)
+}
+
+func sameCells(a, b map[[2]int]bool) bool {
+	same := len(a) == len(b)
+	for c := range a {
+		same = same && b[c]
+	}
+	return same
+}
+
+// Rotate turns clockwise on the screen & rotate CCW counterclockwise, for
+// every shape
+func TestRotateDirection(t *testing.T) {
+	// the T of 3 cells pointing right turns to point down, or up
+	right := shapes[7]
+	down := normalCells([][2]int{{0, 0}, {2, 0}, {1, 1}})
+	up := normalCells([][2]int{{1, 0}, {0, 1}, {2, 1}})
+	if r, _, _ := right.rotate(Point{4, 5}); !sameCells(normalCells(shapeCells(r)), down) {
+		t.Errorf("shape 7 rotated to %d, not pointing down", r.id)
+	}
+	if r, _, _ := right.rotateCCW(Point{4, 5}); !sameCells(normalCells(shapeCells(r)), up) {
+		t.Errorf("shape 7 rotated counterclockwise to %d, not pointing up", r.id)
+	}
+
+	for _, s := range shapes {
+		cw, _, _ := s.rotate(Point{4, 5})
+		if !sameCells(normalCells(shapeCells(cw)), turnCells(shapeCells(s), true)) {
+			t.Errorf("shape %d: rotated to %d, not clockwise", s.id, cw.id)
+		}
+		ccw, _, _ := s.rotateCCW(Point{4, 5})
+		if !sameCells(normalCells(shapeCells(ccw)), turnCells(shapeCells(s), false)) {
+			t.Errorf("shape %d: rotated to %d, not counterclockwise", s.id, ccw.id)
+		}
+	}
+}
+
+func TestRotate(t *testing.T) {
+	s := shapes[15] // horizontal I, in the second row of its box
+	tests := []struct {
+		name   string
+		rotate func(*Shape, Point) (*Shape, *Moving, error)
+		at     Point
+		want   int
+		ok     bool
+	}{
+		{"cw", (*Shape).rotate, Point{4, 5}, s.prev, true},
+		{"ccw", (*Shape).rotateCCW, Point{4, 5}, s.next, true},
+		{"180", (*Shape).rotate180, Point{4, 5}, 15, true},
+		{"above the top", (*Shape).rotate, Point{4, -1}, s.prev, false},
+		{"below the bottom", (*Shape).rotate, Point{4, ROW - 2}, s.prev, false},
+		{"right wall", (*Shape).rotate, Point{COL - 1, 5}, s.prev, false},
+	}
+	for _, test := range tests {
+		r, mv, err := test.rotate(s, test.at)
+		if r.id != test.want {
+			t.Errorf("%s: rotated to %d, want %d", test.name, r.id, test.want)
+		}
+		if test.ok && (err != nil || mv.from != test.at || mv.to != test.at) {
+			t.Errorf("%s: moving %+v, %v", test.name, mv, err)
+		}
+		if !test.ok && !errors.Is(err, ErrorMoving) {
+			t.Errorf("%s: %v, want %v", test.name, err, ErrorMoving)
+		}
+	}
+}
@@ -0,0 +1,392 @@
+package tetris
+
+import (
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"sync/atomic"
+)
+
+var ErrorBadState = errors.New("bad state")
+
+// Visible state of a game, compared with the last sent one
+// to send diffs to the opponent
+type snapshot struct {
+	model   [ROW][COL]uint8
+	shape   int // index of shapes
+	pos     Point
+	hold    int // -1 if none
+	nexts   []int
+	score   uint64
+	level   uint8
+	garbage int
+	state   State
+}
+
+func (g *Game) snapshot() *snapshot {
+	g.m.Lock()
+	defer g.m.Unlock()
+	return g.takeSnapshot()
+}
+
+// The caller should hold g.m
+func (g *Game) takeSnapshot() *snapshot {
+	s := &snapshot{
+		model:   g.model,
+		shape:   g.currShape.id,
+		pos:     g.pos,
+		hold:    -1,
+		nexts:   make([]int, len(g.queue)),
+		score:   g.score,
+		level:   g.level,
+		garbage: int(atomic.LoadInt32(&g.pendingGarbage)),
+		state:   g.state,
+	}
+	if g.holdShape != nil {
+		s.hold = g.holdShape.id
+	}
+	for i, shape := range g.queue {
+		s.nexts[i] = shape.id
+	}
+	return s
+}
+
+// Changes of a snapshot on the wire, only the changed rows are sent
+type stateDiff struct {
+	Rows    map[int][COL]uint8 `json:"rows,omitempty"`
+	Shape   int                `json:"shape"`
+	Left    int                `json:"left"`
+	Top     int                `json:"top"`
+	Hold    int                `json:"hold"`
+	Nexts   []int              `json:"nexts"`
+	Score   uint64             `json:"score"`
+	Level   uint8              `json:"level"`
+	Garbage int                `json:"garbage"`
+	State   State              `json:"state"`
+}
+
+// Returns the diff from old (nil for all rows) to s, nil if nothing changed
+func (s *snapshot) diff(old *snapshot) *stateDiff {
+	d := &stateDiff{
+		Rows:    make(map[int][COL]uint8),
+		Shape:   s.shape,
+		Left:    s.pos.left,
+		Top:     s.pos.top,
+		Hold:    s.hold,
+		Nexts:   s.nexts,
+		Score:   s.score,
+		Level:   s.level,
+		Garbage: s.garbage,
+		State:   s.state,
+	}
+	for i := range s.model {
+		if old == nil || s.model[i] != old.model[i] {
+			d.Rows[i] = s.model[i]
+		}
+	}
+
+	if old != nil && len(d.Rows) == 0 && s.shape == old.shape &&
+		s.pos.equals(old.pos) && s.hold == old.hold &&
+		equalInts(s.nexts, old.nexts) && s.score == old.score &&
+		s.level == old.level && s.garbage == old.garbage && s.state == old.state {
+		return nil
+	}
+	return d
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *stateDiff) validate() error {
+	if !validShape(d.Shape) || (d.Hold != -1 && !validShape(d.Hold)) {
+		return ErrorBadState
+	}
+	for _, id := range d.Nexts {
+		if !validShape(id) {
+			return ErrorBadState
+		}
+	}
+	if len(d.Nexts) > MAX_PREVIEWS || int(d.Level) >= LEVELS ||
+		!d.State.valid() {
+		return ErrorBadState
+	}
+	for i, row := range d.Rows {
+		if i < 0 || i >= ROW {
+			return ErrorBadState
+		}
+		for _, cell := range row {
+			if cell > CELL_GARBAGE {
+				return ErrorBadState
+			}
+		}
+	}
+
+	pos := Point{d.Left, d.Top}
+	if pos.valid() && shapes[d.Shape].area(pos).outOfBounds() {
+		return ErrorBadState
+	}
+	return nil
+}
+
+func validShape(id int) bool {
+	return id >= 0 && id < len(shapes)
+}
+
+// Apply a diff to the mirror of a remote game and notify ui,
+// the mirror is never started
+func (g *Game) applyDiff(d *stateDiff) error {
+	if err := d.validate(); err != nil {
+		return err
+	}
+
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	if d.State != g.state {
+		g.setState(d.State)
+	}
+
+	// erase the shape, redraw the changed rows, then draw the shape again
+	shape := shapes[d.Shape]
+	pos := Point{d.Left, d.Top}
+	if len(d.Rows) > 0 || shape != g.currShape || !pos.equals(g.pos) {
+		if g.pos.valid() {
+			g.oldShape = g.currShape
+			g.chanMoving <- &Moving{g.pos, InvalidPoint}
+		}
+
+		top, bottom := ROW, -1
+		for i, row := range d.Rows {
+			g.model[i] = row
+			if i < top {
+				top = i
+			}
+			if i > bottom {
+				bottom = i
+			}
+		}
+		if bottom >= 0 {
+			g.chanRedraw <- &Area{y: top, y2: bottom}
+		}
+
+		g.currShape = shape
+		g.pos = pos
+		g.chanMoving <- &Moving{InvalidPoint, pos}
+	}
+
+	hold := (*Shape)(nil)
+	if d.Hold >= 0 {
+		hold = shapes[d.Hold]
+	}
+	if hold != g.holdShape {
+		g.holdShape = hold
+		g.chanHold <- true
+	}
+
+	if !equalInts(d.Nexts, shapeIds(g.queue)) {
+		g.queue = g.queue[:0]
+		for _, id := range d.Nexts {
+			g.queue = append(g.queue, shapes[id])
+		}
+		g.showNexts()
+	}
+
+	if d.Score != g.score {
+		g.score = d.Score
+		g.chanScore <- g.score
+	}
+	if d.Level != g.level {
+		g.level = d.Level
+		g.chanLevel <- g.level
+	}
+	if n := int32(d.Garbage); atomic.SwapInt32(&g.pendingGarbage, n) != n {
+		g.chanGarbage <- d.Garbage
+	}
+	return nil
+}
+
+func shapeIds(queue []*Shape) []int {
+	ids := make([]int, len(queue))
+	for i, s := range queue {
+		ids[i] = s.id
+	}
+	return ids
+}
+
+// Full state of a game, to hash for desync detection
+// and to resync a lockstep game from
+type gameState struct {
+	Model      [ROW][COL]uint8 `json:"model"`
+	Shape      int             `json:"shape"`
+	Left       int             `json:"left"`
+	Top        int             `json:"top"`
+	Hold       int             `json:"hold"` // -1 if none
+	Held       bool            `json:"held"`
+	Queue      []int           `json:"queue"`
+	Level      uint8           `json:"level"`
+	Score      uint64          `json:"score"`
+	Rows       uint            `json:"rows"`
+	WaterLevel int             `json:"water_level"`
+	Entry      int             `json:"entry"`
+	Falling    int             `json:"falling"`
+	Locking    int             `json:"locking"`
+	Grade      int             `json:"grade"`   // points in master mode
+	Garbage    int32           `json:"garbage"` // pending rows
+	Well       int             `json:"well"`
+	Hole       int             `json:"hole"`
+	Rnd        uint64          `json:"rnd"`  // state of the randomizer
+	Rand       uint64          `json:"rand"` // state of garbage holes
+	State      State           `json:"state"`
+
+	// input state
+	HeldKeys    [CONTROLS]bool `json:"held_keys"`
+	PressedKeys [CONTROLS]bool `json:"pressed_keys"`
+	Shift       Control        `json:"shift"`
+	DAS         int            `json:"das"`
+	ARR         int            `json:"arr"`
+}
+
+func (g *Game) saveState() *gameState {
+	g.m.Lock()
+	defer g.m.Unlock()
+	return g.fullState()
+}
+
+// The caller should hold g.m
+func (g *Game) fullState() *gameState {
+	s := &gameState{
+		Model:       g.model,
+		Shape:       g.currShape.id,
+		Left:        g.pos.left,
+		Top:         g.pos.top,
+		Hold:        -1,
+		Held:        g.held,
+		Queue:       shapeIds(g.queue),
+		Level:       g.level,
+		Score:       g.score,
+		Rows:        g.rows,
+		WaterLevel:  g.waterLevel,
+		Entry:       g.entry,
+		Falling:     g.falling,
+		Locking:     g.locking,
+		Grade:       g.gradePoints,
+		Garbage:     atomic.LoadInt32(&g.pendingGarbage),
+		Well:        g.well,
+		Hole:        g.hole,
+		Rnd:         g.rnd.state(),
+		Rand:        g.rand.src.state,
+		State:       g.state,
+		HeldKeys:    g.input.held,
+		PressedKeys: g.input.pressed,
+		Shift:       g.input.shift,
+		DAS:         g.input.das,
+		ARR:         g.input.arr,
+	}
+	if g.holdShape != nil {
+		s.Hold = g.holdShape.id
+	}
+	return s
+}
+
+// Hash of the full state, the same on all peers if not desynced
+func (g *Game) hash() uint64 {
+	h := fnv.New64a()
+	json.NewEncoder(h).Encode(g.saveState())
+	return h.Sum64()
+}
+
+func (s *gameState) validate() error {
+	d := stateDiff{
+		Shape: s.Shape,
+		Left:  s.Left,
+		Top:   s.Top,
+		Hold:  s.Hold,
+		Nexts: s.Queue,
+		Level: s.Level,
+		State: s.State,
+	}
+	if err := d.validate(); err != nil {
+		return err
+	}
+	for _, row := range s.Model {
+		for _, cell := range row {
+			if cell > CELL_GARBAGE {
+				return ErrorBadState
+			}
+		}
+	}
+	if s.WaterLevel < 0 || s.WaterLevel > ROW || s.Shift < -1 || s.Shift >= CONTROLS ||
+		s.Well < 0 || s.Well >= COL || s.Hole < 0 || s.Hole >= COL {
+		return ErrorBadState
+	}
+	return nil
+}
+
+// Restore the full state saved by a peer, and redraw all
+func (g *Game) restoreState(s *gameState) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	if g.pos.valid() {
+		g.oldShape = g.currShape
+		g.chanMoving <- &Moving{g.pos, InvalidPoint}
+	}
+
+	g.model = s.Model
+	g.currShape = shapes[s.Shape]
+	g.pos = Point{s.Left, s.Top}
+	g.holdShape = nil
+	if s.Hold >= 0 {
+		g.holdShape = shapes[s.Hold]
+	}
+	g.held = s.Held
+	g.queue = g.queue[:0]
+	for _, id := range s.Queue {
+		g.queue = append(g.queue, shapes[id])
+	}
+	g.level = s.Level
+	g.score = s.Score
+	g.rows = s.Rows
+	g.waterLevel = s.WaterLevel
+	g.entry = s.Entry
+	g.falling = s.Falling
+	g.locking = s.Locking
+	g.gradePoints = s.Grade
+	atomic.StoreInt32(&g.pendingGarbage, s.Garbage)
+	g.well = s.Well
+	g.hole = s.Hole
+	g.rnd.setState(s.Rnd)
+	g.rand.src.state = s.Rand
+	g.input = input{
+		held:    s.HeldKeys,
+		pressed: s.PressedKeys,
+		shift:   s.Shift,
+		das:     s.DAS,
+		arr:     s.ARR,
+	}
+	if s.State != g.state {
+		g.setState(s.State)
+	}
+
+	g.chanRedraw <- &Area{y: 0, y2: ROW - 1}
+	g.chanMoving <- &Moving{InvalidPoint, g.pos}
+	g.chanHold <- true
+	g.showNexts()
+	g.chanScore <- g.score
+	g.chanLevel <- g.level
+	g.chanGarbage <- int(s.Garbage)
+	return nil
+}
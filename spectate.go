@@ -0,0 +1,208 @@
+package tetris
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"time"
+)
+
+const (
+	SPECTATOR_VERSION = 2
+
+	DEFAULT_SPECTATOR_PORT = 7171
+
+	SPECTATOR_QUEUE_SIZE = 256 // events queued per spectator, the slower is dropped
+)
+
+// Event types streamed to spectators
+const (
+	EVENT_HELLO   = "hello"   // full state of the game, on join
+	EVENT_MOVE    = "move"    // the shape moved, rotated or landed
+	EVENT_LOCK    = "lock"    // the shape locked
+	EVENT_CLEAR   = "clear"   // rows cleared, one by one
+	EVENT_SCORE   = "score"   // score & level
+	EVENT_STATE   = "state"   // started, paused, over...
+	EVENT_HOLD    = "hold"    // the shape held
+	EVENT_GARBAGE = "garbage" // garbage rows risen
+)
+
+// Event of a live game, one JSON object per line. The changes are sent
+// as diffs from the last event sent to the spectator
+type specEvent struct {
+	Type    string     `json:"type"`
+	Version int        `json:"version,omitempty"` // hello
+	Game    *gameState `json:"game,omitempty"`    // hello
+	Rows    []int      `json:"rows,omitempty"`    // clear
+	Diff    *stateDiff `json:"diff,omitempty"`
+
+	snapshot *snapshot // taken at the event
+}
+
+// Notify the spectators if any, the caller should hold g.m
+func (g *Game) emit(t string, rows ...int) {
+	if g.spectate != nil {
+		g.spectate(&specEvent{Type: t, Rows: rows, snapshot: g.takeSnapshot()})
+	}
+}
+
+// Streams the events of a game to any number of spectators
+type SpectatorServer struct {
+	g          *Game
+	l          net.Listener
+	spectators map[*spectator]bool // guarded by g.m
+}
+
+// A connected spectator, events are written by its own goroutine
+type spectator struct {
+	conn   net.Conn
+	events chan *specEvent // closed when removed
+}
+
+// Serve the spectators of g on l, until closed
+func serveSpectators(g *Game, l net.Listener) *SpectatorServer {
+	s := &SpectatorServer{
+		g:          g,
+		l:          l,
+		spectators: make(map[*spectator]bool),
+	}
+
+	g.m.Lock()
+	g.spectate = s.publish
+	g.m.Unlock()
+
+	go s.accept()
+	log.Println("[spectate] serve on", l.Addr())
+	return s
+}
+
+func (s *SpectatorServer) accept() {
+	for {
+		conn, err := s.l.Accept()
+		if err != nil {
+			log.Println("[spectate] accept:", err)
+			return
+		}
+		log.Println("[spectate] spectator from", conn.RemoteAddr())
+
+		sp := &spectator{conn, make(chan *specEvent, SPECTATOR_QUEUE_SIZE)}
+
+		// join from the state now, then follow the events
+		g := s.g
+		g.m.Lock()
+		hello := &specEvent{
+			Type:     EVENT_HELLO,
+			Version:  SPECTATOR_VERSION,
+			Game:     g.fullState(),
+			snapshot: g.takeSnapshot(),
+		}
+		s.spectators[sp] = true
+		g.m.Unlock()
+
+		go s.write(sp, hello)
+	}
+}
+
+// Queue the event to all spectators, the caller should hold g.m
+func (s *SpectatorServer) publish(e *specEvent) {
+	for sp := range s.spectators {
+		select {
+		case sp.events <- e:
+		default:
+			log.Println("[spectate] too slow, drop", sp.conn.RemoteAddr())
+			s.remove(sp)
+		}
+	}
+}
+
+// The caller should hold g.m
+func (s *SpectatorServer) remove(sp *spectator) {
+	if s.spectators[sp] {
+		delete(s.spectators, sp)
+		close(sp.events)
+	}
+}
+
+func (s *SpectatorServer) write(sp *spectator, hello *specEvent) {
+	defer sp.conn.Close()
+
+	enc := json.NewEncoder(sp.conn)
+	last := hello.snapshot
+	err := s.send(sp, enc, hello)
+
+	for e := range sp.events {
+		if err != nil {
+			continue // until removed
+		}
+		out := &specEvent{Type: e.Type, Rows: e.Rows, Diff: e.snapshot.diff(last)}
+		if out.Diff != nil {
+			last = e.snapshot
+		}
+		if err = s.send(sp, enc, out); err != nil {
+			log.Println("[spectate] write:", err)
+			s.g.m.Lock()
+			s.remove(sp)
+			s.g.m.Unlock()
+		}
+	}
+}
+
+func (s *SpectatorServer) send(sp *spectator, enc *json.Encoder, e *specEvent) error {
+	sp.conn.SetWriteDeadline(time.Now().Add(NET_TIMEOUT))
+	return enc.Encode(e)
+}
+
+// Stop serving and drop all spectators
+func (s *SpectatorServer) close() {
+	s.l.Close()
+
+	s.g.m.Lock()
+	defer s.g.m.Unlock()
+	s.g.spectate = nil
+	for sp := range s.spectators {
+		s.remove(sp)
+	}
+}
+
+// Follow the game served on conn, the events are applied to g which
+// is never started; changed is called after each event. Returns when
+// disconnected
+func watchGame(conn net.Conn, g *Game, changed func()) error {
+	dec := json.NewDecoder(conn)
+
+	var hello specEvent
+	if err := dec.Decode(&hello); err != nil {
+		return err
+	}
+	if hello.Type != EVENT_HELLO || hello.Game == nil {
+		return fmt.Errorf("unexpected event %q", hello.Type)
+	}
+	if hello.Version != SPECTATOR_VERSION {
+		return ErrorVersion
+	}
+	if err := g.restoreState(hello.Game); err != nil {
+		return err
+	}
+	changed()
+
+	for {
+		var e specEvent
+		if err := dec.Decode(&e); err != nil {
+			return err
+		}
+		if e.Type == EVENT_CLEAR {
+			for _, k := range e.Rows {
+				if k >= 0 && k < ROW {
+					g.hilighRow(k)
+				}
+			}
+		}
+		if e.Diff != nil {
+			if err := g.applyDiff(e.Diff); err != nil {
+				return err
+			}
+		}
+		changed()
+	}
+}
@@ -0,0 +1,119 @@
+package tetris
+
+import (
+	"fmt"
+	"log"
+	"net"
+
+	"github.com/gotk3/gotk3/gtk"
+)
+
+var spectatorServer *SpectatorServer
+
+// Serve g to spectators on the port of the config, if any
+func updateSpectatorServer(g *Game) {
+	if spectatorServer != nil {
+		spectatorServer.close()
+		spectatorServer = nil
+	}
+	if config.SpectatorPort <= 0 {
+		return
+	}
+
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", config.SpectatorPort))
+	if err != nil {
+		log.Println("Could not serve spectators:", err)
+		return
+	}
+	spectatorServer = serveSpectators(g, l)
+}
+
+// Ask for the address of the game to watch
+func showSpectateDialog(parent *gtk.ApplicationWindow) {
+	dialog, err := gtk.DialogNew()
+	if err != nil {
+		log.Println("Could not create dialog:", err)
+		return
+	}
+	dialog.SetTitle(LABEL_SPECTATE)
+	dialog.SetTransientFor(parent)
+	dialog.SetModal(true)
+	dialog.AddButton("Cancel", gtk.RESPONSE_CANCEL)
+	dialog.AddButton("Watch", gtk.RESPONSE_OK)
+
+	label, _ := gtk.LabelNew("Address (host:port) of the game")
+	label.SetXAlign(0)
+	entry, _ := gtk.EntryNew()
+	entry.SetText(config.SpectateAddress)
+
+	content, _ := dialog.GetContentArea()
+	content.SetSpacing(6)
+	content.PackStart(label, false, false, 0)
+	content.PackStart(entry, false, false, 0)
+	dialog.ShowAll()
+
+	resp := dialog.Run()
+	addr, _ := entry.GetText()
+	dialog.Destroy()
+
+	if resp != gtk.RESPONSE_OK {
+		return
+	}
+	config.SpectateAddress = addr
+	if err := config.Save(); err != nil {
+		log.Println("Could not save config:", err)
+	}
+	showSpectatorWindow(parent, addr)
+}
+
+// Show the game served on addr, joined at its current state
+func showSpectatorWindow(parent *gtk.ApplicationWindow, addr string) {
+	win, err := gtk.WindowNew(gtk.WINDOW_TOPLEVEL)
+	if err != nil {
+		log.Println("Could not create window:", err)
+		return
+	}
+	win.SetTransientFor(parent)
+	win.SetTitle("TETRIS " + LABEL_SPECTATE)
+
+	g := NewGame() // never started, follows the events
+	v := newVersusView()
+	go v.show(g)
+
+	status, _ := gtk.LabelNew("")
+	header, _ := gtk.HeaderBarNew()
+	header.SetShowCloseButton(true)
+	header.SetCustomTitle(status)
+	win.SetTitlebar(header)
+
+	closed := make(chan bool)
+	win.Connect(SIGNAL_DESTROY, func() {
+		close(closed)
+	})
+
+	win.Add(initPlayerPanel(addr, v))
+	win.ShowAll()
+
+	go func() {
+		showStatus(status, "Connecting to "+addr+"...")
+		conn, err := net.DialTimeout("tcp", addr, NET_TIMEOUT)
+		if err != nil {
+			log.Println("[spectate] could not connect:", err)
+			showStatus(status, err.Error())
+			return
+		}
+		go func() {
+			<-closed
+			conn.Close()
+		}()
+		showStatus(status, "Watching "+addr)
+
+		err = watchGame(conn, g, func() {})
+		select {
+		case <-closed:
+		default:
+			log.Println("[spectate] disconnected:", err)
+			showStatus(status, "Disconnected")
+		}
+	}()
+}
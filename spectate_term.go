@@ -0,0 +1,107 @@
+package tetris
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Watch the game served on addr, rendered in the terminal
+func SpectateTerminal(addr string) error {
+	conn, err := net.DialTimeout("tcp", addr, NET_TIMEOUT)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	g := newHeadlessGame()
+	return watchGame(conn, g, func() {
+		fmt.Print(renderTerminal(g.saveState()))
+	})
+}
+
+// Render the board with the current shape, and the panel beside it,
+// as text with ANSI escapes to redraw in place
+func renderTerminal(s *gameState) string {
+	board := s.Model
+	const CURRENT = CELL_GARBAGE + 1
+	shape := shapes[s.Shape]
+	for j := 0; j < SHAPE_SIZE; j++ {
+		for i := 0; i < SHAPE_SIZE; i++ {
+			top, left := s.Top+j, s.Left+i
+			if shape.data[j][i] > 0 && !outOfBounds(left, top) {
+				board[top][left] = CURRENT
+			}
+		}
+	}
+
+	panel := []string{
+		fmt.Sprintf("SCORE %d", s.Score),
+		fmt.Sprintf("LEVEL %d", s.Level),
+		stateText(s.State),
+		"",
+		"HOLD",
+	}
+	if s.Hold >= 0 {
+		panel = append(panel, shapeLines(shapes[s.Hold])...)
+	}
+	panel = append(panel, "", "NEXT")
+	for _, id := range s.Queue {
+		panel = append(panel, shapeLines(shapes[id])...)
+	}
+
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J")
+	for i := 0; i < ROW; i++ {
+		b.WriteString("|")
+		for j := 0; j < COL; j++ {
+			switch board[i][j] {
+			case CELL_EMPTY:
+				b.WriteString(" .")
+			case CELL_GARBAGE:
+				b.WriteString("##")
+			default:
+				b.WriteString("[]")
+			}
+		}
+		b.WriteString("|")
+		if i < len(panel) {
+			b.WriteString("  " + panel[i])
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("+" + strings.Repeat("--", COL) + "+\n")
+	return b.String()
+}
+
+// Rows of a shape with blocks, in text
+func shapeLines(s *Shape) []string {
+	var lines []string
+	b := s.bounds()
+	for j := b.y; j <= b.y2; j++ {
+		line := ""
+		for i := 0; i < SHAPE_SIZE; i++ {
+			if s.data[j][i] > 0 {
+				line += "[]"
+			} else {
+				line += "  "
+			}
+		}
+		lines = append(lines, strings.TrimRight(line, " "))
+	}
+	return lines
+}
+
+func stateText(state State) string {
+	switch state {
+	case STATE_GAMEOVER:
+		return "GAME OVER"
+	case STATE_PAUSED:
+		return "PAUSED"
+	case STATE_FINISHED:
+		return "FINISHED"
+	case STATE_COUNTDOWN:
+		return "READY"
+	}
+	return ""
+}
@@ -0,0 +1,74 @@
+package tetris
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Watch the game served on addr with a headless mirror
+func watchLoopback(t *testing.T, addr string) (*Game, chan error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mirror := newHeadlessGame()
+	chanErr := make(chan error, 1)
+	go func() {
+		defer conn.Close()
+		chanErr <- watchGame(conn, mirror, func() {})
+	}()
+	return mirror, chanErr
+}
+
+func waitMirror(t *testing.T, mirror, g *Game) {
+	waitFor(t, "the mirror to catch up", func() bool {
+		return mirror.snapshot().diff(g.snapshot()) == nil
+	})
+}
+
+func TestSpectatorServer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := newSteppedGame(7)
+	s := serveSpectators(g, l)
+
+	first, chanFirst := watchLoopback(t, l.Addr().String())
+	waitMirror(t, first, g)
+
+	f := 0
+	play := func(frames int) {
+		for end := f + frames; f < end; f++ {
+			g.step(scriptedInputs(f))
+		}
+	}
+
+	// joins mid-game from a snapshot
+	play(300)
+	second, chanSecond := watchLoopback(t, l.Addr().String())
+	play(300)
+	waitMirror(t, first, g)
+	waitMirror(t, second, g)
+	if modelOf(first) != modelOf(g) || modelOf(second) != modelOf(g) {
+		t.Error("the mirrors' boards differ from the game")
+	}
+
+	if text := renderTerminal(second.saveState()); !strings.Contains(text, "SCORE") {
+		t.Errorf("rendered without the score:\n%s", text)
+	}
+
+	s.close()
+	for _, chanErr := range []chan error{chanFirst, chanSecond} {
+		select {
+		case err := <-chanErr:
+			if err == nil {
+				t.Error("watching ended without error")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for the spectators to be dropped")
+		}
+	}
+}
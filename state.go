@@ -0,0 +1,76 @@
+package tetris
+
+import (
+	"errors"
+	"fmt"
+)
+
+// State of a game. The values are sent to peers & spectators, new states
+// are added at the end
+type State int32
+
+const (
+	STATE_READY      State = iota // not started, or reset
+	STATE_GAMEOVER                // topped out, or aborted
+	STATE_PLAYING                 // the shapes fall
+	STATE_PAUSED                  // by the player
+	STATE_FINISHED                // the goal of the mode reached
+	STATE_COUNTDOWN               // to the first frame, or to resume
+	STATE_LINE_CLEAR              // the rows cleared shown, until the next shape enters
+
+	STATES // number of states
+)
+
+var stateNames = [STATES]string{
+	"ready", "game over", "playing", "paused", "finished", "countdown", "line clear",
+}
+
+// States each state could change to
+var transitions = [STATES][]State{
+	STATE_READY:      {STATE_COUNTDOWN, STATE_PLAYING},
+	STATE_COUNTDOWN:  {STATE_PLAYING, STATE_FINISHED, STATE_GAMEOVER},
+	STATE_PLAYING:    {STATE_PAUSED, STATE_LINE_CLEAR, STATE_FINISHED, STATE_GAMEOVER},
+	STATE_LINE_CLEAR: {STATE_PLAYING, STATE_PAUSED, STATE_FINISHED, STATE_GAMEOVER},
+	STATE_PAUSED:     {STATE_PLAYING, STATE_COUNTDOWN, STATE_FINISHED, STATE_GAMEOVER},
+	STATE_FINISHED:   {STATE_READY},
+	STATE_GAMEOVER:   {STATE_READY},
+}
+
+var ErrorTransition = errors.New("illegal state transition")
+
+func (s State) String() string {
+	if s < 0 || s >= STATES {
+		return fmt.Sprintf("state(%d)", int32(s))
+	}
+	return stateNames[s]
+}
+
+func (s State) valid() bool {
+	return s >= 0 && s < STATES
+}
+
+// Returns nil if the state could change to the next
+func (s State) check(next State) error {
+	if s.valid() {
+		for _, t := range transitions[s] {
+			if t == next {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%w: %s -> %s", ErrorTransition, s, next)
+}
+
+// Returns true if started & not over
+func (s State) running() bool {
+	return s != STATE_READY && !s.over()
+}
+
+// Returns true if the frames are stepped, i.e. playing or clearing rows
+func (s State) active() bool {
+	return s == STATE_PLAYING || s == STATE_LINE_CLEAR
+}
+
+func (s State) over() bool {
+	return s == STATE_FINISHED || s == STATE_GAMEOVER
+}
@@ -0,0 +1,140 @@
+package tetris
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTransitions(t *testing.T) {
+	tests := []struct {
+		from, to State
+		ok       bool
+	}{
+		{STATE_READY, STATE_COUNTDOWN, true},
+		{STATE_READY, STATE_PLAYING, true},
+		{STATE_READY, STATE_PAUSED, false},
+		{STATE_COUNTDOWN, STATE_PLAYING, true},
+		{STATE_COUNTDOWN, STATE_PAUSED, false},
+		{STATE_PLAYING, STATE_LINE_CLEAR, true},
+		{STATE_PLAYING, STATE_PLAYING, false},
+		{STATE_PLAYING, STATE_READY, false},
+		{STATE_LINE_CLEAR, STATE_PLAYING, true},
+		{STATE_LINE_CLEAR, STATE_LINE_CLEAR, false},
+		{STATE_PAUSED, STATE_PLAYING, true},
+		{STATE_PAUSED, STATE_COUNTDOWN, true},
+		{STATE_PAUSED, STATE_LINE_CLEAR, false},
+		{STATE_FINISHED, STATE_READY, true},
+		{STATE_FINISHED, STATE_PLAYING, false},
+		{STATE_GAMEOVER, STATE_READY, true},
+		{STATE_GAMEOVER, STATE_PAUSED, false},
+		{STATES, STATE_READY, false},
+	}
+	for _, test := range tests {
+		err := test.from.check(test.to)
+		if test.ok != (err == nil) || err != nil && !errors.Is(err, ErrorTransition) {
+			t.Errorf("%s -> %s: %v", test.from, test.to, err)
+		}
+	}
+
+	// the game could be stopped or aborted in every running state
+	for s := STATE_READY; s < STATES; s++ {
+		if s.running() && (s.check(STATE_GAMEOVER) != nil || s.check(STATE_FINISHED) != nil) {
+			t.Errorf("%s could not be over", s)
+		}
+		if s.String() != stateNames[s] {
+			t.Errorf("state %d named %q", int32(s), s)
+		}
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	g := newHeadlessGame()
+	if err := g.pause(); !errors.Is(err, ErrorTransition) {
+		t.Errorf("paused before start: %v", err)
+	}
+	g.stepped = true
+	g.start()
+	if err := g.resume(); !errors.Is(err, ErrorTransition) {
+		t.Errorf("resumed while playing: %v", err)
+	}
+	if err := g.start(); !errors.Is(err, ErrorTransition) {
+		t.Errorf("started while playing: %v", err)
+	}
+	if err := g.pause(); err != nil {
+		t.Fatal(err)
+	}
+	if g.step(nil) {
+		t.Error("stepped while paused")
+	}
+	if err := g.resume(); err != nil || stateOf(g) != STATE_PLAYING {
+		t.Errorf("resumed to %s: %v", stateOf(g), err)
+	}
+}
+
+// The rows cleared are shown in the entry delay, then the next shape plays
+func TestLineClearState(t *testing.T) {
+	n, err := parseNotation("current: 16\npos: 9 0\nboard:\nXXXXXXXXXX.\nXXXXXXXXXX.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := newHeadlessGame()
+	g.stepped = true
+	g.start()
+	if err := g.loadNotation(n); err != nil {
+		t.Fatal(err)
+	}
+
+	g.step([]inputEvent{{CTRL_HARD_DROP, true}})
+	for i := 1; i < g.handling.EntryDelay; i++ {
+		if s := stateOf(g); s != STATE_LINE_CLEAR {
+			t.Fatalf("frame %d after the clear: %s", i, s)
+		}
+		if !g.step(nil) {
+			t.Fatalf("frame %d after the clear: not stepped", i)
+		}
+	}
+	g.step(nil)
+	if s := stateOf(g); s != STATE_PLAYING {
+		t.Errorf("%s after the entry delay", s)
+	}
+}
+
+func TestCountdown(t *testing.T) {
+	g := newHeadlessGame()
+	g.start()
+	if s := stateOf(g); s != STATE_COUNTDOWN {
+		t.Fatalf("%s after start", s)
+	}
+	if err := g.pause(); !errors.Is(err, ErrorTransition) {
+		t.Errorf("paused in the countdown: %v", err)
+	}
+	waitFor(t, "the countdown", func() bool { return stateOf(g) == STATE_PLAYING })
+
+	g.restart()
+	if s := stateOf(g); s != STATE_COUNTDOWN {
+		t.Errorf("%s after restart", s)
+	}
+	g.stop()
+}
+
+// Resumed by counting down, the frames skipped until played again
+func TestResumeCountdown(t *testing.T) {
+	g := newHeadlessGame()
+	g.start()
+	waitFor(t, "the countdown", func() bool { return stateOf(g) == STATE_PLAYING })
+
+	g.autoPause()
+	if s := stateOf(g); s != STATE_PAUSED {
+		t.Fatalf("%s after auto pause", s)
+	}
+	g.autoPause() // paused already
+	if err := g.resume(); err != nil || stateOf(g) != STATE_COUNTDOWN {
+		t.Fatalf("resumed to %s: %v", stateOf(g), err)
+	}
+	g.autoPause() // not in the countdown
+	if s := stateOf(g); s != STATE_COUNTDOWN {
+		t.Errorf("%s after auto pause in the countdown", s)
+	}
+	waitFor(t, "the countdown to resume", func() bool { return stateOf(g) == STATE_PLAYING })
+	g.stop()
+}
@@ -0,0 +1,381 @@
+package tetris
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const MAX_HISTORY = 1000 // games kept in the lifetime stats
+
+var clearNames = [SHAPE_SIZE]string{"singles", "doubles", "triples", "tetrises"}
+
+// Statistics of a game. Time is counted by frames played, so that
+// neither pauses nor the countdown are
+type gameStats struct {
+	Mode    Mode      `json:"mode"`
+	Ended   time.Time `json:"ended"`
+	Aborted bool      `json:"aborted,omitempty"` // restarted before over
+	Score   uint64    `json:"score"`
+	Lines   uint      `json:"lines"`
+	Level   uint8     `json:"level"`
+	Grade   string    `json:"grade,omitempty"` // of master mode
+
+	Frames        int             `json:"frames"`         // played
+	Pieces        map[int]int     `json:"pieces"`         // locked, by the id of the shape landed
+	Clears        [SHAPE_SIZE]int `json:"clears"`         // singles, doubles, triples & tetrises
+	TSpins        int             `json:"tspins"`         // clears by a T-spin
+	PerfectClears int             `json:"perfect_clears"` // no blocks left
+	Keys          int             `json:"keys"`           // pressed
+	MaxCombo      int             `json:"max_combo"`      // pieces clearing in a row, after the first
+	LevelFrames   [LEVELS]int     `json:"level_frames"`   // played at each level
+	Holes         int             `json:"holes"`          // created by the pieces locked
+
+	landed int // id of the current shape when it landed
+	combo  int // -1 if the last piece cleared nothing
+}
+
+func newGameStats() gameStats {
+	return gameStats{Pieces: make(map[int]int), combo: -1}
+}
+
+// Copy to be sent out of the game
+func (s *gameStats) copy() gameStats {
+	c := *s
+	c.Pieces = make(map[int]int, len(s.Pieces))
+	for id, n := range s.Pieces {
+		c.Pieces[id] = n
+	}
+	return c
+}
+
+// A frame played at level
+func (s *gameStats) frame(level uint8) {
+	s.Frames++
+	s.LevelFrames[level]++
+}
+
+// The landed shape locked, clearing rows & creating holes
+func (s *gameStats) lock(rows, holes int, perfect bool) {
+	s.Pieces[s.landed]++
+	if holes > 0 {
+		s.Holes += holes
+	}
+	if rows == 0 {
+		s.combo = -1
+		return
+	}
+
+	s.clear(rows, perfect)
+	s.combo++
+	if s.combo > s.MaxCombo {
+		s.MaxCombo = s.combo
+	}
+}
+
+// Rows cleared at once, by a piece or a chain of cascade
+func (s *gameStats) clear(rows int, perfect bool) {
+	if rows > SHAPE_SIZE {
+		rows = SHAPE_SIZE
+	}
+	s.Clears[rows-1]++
+	if perfect {
+		s.PerfectClears++
+	}
+}
+
+// Pieces locked of all shapes
+func (s *gameStats) placed() int {
+	n := 0
+	for _, p := range s.Pieces {
+		n += p
+	}
+	return n
+}
+
+func (s *gameStats) duration() time.Duration {
+	return time.Duration(s.Frames) * FRAME
+}
+
+// Pieces per second
+func (s *gameStats) pps() float64 {
+	if s.Frames == 0 {
+		return 0
+	}
+	return float64(s.placed()) * FPS / float64(s.Frames)
+}
+
+// Keys per piece
+func (s *gameStats) kpp() float64 {
+	if n := s.placed(); n > 0 {
+		return float64(s.Keys) / float64(n)
+	}
+	return 0
+}
+
+// Pieces by the letters of the shapes, e.g. "I 3, T 2", the odd shapes
+// by their ids
+func (s *gameStats) piecesText() string {
+	counts := make(map[string]int)
+	for id, n := range s.Pieces {
+		name := strconv.Itoa(id)
+		if c := fumenLetter(id); c != 0 {
+			name = string(c)
+		}
+		counts[name] += n
+	}
+	var names []string
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		names[i] = fmt.Sprintf("%s %d", name, counts[name])
+	}
+	return strings.Join(names, ", ")
+}
+
+// Summary of the stats, a line each
+func (s *gameStats) report() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Score: %d\nLines: %d\nLevel: %d\n", s.Score, s.Lines, s.Level)
+	if s.Grade != "" {
+		fmt.Fprintf(&b, "Grade: %s\n", s.Grade)
+	}
+	fmt.Fprintf(&b, "Time: %s\n", s.duration().Round(time.Second))
+	fmt.Fprintf(&b, "Pieces: %d (%.2f per second)\n", s.placed(), s.pps())
+	if p := s.piecesText(); p != "" {
+		fmt.Fprintf(&b, "  %s\n", p)
+	}
+	fmt.Fprintf(&b, "Keys per piece: %.2f\n", s.kpp())
+	fmt.Fprintf(&b, "Singles: %d, doubles: %d, triples: %d, tetrises: %d\n",
+		s.Clears[0], s.Clears[1], s.Clears[2], s.Clears[3])
+	fmt.Fprintf(&b, "T-spins: %d, perfect clears: %d\n", s.TSpins, s.PerfectClears)
+	fmt.Fprintf(&b, "Max combo: %d\nHoles: %d\n", s.MaxCombo, s.Holes)
+	for l, f := range s.LevelFrames {
+		if f > 0 {
+			fmt.Fprintf(&b, "Level %d: %s\n", l, (time.Duration(f) * FRAME).Round(time.Second))
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// Stats of the game so far, the caller should hold g.m
+func (g *Game) currentStats() gameStats {
+	s := g.stats.copy()
+	s.Mode = g.mode
+	s.Score = g.score
+	s.Lines = g.rows
+	s.Level = g.level
+	s.Keys = g.input.keys
+	if g.mode == MODE_MASTER {
+		s.Grade = g.grade()
+	}
+	return s
+}
+
+// Holes of the board, the caller should hold g.m
+func (g *Game) holes() int {
+	b := boardOf(&g.model)
+	_, n := b.heights()
+	return n
+}
+
+// Stats of the games played, the oldest first
+type statsHistory []gameStats
+
+func statsHistoryPath() (string, error) {
+	path, err := configPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), "stats.json"), nil
+}
+
+// Load the history, empty if none saved
+func loadStatsHistory() (statsHistory, error) {
+	var history statsHistory
+	path, err := statsHistoryPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return history, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, fmt.Errorf("could not parse stats %s: %w", path, err)
+	}
+	return history, nil
+}
+
+// Add the stats of a game to the history saved, unless the history could
+// not be loaded, not to overwrite the games saved
+func saveToHistory(s gameStats) error {
+	history, err := loadStatsHistory()
+	if err != nil {
+		return err
+	}
+	return history.add(s).save()
+}
+
+func (history statsHistory) save() error {
+	path, err := statsHistoryPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeJSON(path, history)
+}
+
+// Add the stats of a game, dropping the oldest beyond MAX_HISTORY
+func (history statsHistory) add(s gameStats) statsHistory {
+	history = append(history, s)
+	if len(history) > MAX_HISTORY {
+		history = history[len(history)-MAX_HISTORY:]
+	}
+	return history
+}
+
+// Lifetime stats summed up of the games, with the best score & level
+func (history statsHistory) total() gameStats {
+	t := newGameStats()
+	for i := range history {
+		s := &history[i]
+		if s.Score > t.Score {
+			t.Score = s.Score
+		}
+		if s.Level > t.Level {
+			t.Level = s.Level
+		}
+		if s.MaxCombo > t.MaxCombo {
+			t.MaxCombo = s.MaxCombo
+		}
+		t.Lines += s.Lines
+		t.Frames += s.Frames
+		for id, n := range s.Pieces {
+			t.Pieces[id] += n
+		}
+		for j, n := range s.Clears {
+			t.Clears[j] += n
+		}
+		t.TSpins += s.TSpins
+		t.PerfectClears += s.PerfectClears
+		t.Keys += s.Keys
+		for j, f := range s.LevelFrames {
+			t.LevelFrames[j] += f
+		}
+		t.Holes += s.Holes
+	}
+	return t
+}
+
+// Summary of the lifetime stats, a line each
+func (history statsHistory) report() string {
+	if len(history) == 0 {
+		return "No games played yet"
+	}
+	t := history.total()
+	text := strings.Replace(t.report(), "Score:", "Best score:", 1)
+	text = strings.Replace(text, "Level:", "Best level:", 1)
+	return fmt.Sprintf("Games: %d\n%s", len(history), text)
+}
+
+var statsColumns = []string{
+	"ended", "mode", "aborted", "score", "lines", "level", "seconds", "pieces",
+	"pps", "kpp", "singles", "doubles", "triples", "tetrises", "tspins",
+	"perfect_clears", "max_combo", "holes",
+}
+
+// The games as CSV, a row each
+func (history statsHistory) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	header := append([]string(nil), statsColumns...)
+	for l := 0; l < LEVELS; l++ {
+		header = append(header, fmt.Sprintf("level_%d_seconds", l))
+	}
+	cw.Write(header)
+
+	seconds := func(frames int) string {
+		return strconv.FormatFloat(float64(frames)/FPS, 'f', 2, 64)
+	}
+	for _, s := range history {
+		row := []string{
+			s.Ended.Format(time.RFC3339), s.Mode.String(), strconv.FormatBool(s.Aborted),
+			strconv.FormatUint(s.Score, 10), strconv.FormatUint(uint64(s.Lines), 10),
+			strconv.Itoa(int(s.Level)), seconds(s.Frames), strconv.Itoa(s.placed()),
+			strconv.FormatFloat(s.pps(), 'f', 2, 64), strconv.FormatFloat(s.kpp(), 'f', 2, 64),
+		}
+		for _, n := range s.Clears {
+			row = append(row, strconv.Itoa(n))
+		}
+		row = append(row, strconv.Itoa(s.TSpins), strconv.Itoa(s.PerfectClears),
+			strconv.Itoa(s.MaxCombo), strconv.Itoa(s.Holes))
+		for _, f := range s.LevelFrames {
+			row = append(row, seconds(f))
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Export the games to path, as CSV if it ends with .csv, else as JSON
+func (history statsHistory) export(path string) error {
+	if !strings.EqualFold(filepath.Ext(path), ".csv") {
+		return writeJSON(path, history)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := history.writeCSV(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// The stats command, prints the lifetime stats or exports the games
+func RunStats(args []string) error {
+	flags := flag.NewFlagSet("stats", flag.ContinueOnError)
+	format := flags.String("format", "", "print the games as csv or json, the summary if empty")
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	history, err := loadStatsHistory()
+	if err != nil {
+		return err
+	}
+	switch *format {
+	case "":
+		fmt.Println(history.report())
+	case "csv":
+		return history.writeCSV(os.Stdout)
+	case "json":
+		data, err := json.MarshalIndent(history, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package tetris
+
+import (
+	"log"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// Report of the game over, with the finesse in finesse mode. The games
+// played to the end by the player are added to the lifetime stats
+func (v *view) showGameReport() {
+	s, f := v.stats, v.finesse
+	v.stats, v.finesse = nil, nil
+	if s == nil || v.win == nil || s.Aborted || demo != nil && demo.playing() {
+		return
+	}
+	saveGameStats(*s)
+
+	text := s.report()
+	if f != nil {
+		text += "\n\n" + f.report()
+	}
+	glib.IdleAdd(func() {
+		msg := gtk.MessageDialogNew(v.win, gtk.DIALOG_MODAL,
+			gtk.MESSAGE_INFO, gtk.BUTTONS_OK, "%s", text)
+		msg.SetTitle(LABEL_STATS)
+		defer msg.Destroy()
+		msg.Run()
+	})
+}
+
+func saveGameStats(s gameStats) {
+	go func() {
+		if err := saveToHistory(s); err != nil {
+			log.Println("Could not save stats:", err)
+		}
+	}()
+}
+
+// Lifetime stats of the games played, exported as CSV or JSON
+func showStatsDialog(parent *gtk.ApplicationWindow) {
+	dialog, err := gtk.DialogNew()
+	if err != nil {
+		log.Println("Could not create dialog:", err)
+		return
+	}
+	dialog.SetTitle(LABEL_STATS)
+	dialog.SetTransientFor(parent)
+	dialog.SetModal(true)
+	dialog.AddButton("Export...", gtk.RESPONSE_APPLY)
+	dialog.AddButton("Close", gtk.RESPONSE_CLOSE)
+	defer dialog.Destroy()
+
+	history, err := loadStatsHistory()
+	text := history.report()
+	if err != nil {
+		log.Println("Could not load stats:", err)
+		text = err.Error()
+	}
+	label, _ := gtk.LabelNew(text)
+	label.SetXAlign(0)
+	content, _ := dialog.GetContentArea()
+	content.PackStart(label, false, false, 10)
+	dialog.ShowAll()
+
+	for dialog.Run() == gtk.RESPONSE_APPLY {
+		exportStats(dialog, history)
+	}
+}
+
+// Export the games to a file chosen, as CSV if named *.csv, else JSON
+func exportStats(parent gtk.IWindow, history statsHistory) {
+	chooser, err := gtk.FileChooserDialogNewWith2Buttons("Export Statistics", parent,
+		gtk.FILE_CHOOSER_ACTION_SAVE, "Cancel", gtk.RESPONSE_CANCEL, "Save", gtk.RESPONSE_ACCEPT)
+	if err != nil {
+		log.Println("Could not create file chooser:", err)
+		return
+	}
+	defer chooser.Destroy()
+	chooser.SetDoOverwriteConfirmation(true)
+	chooser.SetCurrentName("tetris-stats.csv")
+
+	if chooser.Run() != gtk.RESPONSE_ACCEPT {
+		return
+	}
+	path := chooser.GetFilename()
+	if err := history.export(path); err != nil {
+		log.Printf("Could not export stats %s: %v", path, err)
+		msg := gtk.MessageDialogNew(parent, gtk.DIALOG_MODAL,
+			gtk.MESSAGE_ERROR, gtk.BUTTONS_OK, "%s", err.Error())
+		defer msg.Destroy()
+		msg.Run()
+	}
+}
@@ -0,0 +1,189 @@
+package tetris
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStatsLock(t *testing.T) {
+	s := newGameStats()
+	locks := []struct {
+		id, rows, holes int
+		perfect         bool
+	}{
+		{15, 1, 0, false},
+		{25, 2, -1, false},
+		{53, 0, 2, false},
+		{15, 4, 0, true},
+		{17, 1, 1, false},
+		{17, 1, 0, false},
+	}
+	for _, l := range locks {
+		s.landed = l.id
+		s.lock(l.rows, l.holes, l.perfect)
+	}
+
+	if want := [SHAPE_SIZE]int{3, 1, 0, 1}; s.Clears != want {
+		t.Errorf("clears %v, want %v", s.Clears, want)
+	}
+	if s.MaxCombo != 2 || s.PerfectClears != 1 || s.Holes != 3 {
+		t.Errorf("max combo %d, perfect clears %d, holes %d", s.MaxCombo, s.PerfectClears, s.Holes)
+	}
+	if s.placed() != len(locks) || s.Pieces[15] != 2 || s.Pieces[17] != 2 {
+		t.Errorf("pieces %v", s.Pieces)
+	}
+	if p := s.piecesText(); p != "I 2, L 2, O 1, T 1" && p != "I 2, J 2, O 1, T 1" {
+		t.Errorf("pieces text %q", p)
+	}
+
+	s.Frames, s.Keys = 4*FPS, 9
+	if s.pps() != 1.5 || s.kpp() != 1.5 {
+		t.Errorf("pps %v, kpp %v", s.pps(), s.kpp())
+	}
+}
+
+// A tetris by a hard drop, clearing the board
+func TestStatsOfGame(t *testing.T) {
+	n, err := parseNotation("current: 16\npos: 9 0\nboard:\nXXXXXXXXXX.\nXXXXXXXXXX.\nXXXXXXXXXX.\nXXXXXXXXXX.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := newHeadlessGame()
+	g.stepped = true
+	g.start()
+	if err := g.loadNotation(n); err != nil {
+		t.Fatal(err)
+	}
+	g.step(nil)
+	g.step([]inputEvent{{CTRL_HARD_DROP, true}})
+
+	g.m.Lock()
+	s := g.currentStats()
+	g.m.Unlock()
+	if s.Clears[3] != 1 || s.PerfectClears != 1 || s.Pieces[16] != 1 || s.Lines != 4 {
+		t.Errorf("clears %v, perfect %d, pieces %v, lines %d", s.Clears, s.PerfectClears, s.Pieces, s.Lines)
+	}
+	if s.Keys != 1 || s.Frames != 2 || s.LevelFrames[0] != 2 || s.Holes != 0 {
+		t.Errorf("keys %d, frames %d at level 0 %d, holes %d", s.Keys, s.Frames, s.LevelFrames[0], s.Holes)
+	}
+
+	g.restart()
+	g.m.Lock()
+	defer g.m.Unlock()
+	if g.stats.placed() != 0 || g.stats.Aborted {
+		t.Errorf("stats not reset: %+v", g.stats)
+	}
+}
+
+func TestStatsHistory(t *testing.T) {
+	a, b := newGameStats(), newGameStats()
+	a.Score, a.Lines, a.Frames, a.MaxCombo = 1000, 10, 600, 3
+	a.Pieces[15] = 20
+	b.Score, b.Lines, b.Frames, b.MaxCombo, b.Level = 500, 30, 1200, 1, 1
+	b.Pieces[15], b.Pieces[53] = 10, 30
+	b.Mode = MODE_DIG
+
+	var history statsHistory
+	for i := 0; i < MAX_HISTORY; i++ {
+		history = history.add(newGameStats())
+	}
+	history = history.add(a).add(b)
+	if len(history) != MAX_HISTORY || history[len(history)-1].Score != b.Score {
+		t.Fatalf("%d games kept", len(history))
+	}
+	history = history[len(history)-2:]
+
+	total := history.total()
+	if total.Score != 1000 || total.Level != 1 || total.MaxCombo != 3 || total.Lines != 40 ||
+		total.Frames != 1800 || total.Pieces[15] != 30 || total.placed() != 60 {
+		t.Errorf("total %+v", total)
+	}
+	if r := history.report(); !strings.HasPrefix(r, "Games: 2\nBest score: 1000\n") {
+		t.Errorf("report %q", r)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "stats.csv")
+	if err := history.export(path); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || len(records[0]) != len(statsColumns)+LEVELS {
+		t.Fatalf("%d records, header %v", len(records), records[0])
+	}
+	if row := records[2]; row[1] != "dig" || row[3] != "500" || row[6] != "20.00" || row[8] != "2.00" {
+		t.Errorf("row %v", row)
+	}
+
+	path = filepath.Join(dir, "stats.json")
+	if err := history.export(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loaded statsHistory
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 2 || loaded[1].Mode != MODE_DIG || loaded[1].Pieces[53] != 30 {
+		t.Errorf("loaded %+v", loaded)
+	}
+}
+
+// A history that could not be parsed is kept as it is, not overwritten by
+// the next game saved
+func TestStatsHistoryCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	old, set := os.LookupEnv("XDG_CONFIG_HOME")
+	os.Setenv("XDG_CONFIG_HOME", dir)
+	defer func() {
+		if set {
+			os.Setenv("XDG_CONFIG_HOME", old)
+		} else {
+			os.Unsetenv("XDG_CONFIG_HOME")
+		}
+	}()
+	path, err := statsHistoryPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// none saved yet
+	if history, err := loadStatsHistory(); err != nil || len(history) != 0 {
+		t.Fatalf("loaded %d games, %v", len(history), err)
+	}
+	if err := saveToHistory(newGameStats()); err != nil {
+		t.Fatal(err)
+	}
+	if history, err := loadStatsHistory(); err != nil || len(history) != 1 {
+		t.Fatalf("loaded %d games, %v", len(history), err)
+	}
+
+	corrupt := []byte(`[{"Score": 1000}, {"Score": 2`)
+	if err := os.WriteFile(path, corrupt, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadStatsHistory(); err == nil {
+		t.Error("loaded a corrupt history")
+	}
+	if err := saveToHistory(newGameStats()); err == nil {
+		t.Error("saved over a corrupt history")
+	}
+	if data, _ := os.ReadFile(path); string(data) != string(corrupt) {
+		t.Errorf("history overwritten as %s", data)
+	}
+}
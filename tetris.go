@@ -1,6 +1,7 @@
 package tetris
 
 import (
+	"fmt"
 	"log"
 	"sync"
 	"time"
@@ -10,44 +11,85 @@ const (
 	ROW = 19
 	COL = 11
 
-	LEVELS = 6
-)
+	LEVELS = 20
 
-const (
-	STATE_ZERO = iota
-	SATE_GAMEOVER
-	STATE_GAMING
-	STATE_PAUSED
+	MAX_PREVIEWS = 6
+
+	FPS   = 60 // frames per second of the game loop
+	FRAME = time.Second / FPS
+
+	RESUME_COUNT = 3 // counted down to resume
+	RESUME_STEP  = time.Second / 2
 )
 
 var (
 	// score table
 	scores = [SHAPE_SIZE]int{100, 300, 500, 700}
-
-	// speed table, mapping level to speed
-	speeds = [LEVELS]int{1500, 1300, 1000, 800, 500, 300}
 )
 
 type Game struct {
-	state     int32
+	state     State
 	model     [ROW][COL]uint8
 	currShape *Shape
-	oldShape  *Shape // for rotate
-	nextShape *Shape
+	oldShape  *Shape   // for rotate & hold
+	queue     []*Shape // next shapes to preview
+	previews  int      // length of the queue
+	holdShape *Shape
+	held      bool // hold is allowed once per shape
 
 	pos        Point // position of current shape
 	level      uint8 // starts from 0
 	score      uint64
 	rows       uint
 	waterLevel int
-
-	chanMoving chan *Moving // shape moving chan
-	chanRedraw chan *Area   // redraw area chan
-	chanHiligh chan int     // highlight row chan
-	chanLevel  chan uint8   // level chan
-	chanScore  chan uint64  // score chan
-	chanState  chan int32   // state chan
-	chanNexts  chan bool    // show next shape
+	round      int // increased on each start, to stop the stale game loop
+	entry      int // frames left of the entry delay
+	falling    int // gravity accumulated since the last fall, in 1/GRAVITY_G cells
+	locking    int // frames on the stack, of the lock delay
+	startLevel uint8
+	levels     LevelCurve
+	pieces     uint // shapes landed, including the swapped by hold
+
+	mode           Mode
+	digRows        int // garbage rows at start of dig mode
+	garbage        GarbagePattern
+	pendingGarbage int32 // garbage rows to rise, accessed atomically
+	well           int   // hole column of GARBAGE_WELL
+	hole           int   // hole column of the last garbage row
+	finesse        finesse
+	fading         fading
+	stats          gameStats
+	puzzle         *puzzle // played in puzzle mode
+	spun           bool    // the shape was turned, not shifted, since it landed
+	tspinDoubles   int
+	gradePoints    int // earned in master mode
+
+	rnd       randomizer
+	rand      *seededRand // for garbage holes
+	stepped   bool        // stepped by a lockstep driver, instead of its own loop
+	handling  Handling
+	input     input
+	chanInput chan inputEvent // key press/release queue
+
+	chanMoving  chan *Moving   // shape moving chan
+	chanRedraw  chan *Area     // redraw area chan
+	chanHiligh  chan int       // highlight row chan
+	chanLevel   chan uint8     // level chan
+	chanScore   chan uint64    // score chan
+	chanState   chan State     // state chan
+	chanCount   chan int       // countdown to resume
+	chanNexts   chan []*Shape  // show next shapes
+	chanHold    chan bool      // show hold shape
+	chanGarbage chan int       // show pending garbage rows
+	chanFinesse chan finesse   // finesse of the game, in finesse mode
+	chanStats   chan gameStats // stats of the game, when over
+
+	// hooks of a versus match, called with g.m held
+	attack    func(rows int) // send garbage rows to the opponent
+	toppedOut func()
+
+	spectate     func(e *specEvent) // stream events to spectators, called with g.m held
+	puzzleSolved func(p *puzzle)    // e.g. to save the progress, called with g.m held
 
 	m       sync.Mutex
 	stateOk *sync.Cond
@@ -55,22 +97,37 @@ type Game struct {
 
 func NewGame() *Game {
 	g := &Game{
-		state:      STATE_ZERO,
-		currShape:  randShape(),
-		nextShape:  randShape(),
-		level:      0,
-		waterLevel: ROW,
-		score:      0,
-		rows:       0,
-		chanMoving: make(chan *Moving),
-		chanRedraw: make(chan *Area),
-		chanHiligh: make(chan int),
-		chanLevel:  make(chan uint8),
-		chanScore:  make(chan uint64),
-		chanState:  make(chan int32),
-		chanNexts:  make(chan bool),
+		state:       STATE_READY,
+		previews:    1,
+		rnd:         newRandomizer(time.Now().UnixNano()),
+		rand:        newSeededRand(time.Now().UnixNano()),
+		garbage:     GARBAGE_CHEESE,
+		level:       0,
+		levels:      DefaultLevelCurve(),
+		waterLevel:  ROW,
+		score:       0,
+		rows:        0,
+		handling:    DefaultHandling(),
+		input:       newInput(),
+		chanInput:   make(chan inputEvent, INPUT_QUEUE_SIZE),
+		chanMoving:  make(chan *Moving),
+		chanRedraw:  make(chan *Area),
+		chanHiligh:  make(chan int),
+		chanLevel:   make(chan uint8),
+		chanScore:   make(chan uint64),
+		chanState:   make(chan State),
+		chanCount:   make(chan int),
+		chanNexts:   make(chan []*Shape),
+		chanHold:    make(chan bool),
+		chanGarbage: make(chan int),
+		chanFinesse: make(chan finesse),
+		chanStats:   make(chan gameStats),
+		stats:       newGameStats(),
+		fading:      fading{frames: DEFAULT_FADE_FRAMES},
 	}
 	g.stateOk = sync.NewCond(&g.m)
+	g.fillQueue()
+	g.currShape = g.popNext()
 	return g
 }
 
@@ -83,53 +140,176 @@ func (g *Game) reset() {
 		}
 	}
 
-	g.state = STATE_ZERO
-	g.currShape = randShape()
-	g.nextShape = randShape()
+	g.queue = nil
+	g.fillQueue()
+	g.currShape = g.popNext()
+	g.holdShape = nil
+	g.held = false
 	g.level = 0
 	g.waterLevel = ROW
 	g.score = 0
 	g.rows = 0
+	g.entry = 0
+	g.falling = 0
+	g.locking = 0
+	g.input = newInput()
+	g.pendingGarbage = 0
+	g.tspinDoubles = 0
+	g.gradePoints = 0
+	g.stats = newGameStats()
+	g.fading = fading{frames: g.fading.frames}
 }
 
 // init g.pos and notiy ui
 func (g *Game) landing() {
-	g.pos = Point{
+	g.pos = spawnPoint(g.currShape)
+	g.pieces++
+	g.finesse.spawn = aiNode{g.currShape.id, g.pos.left, g.pos.top}
+	g.input.presses = 0
+	g.spun = false
+	g.locking = 0
+	g.stats.landed = g.currShape.id
+
+	g.chanMoving <- &Moving{InvalidPoint, g.pos}
+	g.emit(EVENT_MOVE)
+}
+
+// Where a shape lands, at the top center
+func spawnPoint(s *Shape) Point {
+	return Point{
 		left: (COL-SHAPE_SIZE)/2 + 1,
-		top:  -g.currShape.bounds().y,
+		top:  -s.bounds().y,
 	}
+}
 
-	g.chanMoving <- &Moving{InvalidPoint, g.pos}
+// Take the next shape from the queue, nil if out of the pieces of a puzzle.
+// The caller should hold g.m
+func (g *Game) popNext() *Shape {
+	if len(g.queue) == 0 {
+		return g.rnd.next()
+	}
+	s := g.queue[0]
+	g.queue = g.queue[1:]
+	if next := g.rnd.next(); next != nil {
+		g.queue = append(g.queue, next)
+	}
+	return s
+}
+
+// Fill or cut the queue to g.previews shapes
+func (g *Game) fillQueue() {
+	for len(g.queue) < g.previews {
+		s := g.rnd.next()
+		if s == nil {
+			break
+		}
+		g.queue = append(g.queue, s)
+	}
+	if len(g.queue) > g.previews {
+		g.queue = g.queue[:g.previews]
+	}
+}
+
+// Deal the shapes by rnd from now on, the caller should hold g.m
+func (g *Game) useRandomizer(rnd randomizer) {
+	g.rnd = rnd
+	g.queue = nil
+	g.fillQueue()
+	g.currShape = g.popNext()
 }
 
-func (g *Game) start() {
+// Notify ui with a copy of the queue
+func (g *Game) showNexts() {
+	g.chanNexts <- append([]*Shape{}, g.queue...)
+}
+
+func (g *Game) setPreviews(n int) {
 	g.m.Lock()
 	defer g.m.Unlock()
 
-	if g.state > SATE_GAMEOVER {
-		log.Printf("could not start as current state is %d", g.state)
+	if n < 0 || n > MAX_PREVIEWS {
+		log.Printf("previews %d out of range [0, %d]", n, MAX_PREVIEWS)
 		return
 	}
+	g.previews = n
+	g.fillQueue()
+	g.showNexts()
+}
+
+// Start a new game, counting down first unless stepped
+func (g *Game) start() error {
+	g.m.Lock()
+	defer g.m.Unlock()
 
-	if g.state > STATE_ZERO {
+	if g.state != STATE_READY {
+		if err := g.state.check(STATE_READY); err != nil {
+			log.Println("could not start:", err)
+			return err
+		}
 		g.reset()
-		g.chanState <- STATE_ZERO
+		g.changeState(STATE_READY)
 	}
 
+	g.round++
+	g.level = g.firstLevel()
+	g.initMode()
 	g.landing()
-	g.chanNexts <- true
+	g.showNexts()
+	g.chanHold <- true
 	g.chanScore <- g.score
 	g.chanLevel <- g.level
-	g.changeState(STATE_GAMING)
-	go g.startGame()
+	if g.stepped {
+		return g.changeState(STATE_PLAYING)
+	}
+	g.changeState(STATE_COUNTDOWN)
+	go g.startGame(g.round)
+	return nil
 }
 
-func (g *Game) startGame() {
-	log.Println("start to game")
+// Seed the shapes & garbage holes before start, so that the games
+// with the same seed and inputs are the same
+func (g *Game) seed(seed int64) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	g.rand = newSeededRand(seed)
+	g.hole = 0
+	g.useRandomizer(newRandomizer(seed))
+}
+
+// Abort the current game if any, and start a new one
+func (g *Game) restart() {
+	g.m.Lock()
+	if g.running() {
+		g.stats.Aborted = true
+		g.changeState(STATE_GAMEOVER)
+		g.stateOk.Broadcast()
+	}
+	g.m.Unlock()
+
+	g.start()
+}
+
+func (g *Game) startGame(round int) {
 	time.Sleep(time.Second)
+	g.m.Lock()
+	counted := round == g.round && g.state == STATE_COUNTDOWN
+	if counted {
+		g.changeState(STATE_PLAYING)
+	}
+	g.m.Unlock()
+	if !counted {
+		return
+	}
+	log.Println("start to game")
 
-	for g.continueGame() {
-		time.Sleep(g.speed())
+	ticker := time.NewTicker(FRAME)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if !g.tick(round) {
+			break
+		}
 
 		// check if paused
 		g.m.Lock()
@@ -143,43 +323,204 @@ func (g *Game) startGame() {
 	log.Println("game over")
 }
 
-func (g *Game) continueGame() bool {
+// Step one frame, returns false if the game is over
+func (g *Game) tick(round int) bool {
 	g.m.Lock()
 	defer g.m.Unlock()
 
-	mv, err := g.currShape.moveDown(g.pos)
-	if g.canMove(err, mv) {
-		g.moveTo(mv)
+	if round != g.round || !g.running() {
+		return false
+	}
+	if !g.state.active() {
+		return true // paused, waited for by the caller
+	}
+
+	for n := len(g.chanInput); n > 0; n-- {
+		g.input.apply(<-g.chanInput)
+	}
+	return g.frame()
+}
+
+// Step one frame with the inputs of the frame, by a lockstep driver;
+// returns false if the game is over
+func (g *Game) step(events []inputEvent) bool {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	if !g.state.active() {
+		return false
+	}
+
+	for _, e := range events {
+		g.input.apply(e)
+	}
+	return g.frame()
+}
+
+// One frame of the game, the caller should hold g.m
+func (g *Game) frame() bool {
+	g.handleInput()
+	if !g.state.active() {
+		return false
+	}
+	g.stats.frame(g.level)
+	g.fade()
+
+	if g.entry > 0 {
+		g.entry--
+		if g.entry == 0 {
+			g.clearing(false)
+		}
 		return true
 	}
+	return g.fall()
+}
+
+// Apply gravity, returns false if game over
+func (g *Game) fall() bool {
+	if g.input.held[CTRL_SOFT_DROP] && g.handling.SoftDropFactor == 0 {
+		g.dropDown()
+	}
+
+	// fall the rows of the gravity accumulated, and lock if on the
+	// stack already without lock delay
+	g.falling += int(g.gravity())
+	for rows := 0; g.falling >= GRAVITY_G; rows++ {
+		if !g.tryMove((*Shape).moveDown) {
+			g.falling = 0
+			if rows > 0 || g.lockDelay() > 0 {
+				break
+			}
+			return g.lockShape()
+		}
+		g.locking = 0 // reset by each row fallen
+		g.falling -= GRAVITY_G
+	}
+	return g.countLock()
+}
+
+// Count the frames on the stack of the lock delay, and lock when they are
+// up or soft dropping. Returns false if game over
+func (g *Game) countLock() bool {
+	delay := g.lockDelay()
+	if delay == 0 || !g.grounded() {
+		return true
+	}
+	g.locking++
+	if g.locking >= delay || g.input.held[CTRL_SOFT_DROP] {
+		return g.lockShape()
+	}
+	return true
+}
+
+// Returns true if the shape can't move down, the caller should hold g.m
+func (g *Game) grounded() bool {
+	mv, err := g.currShape.moveDown(g.pos)
+	return !g.canMove(err, mv)
+}
 
+// Lock the current shape into g.model and land the next one,
+// returns false if game over
+func (g *Game) lockShape() bool {
+	if g.mode == MODE_FINESSE {
+		g.judgeFinesse()
+	}
 	g.updateWaterLevel()
 
 	// if game over
 	if 0 == g.waterLevel {
-		g.changeState(SATE_GAMEOVER)
+		g.topOut()
 		return false
 	}
 
+	holes := g.holes()
 	g.updateModel()
-	g.promote()
+	g.stampShape()
+	g.emit(EVENT_LOCK)
+	cleared := g.promote()
+	g.stats.lock(cleared, g.holes()-holes, cleared > 0 && boardOf(&g.model) == bitboard{})
+
+	if g.finished() {
+		g.changeState(STATE_FINISHED)
+		return false
+	}
+
+	if !g.risePendingGarbage() {
+		g.topOut()
+		return false
+	}
 
-	g.currShape = g.nextShape
-	g.nextShape = randShape()
+	next := g.popNext()
+	if next == nil {
+		if next = g.takeHold(); next == nil {
+			g.checkPuzzle()
+			return false
+		}
+	}
+	g.currShape = next
+	g.held = false
+	g.entry = g.entryDelay(cleared)
+	g.falling = 0
 	g.landing()
-	g.chanNexts <- true
+	g.showNexts()
 
+	if g.blockedOut() {
+		g.topOut()
+		return false
+	}
+	g.clearing(cleared > 0 && g.entry > 0)
 	return true
 }
 
-func (g *Game) changeState(state int32) {
+// The rows cleared are shown until the next shape enters, the caller
+// should hold g.m
+func (g *Game) clearing(on bool) {
+	switch {
+	case on && g.state == STATE_PLAYING:
+		g.changeState(STATE_LINE_CLEAR)
+	case !on && g.state == STATE_LINE_CLEAR:
+		g.changeState(STATE_PLAYING)
+	}
+}
+
+// Returns true if the shape landed is on the stack, the caller should hold g.m
+func (g *Game) blockedOut() bool {
+	return !g.canMoveShape(g.currShape, nil, &Moving{g.pos, g.pos})
+}
+
+// Returns true if started & not over
+func (g *Game) running() bool {
+	return g.state.running()
+}
+
+// Change the state by the transitions allowed, and notify; the caller
+// should hold g.m
+func (g *Game) changeState(state State) error {
+	if err := g.state.check(state); err != nil {
+		log.Println(err)
+		return err
+	}
+	if state.over() {
+		s := g.currentStats()
+		s.Ended = time.Now()
+		g.chanStats <- s
+	}
+	g.setState(state)
+	return nil
+}
+
+// Set the state as it is, of a mirror or a game restored; the caller
+// should hold g.m
+func (g *Game) setState(state State) {
 	g.state = state
 	g.chanState <- state
+	g.emit(EVENT_STATE)
 }
 
 func (g *Game) moveTo(mv *Moving) {
 	g.pos = mv.to
 	g.chanMoving <- mv
+	g.emit(EVENT_MOVE)
 }
 
 func (g *Game) updateWaterLevel() {
@@ -203,13 +544,16 @@ func (g *Game) updateModel() {
 	}
 }
 
-func (g *Game) promote() {
+// Clear the full rows of the shape locked, returns the rows cleared
+func (g *Game) promote() int {
 	p := g.pos
 	m := &g.model
 
+	tspin := g.tspin()
+
 	// erase promoted rows
-	n := 0
-	top := p.top
+	var cleared []int
+	top := p.top + g.currShape.bounds().y
 	for i := ROW - 1; i >= top; i-- { // top
 		k := i
 		for j := 0; j < COL; j++ { // left
@@ -218,30 +562,54 @@ func (g *Game) promote() {
 				break
 			}
 		}
-		// erase k-th row
-		if k > 0 {
+		// erase k-th row, or empty it to cascade
+		if k >= 0 {
 			g.hilighRow(k)
+			cleared = append(cleared, k)
+			if g.mode == MODE_CASCADE {
+				m[k] = [COL]uint8{}
+				continue
+			}
 			g.eraseRow(k)
-			n++
 			top++
 			i++
 		}
 	}
 
+	n := len(cleared)
 	if n == 0 {
-		return
+		return 0
 	}
+	g.emit(EVENT_CLEAR, cleared...)
+	g.revealStack()
 
 	// compute rows & score
 	newScore := uint64(earnScore(n, g.level))
 	g.rows += uint(n)
 	g.score += newScore
+	g.earnGrade(n)
 	g.chanScore <- g.score
+	g.emit(EVENT_SCORE)
+	g.attackBy(n)
+	if tspin {
+		g.stats.TSpins++
+	}
+	if tspin && n == 2 {
+		g.tspinDoubles++
+		log.Println("[promote] T-spin double")
+	}
 	log.Printf("[promote] rows=%d(+%d) score=%d(+%d)", g.rows, n, g.score, newScore)
 
-	// compute level
-	l := uint8(g.rows / ROW)
-	if l < LEVELS && l > g.level {
+	g.levelUp()
+	if g.mode == MODE_CASCADE {
+		g.cascade()
+	}
+	return n
+}
+
+// Up the level by the rows cleared, the caller should hold g.m
+func (g *Game) levelUp() {
+	if l := g.levelCurve().levelOf(g.firstLevel(), g.rows); l > g.level {
 		log.Printf("[promote] level %d -> %d", g.level, l)
 		g.level = l
 		g.chanLevel <- l
@@ -260,9 +628,12 @@ func (g *Game) hilighRow(k int) {
 func (g *Game) eraseRow(k int) {
 	m := &g.model
 	top := g.waterLevel
-	for i := k; i >= top && i > 1; i-- {
+	locked := &g.fading.locked
+	for i := k; i > top; i-- {
 		m[i] = m[i-1]
+		locked[i] = locked[i-1]
 	}
+	m[top] = [COL]uint8{}
 	g.waterLevel++
 
 	// notify gui to redraw the area(top~k rows)
@@ -270,73 +641,167 @@ func (g *Game) eraseRow(k int) {
 	g.chanRedraw <- area
 }
 
-// Returns an int value in miliseconds
-func (g *Game) speed() time.Duration {
-	return time.Duration(speeds[g.level]) * time.Millisecond
-}
-
-func (g *Game) pause() {
+func (g *Game) pause() error {
 	g.m.Lock()
 	defer g.m.Unlock()
 
-	if g.state != STATE_GAMING {
-		log.Printf("could not pause as current state is %d", g.state)
-		return
+	if err := g.changeState(STATE_PAUSED); err != nil {
+		return err
 	}
-	g.changeState(STATE_PAUSED)
 	log.Println("game paused")
+	return nil
 }
 
-func (g *Game) resume() {
+func (g *Game) resume() error {
 	g.m.Lock()
 	defer g.m.Unlock()
 
 	if g.state != STATE_PAUSED {
-		log.Printf("could not resume as current state is %d", g.state)
-		return
+		err := fmt.Errorf("%w: resume when %s", ErrorTransition, g.state)
+		log.Println(err)
+		return err
+	}
+	if g.stepped {
+		g.changeState(STATE_PLAYING)
+		log.Println("game resumed")
+		return nil
 	}
-	g.changeState(STATE_GAMING)
+
+	// the loop ticks on, skipping the frames until counted down
+	g.changeState(STATE_COUNTDOWN)
 	g.stateOk.Signal()
-	log.Println("game resumed")
+	go g.countdown(g.round)
+	return nil
+}
+
+// Count down to resume the game of the round, unless restarted or over
+func (g *Game) countdown(round int) {
+	for n := RESUME_COUNT; n > 0; n-- {
+		g.m.Lock()
+		if round != g.round || g.state != STATE_COUNTDOWN {
+			g.m.Unlock()
+			return
+		}
+		g.chanCount <- n
+		g.m.Unlock()
+		time.Sleep(RESUME_STEP)
+	}
+
+	g.m.Lock()
+	defer g.m.Unlock()
+	if round == g.round && g.state == STATE_COUNTDOWN {
+		g.changeState(STATE_PLAYING)
+		log.Println("game resumed")
+	}
 }
 
-func (g *Game) rotate() {
+// Pause if playing, e.g. on focus lost; the countdown is not paused
+func (g *Game) autoPause() {
 	g.m.Lock()
 	defer g.m.Unlock()
 
-	newShape, mv, err := g.currShape.rotate(g.pos)
+	if g.state.check(STATE_PAUSED) == nil {
+		g.changeState(STATE_PAUSED)
+		log.Println("game paused automatically")
+	}
+}
+
+func (g *Game) togglePause() {
+	g.m.Lock()
+	paused := g.state == STATE_PAUSED
+	g.m.Unlock()
+
+	if paused {
+		g.resume()
+	} else {
+		g.pause()
+	}
+}
+
+// Rotate if possible, the caller should hold g.m
+func (g *Game) tryRotate(rotate func(*Shape, Point) (*Shape, *Moving, error)) bool {
+	newShape, mv, err := rotate(g.currShape, g.pos)
 
 	if g.canMoveShape(newShape, err, mv) {
 		g.oldShape = g.currShape
 		g.currShape = newShape
+		g.spun = true
 		g.moveTo(mv)
+		return true
 	}
+	return false
 }
 
-func (g *Game) moveLeft() {
+func (g *Game) hold() {
 	g.m.Lock()
 	defer g.m.Unlock()
 
-	mv, err := g.currShape.moveLeft(g.pos)
-	if g.canMove(err, mv) {
-		g.moveTo(mv)
+	if g.state == STATE_PLAYING {
+		g.swapHold()
 	}
 }
 
-func (g *Game) moveRight() {
-	g.m.Lock()
-	defer g.m.Unlock()
+// Swap the current shape with the hold one (or the next one if none held),
+// the caller should hold g.m
+func (g *Game) swapHold() {
+	if g.held {
+		return
+	}
+
+	next := g.holdShape
+	if next == nil {
+		if next = g.popNext(); next == nil {
+			return // out of the pieces of a puzzle
+		}
+		g.showNexts()
+	}
+
+	// erase the current shape
+	g.oldShape = g.currShape
+	g.chanMoving <- &Moving{g.pos, InvalidPoint}
 
-	mv, err := g.currShape.moveRight(g.pos)
+	g.currShape = next
+	g.holdShape = g.oldShape
+	g.held = true
+
+	g.falling = 0
+	g.landing()
+	g.chanHold <- true
+	g.emit(EVENT_HOLD)
+
+	if g.blockedOut() {
+		g.topOut()
+	}
+}
+
+// Move if possible, the caller should hold g.m
+func (g *Game) tryMove(move func(*Shape, Point) (*Moving, error)) bool {
+	mv, err := move(g.currShape, g.pos)
 	if g.canMove(err, mv) {
+		if mv.to.left != mv.from.left {
+			g.spun = false
+		}
 		g.moveTo(mv)
+		return true
 	}
+	return false
 }
 
-func (g *Game) dropDown() {
+// Drop to the bottom and lock at once
+func (g *Game) hardDrop() {
 	g.m.Lock()
 	defer g.m.Unlock()
 
+	if g.state != STATE_PLAYING {
+		return
+	}
+
+	g.dropDown()
+	g.lockShape()
+}
+
+// Move to the bottom, the caller should hold g.m
+func (g *Game) dropDown() {
 	from := g.pos
 	to := InvalidPoint
 	s := g.currShape
@@ -368,7 +833,7 @@ func (g *Game) canMoveShape(shape *Shape, err error, mv *Moving) bool {
 
 	for i := a.x; i <= a.x2; i++ {
 		for j := a.y; j <= a.y2; j++ {
-			if m[j][i]&d[j-pos.top][i-pos.left] > 0 { // conflict
+			if m[j][i] > 0 && d[j-pos.top][i-pos.left] > 0 { // conflict
 				return false
 			}
 		}
@@ -0,0 +1,315 @@
+package tetris
+
+import (
+	"reflect"
+	"testing"
+)
+
+// A headless game of the board, the rows at the bottom
+func boardGame(t *testing.T, rows ...string) *Game {
+	t.Helper()
+	board, err := parseBoard(rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := newHeadlessGame()
+	g.model = board
+	g.waterLevel = stackTop(&board)
+	return g
+}
+
+func checkBoard(t *testing.T, name string, g *Game, rows ...string) {
+	t.Helper()
+	want, err := parseBoard(rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.model != want {
+		t.Errorf("%s: board\n%s want\n%s", name, formatBoard(&g.model), formatBoard(&want))
+	}
+	if top := stackTop(&want); g.waterLevel != top {
+		t.Errorf("%s: water level %d, want %d", name, g.waterLevel, top)
+	}
+}
+
+func TestCanMoveShape(t *testing.T) {
+	g := boardGame(t,
+		"X..........",
+		"X...X......",
+	)
+	o := shapes[53] // in the middle columns of its box
+	tests := []struct {
+		name string
+		at   Point
+		want bool
+	}{
+		{"free", Point{5, ROW - 2}, true},
+		{"on a block", Point{3, ROW - 2}, false},
+		{"box over a block", Point{-1, ROW - 4}, true},
+		{"cells over a block", Point{-1, ROW - 3}, false},
+		{"left wall", Point{-2, 0}, false},
+		{"right wall", Point{COL - 2, 0}, false},
+		{"above the top", Point{4, -1}, false},
+		{"below the bottom", Point{4, ROW - 1}, false},
+	}
+	for _, test := range tests {
+		mv, err := checkMoving(o.area(test.at), test.at, test.at)
+		if got := g.canMoveShape(o, err, mv); got != test.want {
+			t.Errorf("%s: can move %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+// The shape locked is a vertical I in the last column, its rows full or not
+func TestPromote(t *testing.T) {
+	i := shapes[16] // in the second column of its box
+	tests := []struct {
+		name  string
+		rows  []string
+		top   int // of the box of the I
+		want  []string
+		lines int
+	}{
+		{"none", []string{
+			"..........X",
+			"..........X",
+			"X.........X",
+			"XXXXXXXXX.X",
+		}, ROW - 4, []string{
+			"..........X",
+			"..........X",
+			"X.........X",
+			"XXXXXXXXX.X",
+		}, 0},
+		{"single", []string{
+			"..........X",
+			"..........X",
+			"X.........X",
+			"XXXXXXXXXXX",
+		}, ROW - 4, []string{
+			"..........X",
+			"..........X",
+			"X.........X",
+		}, 1},
+		{"double apart", []string{
+			"..........X",
+			"XXXXXXXXXXX",
+			"X.........X",
+			"XXXXXXXXXXX",
+		}, ROW - 4, []string{
+			"..........X",
+			"X.........X",
+		}, 2},
+		{"triple", []string{
+			"XXXXXXXXXXX",
+			"XXXXXXXXXXX",
+			"X.........X",
+			"XXXXXXXXXXX",
+		}, ROW - 4, []string{
+			"X.........X",
+		}, 3},
+		{"tetris above a row", []string{
+			".XXXX......",
+			"XXXXXXXXXXX",
+			"XXXXXXXXXXX",
+			"XXXXXXXXXXX",
+			"XXXXXXXXXXX",
+			"XXXXX......",
+		}, ROW - 5, []string{
+			".XXXX......",
+			"XXXXX......",
+		}, 4},
+	}
+	for _, test := range tests {
+		g := boardGame(t, test.rows...)
+		g.currShape = i
+		g.pos = Point{COL - 2, test.top}
+		g.level = 2
+		g.promote()
+
+		checkBoard(t, test.name, g, test.want...)
+		var score uint64
+		if test.lines > 0 {
+			score = uint64(scores[test.lines-1] + 100*2)
+		}
+		if g.rows != uint(test.lines) || g.score != score {
+			t.Errorf("%s: %d rows, score %d; want %d, %d", test.name, g.rows, g.score, test.lines, score)
+		}
+	}
+}
+
+// Row 0 clears as any other, if a board is set up to the top
+func TestPromoteTopRow(t *testing.T) {
+	rows := make([]string, ROW)
+	rows[0] = "XXXXXXXXXXX"
+	for k := 1; k < ROW; k++ {
+		rows[k] = "XXXXXXXXXX."
+	}
+	rows[2] = "X.........."
+	g := boardGame(t, rows...)
+	g.currShape = shapes[16]
+	g.pos = Point{COL - 2, 0}
+	g.promote()
+
+	want := append([]string{"..........."}, rows[1:]...)
+	checkBoard(t, "top row", g, want...)
+	if g.rows != 1 {
+		t.Errorf("%d rows cleared, want 1", g.rows)
+	}
+}
+
+func TestEraseRow(t *testing.T) {
+	full := make([]string, ROW)
+	for k := range full {
+		full[k] = "X.........X"
+	}
+	full[0] = "XXXX......."
+
+	tests := []struct {
+		name string
+		rows []string
+		k    int
+		want []string
+	}{
+		{"bottom", []string{"X..........", "XXXXXXXXXXX"}, ROW - 1, []string{"X.........."}},
+		{"middle", []string{"X..........", "XXXXXXXXXXX", ".X........."}, ROW - 2, []string{"X..........", ".X........."}},
+		{"stack top", []string{"XXXXXXXXXXX", ".X........."}, ROW - 2, []string{".X........."}},
+		{"top row", full, 0, append([]string{"..........."}, full[1:]...)},
+		{"under the top row", full, 1, append([]string{"...........", full[0]}, full[2:]...)},
+	}
+	for _, test := range tests {
+		g := boardGame(t, test.rows...)
+		g.eraseRow(test.k)
+		checkBoard(t, test.name, g, test.want...)
+	}
+}
+
+func TestUpdateWaterLevel(t *testing.T) {
+	tests := []struct {
+		name  string
+		id    int
+		at    Point
+		level int
+		want  int
+	}{
+		{"empty board", 53, Point{4, ROW - 2}, ROW, ROW - 2},
+		{"below the stack", 53, Point{4, ROW - 2}, 5, 5},
+		{"above the stack", 16, Point{4, 3}, 10, 3},
+		{"box row empty", 15, Point{4, 3}, 10, 4}, // the I is in the second row of its box
+		{"top row", 15, Point{4, -1}, 10, 0},
+	}
+	for _, test := range tests {
+		g := newHeadlessGame()
+		g.currShape = shapes[test.id]
+		g.pos = test.at
+		g.waterLevel = test.level
+		g.updateWaterLevel()
+		if g.waterLevel != test.want {
+			t.Errorf("%s: water level %d, want %d", test.name, g.waterLevel, test.want)
+		}
+	}
+}
+
+// The game is over when a shape locks in the top row, before the rows it
+// fills are cleared
+func TestGameOver(t *testing.T) {
+	g := newHeadlessGame()
+	g.seed(1)
+	g.stepped = true
+	g.start()
+
+	for n := 0; ; n++ {
+		if n > ROW*COL {
+			t.Fatal("no game over")
+		}
+		g.hardDrop()
+		for i := 0; i < g.handling.EntryDelay; i++ {
+			g.step(nil) // past the line clear, if any
+		}
+		g.m.Lock()
+		state, top := g.state, g.waterLevel
+		g.m.Unlock()
+		if state == STATE_GAMEOVER {
+			if top != 0 {
+				t.Errorf("game over at water level %d", top)
+			}
+			break
+		}
+		if top <= 0 {
+			t.Fatalf("water level %d in game", top)
+		}
+	}
+	if g.step(nil) {
+		t.Error("stepped after game over")
+	}
+}
+
+func TestLevelUp(t *testing.T) {
+	tests := []struct {
+		name  string
+		rows  uint
+		level uint8
+		want  uint8
+	}{
+		{"below", ROW - 2, 0, 0},
+		{"to the next", ROW - 1, 0, 1},
+		{"skip one", 3*ROW - 1, 1, 3},
+		{"the last", (LEVELS-1)*ROW - 1, LEVELS - 2, LEVELS - 1},
+		{"beyond the last", LEVELS * ROW * 2, LEVELS - 1, LEVELS - 1},
+	}
+	for _, test := range tests {
+		g := boardGame(t, "XXXXXXXXXXX")
+		g.currShape = shapes[53]
+		g.pos = Point{4, ROW - 2}
+		g.rows = test.rows
+		g.level = test.level
+		g.promote()
+		if g.level != test.want {
+			t.Errorf("%s: level %d after %d rows, want %d", test.name, g.level, g.rows, test.want)
+		}
+	}
+}
+
+// The queue holds the previews in the order dealt by the randomizer, the
+// first of it to be the current shape next
+func TestPreviews(t *testing.T) {
+	var dealt []*Shape
+	r := newRandomizer(7)
+	for i := 0; i < 20; i++ {
+		dealt = append(dealt, r.next())
+	}
+
+	g := newHeadlessGame()
+	g.seed(7)
+	g.setPreviews(3)
+	g.m.Lock()
+	if g.currShape != dealt[0] || !reflect.DeepEqual(g.queue, dealt[1:4]) {
+		t.Errorf("current %d, queue %v; want %d, %v", g.currShape.id, g.queue, dealt[0].id, dealt[1:4])
+	}
+	for i := 1; i < 10; i++ {
+		if s := g.popNext(); s != dealt[i] || !reflect.DeepEqual(g.queue, dealt[i+1:i+4]) {
+			t.Errorf("popped %d, queue %v; want %d, %v", s.id, g.queue, dealt[i].id, dealt[i+1:i+4])
+		}
+	}
+	g.m.Unlock()
+
+	for _, n := range []int{MAX_PREVIEWS, 0, MAX_PREVIEWS + 1, -1} {
+		g.setPreviews(n)
+		g.m.Lock()
+		if len(g.queue) != g.previews || g.popNext() == nil {
+			t.Errorf("previews %d, queue of %d", g.previews, len(g.queue))
+		}
+		g.m.Unlock()
+	}
+	if g.previews != 0 {
+		t.Errorf("previews %d, out of range", g.previews)
+	}
+
+	// the state of the randomizer deals the same shapes again
+	s := r.state()
+	next := r.next()
+	r.setState(s)
+	if r.next() != next {
+		t.Error("dealt another shape from the state restored")
+	}
+}
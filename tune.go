@@ -0,0 +1,264 @@
+package tetris
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+const (
+	AI_FEATURES = 5 // weights of aiWeights
+
+	TUNE_ELITES     = 2   // best individuals kept as they are
+	TUNE_TOURNAMENT = 3   // individuals drawn to select a parent
+	TUNE_MUTATION   = 0.2 // chance of a weight to mutate
+	TUNE_SIGMA      = 0.2 // standard deviation of a mutation
+)
+
+func (w *aiWeights) vector() [AI_FEATURES]float64 {
+	return [AI_FEATURES]float64{w.Height, w.Lines, w.Holes, w.Bumpiness, w.Wells}
+}
+
+func weightsOf(v [AI_FEATURES]float64) *aiWeights {
+	return &aiWeights{Height: v[0], Lines: v[1], Holes: v[2], Bumpiness: v[3], Wells: v[4]}
+}
+
+// Scaled to the length of 1, the placements picked are the same
+func normalize(v [AI_FEATURES]float64) [AI_FEATURES]float64 {
+	n := 0.0
+	for _, x := range v {
+		n += x * x
+	}
+	if n = math.Sqrt(n); n > 0 {
+		for i := range v {
+			v[i] /= n
+		}
+	}
+	return v
+}
+
+type individual struct {
+	Weights *aiWeights `json:"weights"`
+	Fitness float64    `json:"fitness"` // mean rows cleared
+}
+
+// State of a tuning, saved after each generation to resume from
+type checkpoint struct {
+	Generation int           `json:"generation"` // done
+	Rand       uint64        `json:"rand"`       // state of the random numbers
+	Population []*individual `json:"population"` // the best first
+}
+
+func loadCheckpoint(path string) (*checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := new(checkpoint)
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+	if len(c.Population) == 0 {
+		return nil, fmt.Errorf("checkpoint %s: no population", path)
+	}
+	return c, nil
+}
+
+// Write to a temporary file then rename, not to leave half a file
+func writeJSON(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Evolves the weights of the AI by a genetic algorithm, the fitness of
+// an individual is the mean rows cleared of the same games for all
+type tuner struct {
+	rnd     *seededRand
+	size    int   // of the population
+	games   int   // per individual of a generation
+	pieces  int   // max per game
+	seed    int64 // of the first game
+	workers int
+}
+
+// Mean rows cleared by each of the population, the games are played
+// by the workers in parallel. The seeds of the games differ by generation
+func (t *tuner) evaluate(population []*individual, generation int) {
+	type job struct{ i, game int }
+	jobs := make(chan job)
+	rows := make([]uint, len(population))
+	var m sync.Mutex
+	var wg sync.WaitGroup
+
+	for k := 0; k < t.workers; k++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				seed := t.seed + int64(generation*t.games+j.game)
+				r := playAI(population[j.i].Weights, seed, t.pieces)
+				m.Lock()
+				rows[j.i] += r.rows
+				m.Unlock()
+			}
+		}()
+	}
+	for i := range population {
+		for game := 0; game < t.games; game++ {
+			jobs <- job{i, game}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	for i, p := range population {
+		p.Fitness = float64(rows[i]) / float64(t.games)
+	}
+	sort.SliceStable(population, func(i, j int) bool {
+		return population[i].Fitness > population[j].Fitness
+	})
+}
+
+// The first population, around the defaults
+func (t *tuner) populate() []*individual {
+	population := []*individual{{Weights: weightsOf(normalize(defaultWeights().vector()))}}
+	for len(population) < t.size {
+		v := defaultWeights().vector()
+		for i := range v {
+			v[i] += t.rnd.NormFloat64() * 0.5
+		}
+		population = append(population, &individual{Weights: weightsOf(normalize(v))})
+	}
+	return population
+}
+
+// The next generation from the population sorted by fitness:
+// the elites, and the children of the tournament winners
+func (t *tuner) breed(population []*individual) []*individual {
+	var next []*individual
+	for i := 0; i < TUNE_ELITES && i < len(population); i++ {
+		next = append(next, &individual{Weights: population[i].Weights})
+	}
+	for len(next) < t.size {
+		a, b := t.tournament(population), t.tournament(population)
+		next = append(next, &individual{Weights: weightsOf(t.mutate(t.cross(a, b)))})
+	}
+	return next
+}
+
+// The fittest of a few drawn at random
+func (t *tuner) tournament(population []*individual) *individual {
+	var best *individual
+	for i := 0; i < TUNE_TOURNAMENT; i++ {
+		p := population[t.rnd.Intn(len(population))]
+		if best == nil || p.Fitness > best.Fitness {
+			best = p
+		}
+	}
+	return best
+}
+
+// Mean of the parents weighted by fitness
+func (t *tuner) cross(a, b *individual) [AI_FEATURES]float64 {
+	fa, fb := a.Fitness+1, b.Fitness+1 // not to divide by zero
+	va, vb := a.Weights.vector(), b.Weights.vector()
+	var v [AI_FEATURES]float64
+	for i := range v {
+		v[i] = (va[i]*fa + vb[i]*fb) / (fa + fb)
+	}
+	return v
+}
+
+func (t *tuner) mutate(v [AI_FEATURES]float64) [AI_FEATURES]float64 {
+	for i := range v {
+		if t.rnd.Float64() < TUNE_MUTATION {
+			v[i] += t.rnd.NormFloat64() * TUNE_SIGMA
+		}
+	}
+	return normalize(v)
+}
+
+// The tune command, evolves the weights of the AI and saves the best
+func RunTune(args []string) error {
+	flags := flag.NewFlagSet("tune", flag.ContinueOnError)
+	size := flags.Int("population", 40, "individuals per generation")
+	generations := flags.Int("generations", 50, "generations to evolve")
+	games := flags.Int("games", 4, "games per individual of a generation")
+	pieces := flags.Int("pieces", 500, "max shapes per game")
+	seed := flags.Int64("seed", 1, "seed of the tuning & the games")
+	workers := flags.Int("workers", runtime.NumCPU(), "games played in parallel")
+	checkpointPath := flags.String("checkpoint", "tune.json", "population saved after each generation, resumed from if exists")
+	out := flags.String("out", "weights.json", "file of the best weights")
+	verbose := flags.Bool("v", false, "log the games")
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if *size < TUNE_ELITES || *games < 1 || *workers < 1 {
+		return fmt.Errorf("population should be at least %d, games & workers at least 1", TUNE_ELITES)
+	}
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+
+	t := &tuner{
+		rnd:     newSeededRand(*seed),
+		size:    *size,
+		games:   *games,
+		pieces:  *pieces,
+		seed:    *seed,
+		workers: *workers,
+	}
+
+	var population []*individual
+	start := 0
+	if c, err := loadCheckpoint(*checkpointPath); err == nil {
+		population = c.Population
+		start = c.Generation + 1
+		t.rnd.src.state = c.Rand
+		fmt.Printf("resume from generation %d of %s\n", start, *checkpointPath)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	for gen := start; gen < *generations; gen++ {
+		if population == nil {
+			population = t.populate()
+		} else {
+			population = t.breed(population)
+		}
+		t.evaluate(population, gen)
+
+		mean := 0.0
+		for _, p := range population {
+			mean += p.Fitness
+		}
+		mean /= float64(len(population))
+		best := population[0]
+		fmt.Printf("generation %d: best %.1f, mean %.1f, weights %+v\n", gen, best.Fitness, mean, *best.Weights)
+
+		c := &checkpoint{Generation: gen, Rand: t.rnd.src.state, Population: population}
+		if err := writeJSON(*checkpointPath, c); err != nil {
+			return err
+		}
+		if err := writeJSON(*out, best.Weights); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package tetris
+
+import (
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestTuneResume(t *testing.T) {
+	dir := t.TempDir()
+	checkpointPath := filepath.Join(dir, "tune.json")
+	out := filepath.Join(dir, "weights.json")
+	args := []string{"-v", "-population", "4", "-games", "2", "-pieces", "30",
+		"-workers", "2", "-checkpoint", checkpointPath, "-out", out}
+
+	if err := RunTune(append(args, "-generations", "2")); err != nil {
+		t.Fatal(err)
+	}
+	c, err := loadCheckpoint(checkpointPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Generation != 1 || len(c.Population) != 4 {
+		t.Fatalf("checkpoint of generation %d, population %d", c.Generation, len(c.Population))
+	}
+	for i := 1; i < len(c.Population); i++ {
+		if c.Population[i].Fitness > c.Population[i-1].Fitness {
+			t.Error("population not sorted by fitness")
+		}
+	}
+
+	if err := RunTune(append(args, "-generations", "3")); err != nil {
+		t.Fatal(err)
+	}
+	if c, err = loadCheckpoint(checkpointPath); err != nil || c.Generation != 2 {
+		t.Fatalf("resumed checkpoint %+v, %v", c, err)
+	}
+	w, err := loadWeights(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *w != *c.Population[0].Weights {
+		t.Errorf("weights %+v, want the best %+v", *w, *c.Population[0].Weights)
+	}
+}
+
+// The same seed evolves the same, however many workers
+func TestTuneDeterministic(t *testing.T) {
+	run := func(workers int) *checkpoint {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "tune.json")
+		err := RunTune([]string{"-v", "-population", "4", "-games", "2", "-pieces", "30",
+			"-generations", "2", "-workers", strconv.Itoa(workers),
+			"-checkpoint", path, "-out", filepath.Join(dir, "weights.json")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := loadCheckpoint(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	a, b := run(1), run(3)
+	for i := range a.Population {
+		if *a.Population[i].Weights != *b.Population[i].Weights {
+			t.Fatalf("individual %d: %+v != %+v", i, *a.Population[i].Weights, *b.Population[i].Weights)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package tetris
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+const ROUND_DELAY = 3 * time.Second
+
+// Garbage rows sent by clearing 1~4 rows at once
+var attacks = [SHAPE_SIZE]int{0, 1, 2, 4}
+
+// Cancel the incoming garbage by cleared rows, and send the rest
+// to the opponent. The caller should hold g.m
+func (g *Game) attackBy(rows int) {
+	n := int32(attacks[rows-1])
+	if n == 0 {
+		return
+	}
+
+	for {
+		p := atomic.LoadInt32(&g.pendingGarbage)
+		c := p
+		if c > n {
+			c = n
+		}
+		if atomic.CompareAndSwapInt32(&g.pendingGarbage, p, p-c) {
+			n -= c
+			if c > 0 {
+				g.chanGarbage <- int(p - c)
+			}
+			break
+		}
+	}
+
+	if n > 0 && g.attack != nil {
+		log.Printf("[attack] %d rows", n)
+		g.attack(int(n))
+	}
+}
+
+// Game over by topping out, the caller should hold g.m
+func (g *Game) topOut() {
+	g.changeState(STATE_GAMEOVER)
+	if g.toppedOut != nil {
+		g.toppedOut()
+	}
+}
+
+// Stop the game if running, e.g. the opponent topped out
+func (g *Game) stop() {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	if g.running() {
+		g.changeState(STATE_FINISHED)
+		g.stateOk.Broadcast()
+	}
+}
+
+// Match of two games, the first to top out loses the round,
+// the first to win most of the rounds wins the match
+type Match struct {
+	games  [2]*Game
+	rounds int // best of
+	wins   [2]int
+
+	chanOver  chan int    // index of the topped out game
+	chanWins  chan [2]int // notify ui the wins after each round
+	chanAbort chan bool
+	chanDone  chan bool // closed when the match ends
+}
+
+func NewMatch(a, b *Game, rounds int) *Match {
+	m := &Match{
+		games:     [2]*Game{a, b},
+		rounds:    rounds,
+		chanOver:  make(chan int, 2),
+		chanWins:  make(chan [2]int),
+		chanAbort: make(chan bool, 1),
+		chanDone:  make(chan bool),
+	}
+
+	for i, g := range m.games {
+		i := i // for closures
+		opponent := m.games[1-i]
+		g.attack = opponent.sendGarbage
+		g.toppedOut = func() { m.chanOver <- i }
+	}
+	return m
+}
+
+// Returns the index of the match winner, -1 if not decided yet
+func (m *Match) winner(wins [2]int) int {
+	return matchWinner(wins, m.rounds)
+}
+
+func matchWinner(wins [2]int, rounds int) int {
+	for i, w := range wins {
+		if w > rounds/2 {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *Match) start() {
+	go m.run()
+}
+
+func (m *Match) run() {
+	defer close(m.chanDone)
+
+	log.Printf("start a match of best of %d", m.rounds)
+	m.chanWins <- m.wins
+
+	for m.winner(m.wins) < 0 {
+		for _, g := range m.games {
+			g.start()
+		}
+
+		var loser int
+		select {
+		case loser = <-m.chanOver:
+		case <-m.chanAbort:
+			for _, g := range m.games {
+				g.stop()
+			}
+			log.Println("match aborted")
+			return
+		}
+
+		// the winner may top out in the meantime, it's a loss anyway
+		winner := 1 - loser
+		m.games[winner].stop()
+		select {
+		case <-m.chanOver:
+		default:
+		}
+
+		m.wins[winner]++
+		log.Printf("[match] round won by player %d, wins %v", winner+1, m.wins)
+		m.chanWins <- m.wins
+
+		select {
+		case <-time.After(ROUND_DELAY):
+		case <-m.chanAbort:
+			log.Println("match aborted")
+			return
+		}
+	}
+
+	log.Printf("[match] won by player %d", m.winner(m.wins)+1)
+}
+
+// Stop both games and the match
+func (m *Match) abort() {
+	select {
+	case m.chanAbort <- true:
+	default:
+	}
+}
+
+func (m *Match) autoPause() {
+	for _, g := range m.games {
+		g.autoPause()
+	}
+}
+
+func (m *Match) togglePause() {
+	for _, g := range m.games {
+		g.togglePause()
+	}
+}
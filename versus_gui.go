@@ -0,0 +1,149 @@
+package tetris
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/gotk3/gotk3/gtk"
+)
+
+const (
+	SIGNAL_DESTROY = "destroy"
+
+	LABEL_NEWMATCH = "New Match"
+)
+
+// Show two games side by side, played on one keyboard
+func showVersusWindow(parent *gtk.ApplicationWindow) {
+	win, err := gtk.WindowNew(gtk.WINDOW_TOPLEVEL)
+	if err != nil {
+		log.Println("Could not create window:", err)
+		return
+	}
+	win.SetTransientFor(parent)
+	win.SetTitle("TETRIS " + LABEL_VERSUS)
+
+	var games [2]*Game
+	var views [2]*view
+	box, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 10)
+	for i := range games {
+		games[i] = newConfiguredGame()
+		views[i] = newVersusView()
+		box.PackStart(initPlayerPanel(fmt.Sprintf("PLAYER %d", i+1), views[i]), true, true, 10)
+		go views[i].show(games[i])
+	}
+
+	winsLabel, _ := gtk.LabelNew("")
+	match := NewMatch(games[0], games[1], config.VersusRounds)
+	initVersusTitleBar(win, winsLabel, func() {
+		match.abort()
+		match = NewMatch(games[0], games[1], config.VersusRounds)
+		go showMatch(match, winsLabel)
+		match.start()
+	})
+
+	connectKeys(win, func(key uint, pressed bool) bool {
+		for i, keys := range config.VersusKeys {
+			c, found := keys.lookup(key)
+			if !found {
+				continue
+			}
+			switch {
+			case c == CTRL_PAUSE:
+				if pressed {
+					go match.togglePause()
+				}
+			case c == CTRL_RESTART:
+			case pressed:
+				games[i].press(c)
+			default:
+				games[i].release(c)
+			}
+			return true
+		}
+		return false
+	}, func() {
+		for _, g := range games {
+			g.releaseAll()
+		}
+	})
+
+	connectAutoPause(win, func() { match.autoPause() })
+
+	win.Connect(SIGNAL_DESTROY, func() {
+		match.abort()
+	})
+
+	win.Add(box)
+	win.ShowAll()
+
+	for _, g := range games {
+		g.setPreviews(config.Previews)
+	}
+	go showMatch(match, winsLabel)
+	match.start()
+}
+
+func newVersusView() *view {
+	v := newView()
+	v.fontSize = UNIT_SIZE / 2
+	v.finishedText = "WIN"
+	return v
+}
+
+func initVersusTitleBar(win *gtk.Window, winsLabel *gtk.Label, newMatch func()) {
+	header, err := gtk.HeaderBarNew()
+	if err != nil {
+		log.Fatal("Could not create header bar:", err)
+	}
+	header.SetShowCloseButton(true)
+	header.SetCustomTitle(winsLabel)
+
+	btn, _ := gtk.ButtonNewWithLabel(LABEL_NEWMATCH)
+	btn.Connect(SIGNAL_CLICKED, newMatch)
+	header.PackEnd(btn)
+
+	win.SetTitlebar(header)
+}
+
+// Hold, board, garbage meter & next shapes of a player
+func initPlayerPanel(name string, v *view) *gtk.Box {
+	title, _ := gtk.LabelNew("")
+	title.SetMarkup(markup("#000", UNIT_SIZE/2, name))
+
+	board, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 0)
+	initHoldPanel(board, v)
+	initLeftPanel(board, v)
+	initMeter(board, v)
+	initNextPanel(board, v)
+
+	initValueLabels(v)
+	scoreLabel, _ := gtk.LabelNew("")
+	scoreLabel.SetMarkup(markup("#000", v.fontSize, LABEL_SCORE))
+	status, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 10)
+	status.PackStart(scoreLabel, false, false, 0)
+	status.PackStart(v.scoreValue, false, false, 0)
+	status.PackEnd(v.stateLabel, false, false, 0)
+
+	panel, _ := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 0)
+	panel.PackStart(title, false, false, 0)
+	panel.PackStart(board, true, true, 0)
+	panel.PackStart(status, false, false, 0)
+	return panel
+}
+
+// Show wins of each round, until the match ends
+func showMatch(m *Match, label *gtk.Label) {
+	for {
+		select {
+		case wins := <-m.chanWins:
+			text := fmt.Sprintf("%d : %d (best of %d)", wins[0], wins[1], m.rounds)
+			if w := m.winner(wins); w >= 0 {
+				text = fmt.Sprintf("%d : %d PLAYER %d WINS", wins[0], wins[1], w+1)
+			}
+			label.SetMarkup(markup("#000", UNIT_SIZE/2, text))
+		case <-m.chanDone:
+			return
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package tetris
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// Rows cleared at once cancel the pending garbage first, the rest is sent
+func TestAttackBy(t *testing.T) {
+	tests := []struct {
+		rows, pending int
+		sent, left    int
+	}{
+		{1, 0, 0, 0},
+		{2, 0, 1, 0},
+		{3, 0, 2, 0},
+		{4, 0, 4, 0},
+		{4, 3, 1, 0},
+		{4, 6, 0, 2},
+		{1, 3, 0, 3},
+	}
+	for _, test := range tests {
+		g := newHeadlessGame()
+		g.pendingGarbage = int32(test.pending)
+		sent := 0
+		g.attack = func(rows int) { sent += rows }
+		g.attackBy(test.rows)
+		if left := int(atomic.LoadInt32(&g.pendingGarbage)); sent != test.sent || left != test.left {
+			t.Errorf("%d rows, %d pending: sent %d, %d left; want %d, %d",
+				test.rows, test.pending, sent, left, test.sent, test.left)
+		}
+	}
+}
+
+// A tetris of one game rises as garbage in the other when it locks, the
+// other topped out by it
+func TestMatchAttack(t *testing.T) {
+	n, err := parseNotation("current: 16\npos: 9 0\nboard:\nXXXXXXXXXX.\nXXXXXXXXXX.\nXXXXXXXXXX.\nXXXXXXXXXX.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := newHeadlessGame(), newHeadlessGame()
+	m := NewMatch(a, b, 1)
+	for _, g := range m.games {
+		g.stepped = true
+		g.start()
+	}
+	if err := a.loadNotation(n); err != nil {
+		t.Fatal(err)
+	}
+	a.step(nil)
+	a.step([]inputEvent{{CTRL_HARD_DROP, true}})
+	if p := atomic.LoadInt32(&b.pendingGarbage); p != 4 {
+		t.Fatalf("%d rows pending, want 4", p)
+	}
+
+	// a column 3 rows below the top, pushed out by the 4 rows
+	tall, err := parseNotation("current: 53\npos: 4 0\nboard:\n" + strings.Repeat("..........X\n", ROW-3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.loadNotation(tall); err != nil {
+		t.Fatal(err)
+	}
+	b.step(nil)
+	b.step([]inputEvent{{CTRL_HARD_DROP, true}})
+	if s := stateOf(b); s != STATE_GAMEOVER {
+		t.Errorf("state %s, want game over", s)
+	}
+	select {
+	case i := <-m.chanOver:
+		if i != 1 {
+			t.Errorf("game %d topped out, want 1", i)
+		}
+	default:
+		t.Error("topped out not told")
+	}
+}